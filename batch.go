@@ -2,9 +2,11 @@ package bcdb
 
 import (
 	"bcdb/data"
+	"context"
 	"encoding/binary"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -21,6 +23,7 @@ type WriteBatch struct {
 	db             *DB
 	pendingWrites  map[string]*data.LogRecord //暂存写入的数据
 	indexerStorage map[string]*data.LogRecordPos
+	conditions     map[string][]byte // 提交前需要满足的条件，value为nil表示key必须不存在
 }
 
 func (db *DB) NewWriteBatch(opts WriteBatchOptions) *WriteBatch {
@@ -30,10 +33,16 @@ func (db *DB) NewWriteBatch(opts WriteBatchOptions) *WriteBatch {
 		db:             db,
 		pendingWrites:  make(map[string]*data.LogRecord),
 		indexerStorage: make(map[string]*data.LogRecordPos),
+		conditions:     make(map[string][]byte),
 	}
 }
 
 func (wb *WriteBatch) Put(key []byte, value []byte) error {
+	return wb.PutWithMeta(key, value, nil)
+}
+
+// 写入数据并附带用户元数据，元数据可以通过DB.GetWithMeta读取
+func (wb *WriteBatch) PutWithMeta(key, value, meta []byte) error {
 	if len(key) == 0 {
 		return ErrKeyisEmpty
 	}
@@ -47,6 +56,7 @@ func (wb *WriteBatch) Put(key []byte, value []byte) error {
 	logRecord := &data.LogRecord{
 		Key:   key,
 		Value: value,
+		Meta:  meta,
 	}
 	wb.pendingWrites[string(key)] = logRecord
 	return nil
@@ -60,7 +70,7 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	defer wb.mu.Unlock()
 
 	// 数据不存在时直接返回
-	if wb.db.index.Get(key) == nil {
+	if !wb.db.keyExistsWithLock(DefaultCFID, key) {
 		if wb.pendingWrites[string(key)] != nil {
 			delete(wb.pendingWrites, string(key))
 		}
@@ -75,32 +85,130 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	return nil
 }
 
+// 添加提交条件：提交时key的值必须等于expected，expected为nil表示key必须不存在
+// 条件基于提交时数据库中的数据判断，不包含批次内的写入，任一条件不满足时整个批次都不会写入
+func (wb *WriteBatch) Expect(key, expected []byte) error {
+	if len(key) == 0 {
+		return ErrKeyisEmpty
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	wb.conditions[string(key)] = expected
+	return nil
+}
+
+// 提交时key的值等于old才写入new，old为nil表示key必须不存在
+func (wb *WriteBatch) CompareAndSwap(key, old, new []byte) error {
+	return wb.addConditional(key, old, &data.LogRecord{Key: key, Value: new})
+}
+
+// 提交时key不存在才写入
+func (wb *WriteBatch) PutIfAbsent(key, value []byte) error {
+	return wb.CompareAndSwap(key, nil, value)
+}
+
+// 提交时key的值等于value才删除，value为nil时与空value相同，不表示key不存在
+func (wb *WriteBatch) DeleteIfEquals(key, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	// 条件保证了提交时key存在，直接暂存删除记录
+	return wb.addConditional(key, value, &data.LogRecord{Key: key, Type: data.LogRecordDeleted})
+}
+
+// 同时暂存提交条件和写入，批次已满时两者都不记录
+func (wb *WriteBatch) addConditional(key, expected []byte, logRecord *data.LogRecord) error {
+	if len(key) == 0 {
+		return ErrKeyisEmpty
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	if uint(len(wb.pendingWrites)) >= wb.options.MaxBatchSize {
+		return ErrExceedMaxBatchSize
+	}
+	wb.conditions[string(key)] = expected
+	wb.pendingWrites[string(key)] = logRecord
+	return nil
+}
+
 func (wb *WriteBatch) Commit() error {
+	return wb.CommitCtx(context.Background())
+}
+
+func (wb *WriteBatch) commit(ctx context.Context) error {
+	if m := wb.db.metrics; m != nil {
+		defer m.CommitDuration.ObserveSince(time.Now())
+	}
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
 	// 如果暂存区没有数据
+	if len(wb.pendingWrites) == 0 && len(wb.conditions) == 0 {
+		return nil
+	}
+
+	// 需要立即持久化时通过组提交写入，带条件或者需要维护二级索引的批次需要在同一把锁内完成读取和写入
+	if wb.options.SyncWrites && len(wb.conditions) == 0 {
+		if err := wb.commitWithGroup(ctx); err != errSecondaryIndexesRequired {
+			return err
+		}
+	}
+
+	return wb.db.writeWithLock(ctx, wb.commitWithLock)
+}
+
+// 检查提交条件并写入暂存的数据，调用方需持有db.mu
+func (wb *WriteBatch) commitWithLock() error {
+	if wb.db.closed {
+		return ErrDBClosed
+	}
+	// 检查提交条件
+	for key, expected := range wb.conditions {
+		ok, err := wb.db.matchValue([]byte(key), expected)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConditionFailed
+		}
+	}
 	if len(wb.pendingWrites) == 0 {
+		wb.conditions = make(map[string][]byte)
 		return nil
 	}
 
-	// 获取最新的事务序列号
-	wb.db.mu.Lock()
-	defer wb.db.mu.Unlock()
+	if wb.db.hasSecondaryIndexes() {
+		writes := make([]*data.LogRecord, 0, len(wb.pendingWrites))
+		for _, rec := range wb.pendingWrites {
+			writes = append(writes, rec)
+		}
+		if err := wb.db.appendWithSecondaryIndexes(writes, wb.options.SyncWrites); err != nil {
+			return err
+		}
+		wb.pendingWrites = make(map[string]*data.LogRecord)
+		wb.conditions = make(map[string][]byte)
+		return nil
+	}
 
+	// 获取最新的事务序列号
 	seqNo := atomic.AddUint64(&wb.db.seqNo, 1)
 	// 写入数据到数据文件当中
 
 	for _, rec := range wb.pendingWrites {
-		logRecordPos, err := wb.db.appendLogRecord(&data.LogRecord{
+		logRecord := &data.LogRecord{
 			Key:   logRecordWithSeqNo(rec.Key, seqNo),
 			Value: rec.Value,
 			Type:  rec.Type,
-		})
+			Meta:  rec.Meta,
+		}
+		logRecordPos, err := wb.db.appendLogRecord(logRecord)
 		if err != nil {
 			return err
 		}
 		wb.indexerStorage[string(rec.Key)] = logRecordPos
+		rec.Version = logRecord.Version
 	}
 
 	// 添加标识事务完成的数据
@@ -111,10 +219,8 @@ func (wb *WriteBatch) Commit() error {
 	if _, err := wb.db.appendLogRecord(finishedRecord); err != nil {
 		return err
 	}
-
-	// 根据配置决定是否立即持久化到磁盘
-	if wb.options.SyncWrites && wb.db.activeFile != nil {
-		if err := wb.db.activeFile.Sync(); err != nil {
+	if wb.options.SyncWrites {
+		if err := wb.db.syncActiveFile(); err != nil {
 			return err
 		}
 	}
@@ -122,22 +228,41 @@ func (wb *WriteBatch) Commit() error {
 	// 更新内存索引
 	for _, rec := range wb.pendingWrites {
 		pos := wb.indexerStorage[string(rec.Key)]
-		if rec.Type == data.LogRecordDeleted {
-			if !wb.db.index.Delete(rec.Key) {
-				return ErrIndexUpdateFiled
-			}
-		}
-		if rec.Type == data.LogRecordNormal {
-			if !wb.db.index.Put(rec.Key, pos) {
-				return ErrIndexUpdateFiled
-			}
+		if err := wb.db.updateIndex(rec.CF, rec.Key, rec.Type, pos, rec.Version); err != nil {
+			return err
 		}
 	}
 
 	// 清空暂存数据
 	wb.pendingWrites = make(map[string]*data.LogRecord)
 	wb.indexerStorage = make(map[string]*data.LogRecordPos)
+	wb.conditions = make(map[string][]byte)
+
+	return nil
+}
 
+// 将事务数据和事务完成标识作为一个整体交给组提交协程写入
+func (wb *WriteBatch) commitWithGroup(ctx context.Context) error {
+	seqNo := atomic.AddUint64(&wb.db.seqNo, 1)
+	records := make([]*data.LogRecord, 0, len(wb.pendingWrites)+1)
+	for _, rec := range wb.pendingWrites {
+		records = append(records, &data.LogRecord{
+			Key:   logRecordWithSeqNo(rec.Key, seqNo),
+			Value: rec.Value,
+			Type:  rec.Type,
+			Meta:  rec.Meta,
+		})
+	}
+	records = append(records, &data.LogRecord{
+		Key:  logRecordWithSeqNo(TxnFinKey, seqNo),
+		Type: data.LogRecordTxnFin,
+	})
+	if err := wb.db.groupCommitCtx(ctx, records); err != nil {
+		return err
+	}
+
+	// 清空暂存数据
+	wb.pendingWrites = make(map[string]*data.LogRecord)
 	return nil
 }
 
@@ -0,0 +1,289 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 写入blob文件时每次读取的数据量
+const blobChunkSize = 64 * 1024
+
+// 以流的方式写入数据，超过BlobThreshold的value会分离存储在单独的blob文件中
+func (db *DB) PutStream(key []byte, r io.Reader) error {
+	if len(key) == 0 {
+		return ErrKeyisEmpty
+	}
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	// 先读取阈值大小的数据，判断是否需要分离存储
+	head := make([]byte, db.options.BlobThreshold+1)
+	n, err := io.ReadFull(r, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return db.Put(key, head[:n])
+	}
+	if err != nil {
+		return err
+	}
+
+	blobID := db.newBlobID()
+	defer db.releaseBlobID(blobID)
+
+	ref, err := db.writeBlobFile(blobID, io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		_ = db.fs.Remove(data.GetBlobFileName(db.options.DirPath, blobID))
+		return err
+	}
+
+	logRecord := &data.LogRecord{
+		Key:   logRecordWithSeqNo(key, NonTxnSeqNo),
+		Value: data.EncodeBlobRef(ref),
+		Type:  data.LogRecordBlob,
+	}
+	if db.options.SyncWrite {
+		return db.groupCommitRecord(key, logRecord)
+	}
+	return db.appendLogRecordWithLock(key, logRecord)
+}
+
+// 以流的方式读取数据，blob文件中的value在读取时才从文件中加载
+func (db *DB) GetStream(key []byte) (io.ReadCloser, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if len(key) == 0 {
+		return nil, ErrKeyisEmpty
+	}
+	recordPos := db.index.Get(key)
+	if recordPos == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	if chain := db.operands[string(key)]; chain != nil {
+		value, err := db.mergeOperands(key, chain)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(value)), nil
+	}
+
+	logRecord, err := db.getLogRecordByPos(recordPos)
+	if err != nil {
+		return nil, err
+	}
+	switch logRecord.Type {
+	case data.LogRecordDeleted:
+		return nil, ErrKeyNotFound
+	case data.LogRecordBlob:
+		ref := data.DecodeBlobRef(logRecord.Value)
+		blobFile, err := data.OpenBlobFile(db.fs, db.options.DirPath, ref.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &blobReader{file: blobFile, ref: ref}, nil
+	default:
+		return io.NopCloser(bytes.NewReader(logRecord.Value)), nil
+	}
+}
+
+// 将数据写入blob文件并持久化，返回blob的引用
+func (db *DB) writeBlobFile(blobID uint32, r io.Reader) (*data.BlobRef, error) {
+	blobFile, err := data.OpenBlobFile(db.fs, db.options.DirPath, blobID)
+	if err != nil {
+		return nil, err
+	}
+	defer blobFile.Close()
+
+	ref := &data.BlobRef{ID: blobID}
+	buf := make([]byte, blobChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := blobFile.Write(buf[:n]); err != nil {
+				return nil, err
+			}
+			ref.CRC = crc32.Update(ref.CRC, crc32.IEEETable, buf[:n])
+			ref.Size += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// blob文件必须先于引用它的日志记录持久化
+	if err := blobFile.Sync(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	if db.blobSizes != nil {
+		db.blobSizes[blobID] = ref.Size
+	}
+	db.mu.Unlock()
+	return ref, nil
+}
+
+// 读取blob文件中的完整value
+func (db *DB) readBlobValue(ref *data.BlobRef) ([]byte, error) {
+	blobFile, err := data.OpenBlobFile(db.fs, db.options.DirPath, ref.ID)
+	if err != nil {
+		return nil, err
+	}
+	reader := &blobReader{file: blobFile, ref: ref}
+	defer reader.Close()
+
+	value := make([]byte, ref.Size)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return nil, err
+	}
+	if db.metrics != nil {
+		db.metrics.BytesRead.Add(uint64(ref.Size))
+	}
+	// 读到末尾时校验crc
+	if _, err := reader.Read(nil); err != io.EOF {
+		return nil, err
+	}
+	return value, nil
+}
+
+// 分配新的blob文件id，写入完成之前不会被merge清理
+func (db *DB) newBlobID() uint32 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	blobID := db.nextBlobID
+	db.nextBlobID++
+	db.pendingBlobs[blobID] = struct{}{}
+	return blobID
+}
+
+func (db *DB) releaseBlobID(blobID uint32) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.pendingBlobs, blobID)
+}
+
+// 加载数据目录中已有的blob文件，确定下一个blob文件id
+func (db *DB) loadBlobFiles() error {
+	fileNames, err := db.fs.ReadDir(db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		if !strings.HasSuffix(fileName, data.BlobFileSuffix) {
+			continue
+		}
+		blobID, err := strconv.Atoi(strings.TrimSuffix(fileName, data.BlobFileSuffix))
+		if err != nil {
+			return ErrDataFileCorrupted
+		}
+		if uint32(blobID) >= db.nextBlobID {
+			db.nextBlobID = uint32(blobID) + 1
+		}
+		if db.blobSizes != nil {
+			if err := db.loadBlobSize(uint32(blobID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 记录blob文件的大小，用于计算磁盘预算
+func (db *DB) loadBlobSize(blobID uint32) error {
+	blobFile, err := data.OpenBlobFile(db.fs, db.options.DirPath, blobID)
+	if err != nil {
+		return err
+	}
+	defer blobFile.Close()
+	size, err := blobFile.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	db.blobSizes[blobID] = size
+	return nil
+}
+
+// 删除不再被引用的blob文件，只处理merge开始前已经写入完成的blob
+func (db *DB) removeUnusedBlobs(nextBlobID uint32, pending, referenced map[uint32]struct{}) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// 覆盖或删除blob的记录持久化之后，才能删除blob文件
+	if db.activeFile != nil {
+		if err := db.syncActiveFile(); err != nil {
+			return err
+		}
+	}
+
+	fileNames, err := db.fs.ReadDir(db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		if !strings.HasSuffix(fileName, data.BlobFileSuffix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(fileName, data.BlobFileSuffix))
+		if err != nil {
+			continue
+		}
+		blobID := uint32(id)
+		if blobID >= nextBlobID {
+			continue
+		}
+		if _, ok := pending[blobID]; ok {
+			continue
+		}
+		if _, ok := referenced[blobID]; ok {
+			continue
+		}
+		if err := db.fs.Remove(data.GetBlobFileName(db.options.DirPath, blobID)); err != nil {
+			return err
+		}
+		delete(db.blobSizes, blobID)
+	}
+	return nil
+}
+
+// 按需从blob文件中读取value
+type blobReader struct {
+	file   *data.DataFile
+	ref    *data.BlobRef
+	offset int64
+	crc    uint32
+}
+
+func (br *blobReader) Read(p []byte) (int, error) {
+	if br.offset >= br.ref.Size {
+		if br.crc != br.ref.CRC {
+			return 0, data.ErrInvaildCRC
+		}
+		return 0, io.EOF
+	}
+	if remain := br.ref.Size - br.offset; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err := br.file.IOManager.Read(p, br.offset)
+	br.crc = crc32.Update(br.crc, crc32.IEEETable, p[:n])
+	br.offset += int64(n)
+	if err == io.EOF && br.offset < br.ref.Size {
+		return n, io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (br *blobReader) Close() error {
+	return br.file.Close()
+}
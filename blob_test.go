@@ -0,0 +1,164 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 辅助函数 ====================
+
+func countBlobFiles(t *testing.T, dirPath string) int {
+	entries, err := os.ReadDir(dirPath)
+	assert.Nil(t, err)
+	var count int
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), data.BlobFileSuffix) {
+			count++
+		}
+	}
+	return count
+}
+
+// ==================== PutStream / GetStream 测试 ====================
+
+// 测试小于阈值的value直接写入数据文件
+func TestPutStream_SmallValue(t *testing.T) {
+	opts := testOptions(t)
+	opts.BlobThreshold = 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	value := bytes.Repeat([]byte("a"), 1024)
+	assert.Nil(t, db.PutStream([]byte("key"), bytes.NewReader(value)))
+	assert.Equal(t, 0, countBlobFiles(t, opts.DirPath))
+
+	val, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+
+	r, err := db.GetStream([]byte("key"))
+	assert.Nil(t, err)
+	val, err = io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	assert.Nil(t, r.Close())
+}
+
+// 测试超过阈值的value分离存储到blob文件
+func TestPutStream_LargeValue(t *testing.T) {
+	opts := testOptions(t)
+	opts.BlobThreshold = 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	value := bytes.Repeat([]byte("0123456789"), 20*1024)
+	assert.Nil(t, db.PutStream([]byte("key"), bytes.NewReader(value)))
+	assert.Equal(t, 1, countBlobFiles(t, opts.DirPath))
+
+	val, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+
+	r, err := db.GetStream([]byte("key"))
+	assert.Nil(t, err)
+	val, err = io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	assert.Nil(t, r.Close())
+	assert.Nil(t, db.Close())
+
+	// 重新打开后仍然可以读取
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+	val, err = db2.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	assert.Equal(t, uint32(1), db2.nextBlobID)
+}
+
+// 测试读取不存在或被删除的key
+func TestGetStream_NotFound(t *testing.T) {
+	opts := testOptions(t)
+	opts.BlobThreshold = 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	_, err = db.GetStream([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, db.PutStream([]byte("key"), bytes.NewReader(make([]byte, 4096))))
+	assert.Nil(t, db.Delete([]byte("key")))
+	_, err = db.GetStream([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+// 测试blob文件损坏时读取返回crc错误
+func TestGetStream_Corrupted(t *testing.T) {
+	opts := testOptions(t)
+	opts.BlobThreshold = 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.PutStream([]byte("key"), bytes.NewReader(bytes.Repeat([]byte("a"), 4096))))
+
+	blobName := data.GetBlobFileName(opts.DirPath, 0)
+	corrupted := bytes.Repeat([]byte("a"), 4096)
+	corrupted[100] = 'b'
+	assert.Nil(t, os.WriteFile(blobName, corrupted, 0644))
+
+	_, err = db.Get([]byte("key"))
+	assert.Equal(t, data.ErrInvaildCRC, err)
+
+	r, err := db.GetStream([]byte("key"))
+	assert.Nil(t, err)
+	defer r.Close()
+	_, err = io.ReadAll(r)
+	assert.Equal(t, data.ErrInvaildCRC, err)
+}
+
+// 测试merge清理不再被引用的blob文件
+func TestMerge_RemoveUnusedBlobs(t *testing.T) {
+	opts := testOptions(t)
+	opts.BlobThreshold = 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	v1 := bytes.Repeat([]byte("1"), 4096)
+	v2 := bytes.Repeat([]byte("2"), 4096)
+	assert.Nil(t, db.PutStream([]byte("overwritten"), bytes.NewReader(v1)))
+	assert.Nil(t, db.PutStream([]byte("overwritten"), bytes.NewReader(v2)))
+	assert.Nil(t, db.PutStream([]byte("deleted"), bytes.NewReader(v1)))
+	assert.Nil(t, db.Delete([]byte("deleted")))
+	assert.Nil(t, db.PutStream([]byte("kept"), bytes.NewReader(v1)))
+	assert.Equal(t, 4, countBlobFiles(t, opts.DirPath))
+
+	assert.Nil(t, db.Merge())
+	assert.Equal(t, 2, countBlobFiles(t, opts.DirPath))
+
+	val, err := db.Get([]byte("overwritten"))
+	assert.Nil(t, err)
+	assert.Equal(t, v2, val)
+	assert.Nil(t, db.Close())
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+	val, err = db2.Get([]byte("overwritten"))
+	assert.Nil(t, err)
+	assert.Equal(t, v2, val)
+	val, err = db2.Get([]byte("kept"))
+	assert.Nil(t, err)
+	assert.Equal(t, v1, val)
+	_, err = db2.Get([]byte("deleted"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
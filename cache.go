@@ -0,0 +1,147 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"container/list"
+	"sync"
+)
+
+// 每个缓存项除value之外额外占用的内存
+const cacheEntryOverhead = 64
+
+// value缓存的统计信息
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Size    int64 // 缓存占用的字节数
+}
+
+// 缓存的key，只包含记录的位置
+type cacheKey struct {
+	fid    uint32
+	offset int64
+}
+
+func newCacheKey(pos data.LogRecordPos) cacheKey {
+	return cacheKey{fid: pos.Fid, offset: pos.Offset}
+}
+
+// 以日志记录位置为key的LRU缓存，保存读取过的value
+type valueCache struct {
+	mu       *sync.Mutex
+	capacity int64
+	size     int64
+	ll       *list.List
+	items    map[cacheKey]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value []byte
+}
+
+func newValueCache(capacity int64) *valueCache {
+	return &valueCache{
+		mu:       new(sync.Mutex),
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// 返回value的副本，调用方修改返回值不会影响缓存
+func (c *valueCache) get(pos data.LogRecordPos) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[newCacheKey(pos)]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.ll.MoveToFront(elem)
+	return append([]byte{}, elem.Value.(*cacheEntry).value...), true
+}
+
+func (c *valueCache) add(pos data.LogRecordPos, value []byte) {
+	entrySize := int64(len(value)) + cacheEntryOverhead
+	if entrySize > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := newCacheKey(pos)
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, value: append([]byte{}, value...)})
+	c.size += entrySize
+	// 淘汰最久未使用的value
+	for c.size > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *valueCache) remove(pos data.LogRecordPos) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[newCacheKey(pos)]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *valueCache) removeElement(elem *list.Element) {
+	entry := c.ll.Remove(elem).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.size -= int64(len(entry.value)) + cacheEntryOverhead
+}
+
+func (c *valueCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[cacheKey]*list.Element)
+	c.size = 0
+}
+
+func (c *valueCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.ll.Len(), Size: c.size}
+}
+
+// value缓存的命中统计，未开启缓存时返回零值
+func (db *DB) CacheStats() CacheStats {
+	if db.cache == nil {
+		return CacheStats{}
+	}
+	return db.cache.stats()
+}
+
+// key被覆盖或删除之前，从缓存中移除旧的value，调用方需持有db.mu
+func (db *DB) invalidateCache(cf uint32, key []byte, typ data.LogRecordType) {
+	family := db.cfByID[cf]
+	if family == nil {
+		return
+	}
+	if typ == data.LogRecordRangeDeleted {
+		start, end := decodeRangeKey(key)
+		iter := family.index.RangeIterator(start, end, false)
+		defer iter.Close()
+		for iter.ReWind(); iter.Valid(); iter.Next() {
+			db.cache.remove(*iter.Value())
+		}
+		return
+	}
+	if pos := family.index.Get(key); pos != nil {
+		db.cache.remove(*pos)
+	}
+}
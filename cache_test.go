@@ -0,0 +1,163 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bcdb/metrics"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== value缓存测试 ====================
+
+func TestValueCache_LRU(t *testing.T) {
+	c := newValueCache(3 * (cacheEntryOverhead + 1))
+	for i := 0; i < 3; i++ {
+		c.add(data.LogRecordPos{Fid: 0, Offset: int64(i)}, []byte{byte(i)})
+	}
+	// 访问0之后，最久未使用的是1
+	_, ok := c.get(data.LogRecordPos{Offset: 0})
+	assert.True(t, ok)
+	c.add(data.LogRecordPos{Offset: 3}, []byte{3})
+	_, ok = c.get(data.LogRecordPos{Offset: 1})
+	assert.False(t, ok)
+	for _, offset := range []int64{0, 2, 3} {
+		value, ok := c.get(data.LogRecordPos{Offset: offset})
+		assert.True(t, ok)
+		assert.Equal(t, []byte{byte(offset)}, value)
+	}
+	assert.Equal(t, CacheStats{Hits: 4, Misses: 1, Entries: 3, Size: 3 * (cacheEntryOverhead + 1)}, c.stats())
+
+	// 超过缓存容量的value不缓存
+	c.add(data.LogRecordPos{Offset: 4}, make([]byte, 4*cacheEntryOverhead))
+	assert.Equal(t, 3, c.stats().Entries)
+
+	c.remove(data.LogRecordPos{Offset: 0})
+	assert.Equal(t, 2, c.stats().Entries)
+	c.purge()
+	assert.Equal(t, CacheStats{Hits: 4, Misses: 1}, c.stats())
+}
+
+func TestDB_CacheHit(t *testing.T) {
+	opts := testOptions(t)
+	opts.CacheSize = 1024 * 1024
+	opts.Metrics = metrics.New()
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	bytesRead := opts.Metrics.BytesRead.Value()
+
+	// 命中缓存时不读取数据文件，修改返回值不影响缓存
+	value[0] = 'V'
+	for i := 0; i < 3; i++ {
+		value, err = db.Get([]byte("key"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), value)
+	}
+	assert.Equal(t, bytesRead, opts.Metrics.BytesRead.Value())
+	stats := db.CacheStats()
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+// key被覆盖、删除、范围删除时缓存失效
+func TestDB_CacheInvalidate(t *testing.T) {
+	opts := testOptions(t)
+	opts.CacheSize = 1024 * 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		assert.Nil(t, db.Put(key, []byte("old")))
+		_, err := db.Get(key)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 10, db.CacheStats().Entries)
+
+	assert.Nil(t, db.Put([]byte("key-0"), []byte("new")))
+	assert.Equal(t, 9, db.CacheStats().Entries)
+	value, err := db.Get([]byte("key-0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), value)
+
+	assert.Nil(t, db.Delete([]byte("key-1")))
+	assert.Equal(t, 9, db.CacheStats().Entries)
+	_, err = db.Get([]byte("key-1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, db.DeleteRange([]byte("key-5"), []byte("key-8")))
+	assert.Equal(t, 6, db.CacheStats().Entries)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("key-2"), []byte("batch")))
+	assert.Nil(t, wb.Commit())
+	assert.Equal(t, 5, db.CacheStats().Entries)
+	value, err = db.Get([]byte("key-2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("batch"), value)
+
+	// 其他列族的数据同样会被缓存和失效
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, users.Put([]byte("key-3"), []byte("user")))
+	value, err = users.Get([]byte("key-3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("user"), value)
+	assert.Equal(t, 7, db.CacheStats().Entries)
+	assert.Nil(t, users.Delete([]byte("key-3")))
+	assert.Equal(t, 6, db.CacheStats().Entries)
+	value, err = db.Get([]byte("key-3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old"), value)
+}
+
+func TestDB_CacheEvictAndMerge(t *testing.T) {
+	opts := testOptions(t)
+	opts.CacheSize = 10 * (cacheEntryOverhead + 100)
+	opts.MaxFileSize = 4096
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), bytes.Repeat([]byte{byte(i)}, 100)))
+	}
+	for i := 0; i < 50; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, bytes.Repeat([]byte{byte(i)}, 100), value)
+	}
+	stats := db.CacheStats()
+	assert.Equal(t, 10, stats.Entries)
+	assert.LessOrEqual(t, stats.Size, opts.CacheSize)
+
+	assert.Nil(t, db.Merge())
+	assert.Equal(t, 0, db.CacheStats().Entries)
+	value, err := db.Get([]byte("key-49"))
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{49}, 100), value)
+}
+
+func TestDB_CacheDisabled(t *testing.T) {
+	opts := testOptions(t)
+	opts.CacheSize = 0
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	_, err = db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStats{}, db.CacheStats())
+}
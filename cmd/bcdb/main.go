@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bcdb"
+	"bcdb/data"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: bcdb <command> [arguments]
+
+commands:
+  migrate <dir>    upgrade a data directory to the current file format
+  export [-format binary|json] [-prefix p] <dir> [file]
+                   export all keys to file, or to stdout when file is omitted
+  import [-prefix p] <dir> [file]
+                   import keys from file, or from stdin when file is omitted
+`
+
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if err == errUsage {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "bcdb:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:], out)
+	case "export":
+		return runExport(args[1:], out)
+	case "import":
+		return runImport(args[1:], in, out)
+	default:
+		return errUsage
+	}
+}
+
+func runMigrate(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+	opts := bcdb.DefaultOptions
+	opts.DirPath = flags.Arg(0)
+	if err := bcdb.Migrate(opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "migrated %s to format version %d\n", opts.DirPath, data.FormatVersion)
+	return nil
+}
+
+func runExport(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "binary", "")
+	prefix := flags.String("prefix", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 || flags.NArg() > 2 {
+		return errUsage
+	}
+	exportOpts := bcdb.ExportOptions{Prefix: []byte(*prefix)}
+	switch *format {
+	case "binary":
+		exportOpts.Format = bcdb.ExportBinary
+	case "json":
+		exportOpts.Format = bcdb.ExportJSONLines
+	default:
+		return errUsage
+	}
+
+	db, err := openExisting(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// 没有指定文件时导出到标准输出，不再输出其他信息
+	if flags.NArg() == 1 {
+		_, err := db.Export(out, exportOpts)
+		return err
+	}
+	file, err := os.Create(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	count, err := db.Export(file, exportOpts)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported %d keys to %s\n", count, flags.Arg(1))
+	return nil
+}
+
+func runImport(args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	prefix := flags.String("prefix", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 || flags.NArg() > 2 {
+		return errUsage
+	}
+	if flags.NArg() == 2 {
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	opts := bcdb.DefaultOptions
+	opts.DirPath = flags.Arg(0)
+	db, err := bcdb.Open(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	count, err := db.Import(in, bcdb.ImportOptions{Prefix: []byte(*prefix)})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "imported %d keys into %s\n", count, opts.DirPath)
+	return nil
+}
+
+// 打开已经存在的数据目录，避免导出时创建空目录
+func openExisting(dirPath string) (*bcdb.DB, error) {
+	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		return nil, bcdb.ErrDBDirNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	opts := bcdb.DefaultOptions
+	opts.DirPath = dirPath
+	return bcdb.Open(opts)
+}
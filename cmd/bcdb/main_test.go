@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bcdb"
+	"bcdb/data"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Usage(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, errUsage, run(nil, nil, &out))
+	assert.Equal(t, errUsage, run([]string{"unknown"}, nil, &out))
+	assert.Equal(t, errUsage, run([]string{"migrate"}, nil, &out))
+	assert.Equal(t, errUsage, run([]string{"migrate", "a", "b"}, nil, &out))
+	assert.Equal(t, errUsage, run([]string{"export"}, nil, &out))
+	assert.Equal(t, errUsage, run([]string{"export", "-format", "xml", "dir"}, nil, &out))
+	assert.Equal(t, errUsage, run([]string{"import", "a", "b", "c"}, nil, &out))
+}
+
+func TestRun_Migrate(t *testing.T) {
+	dir := t.TempDir()
+
+	// 旧格式的数据文件
+	rec, _ := data.EncodeLogRecord(&data.LogRecord{Key: []byte{0, 'k'}, Value: []byte("v")})
+	assert.Nil(t, os.WriteFile(data.GetDataFileName(dir, 0), rec, 0644))
+
+	var out bytes.Buffer
+	assert.Nil(t, run([]string{"migrate", dir}, nil, &out))
+	assert.Contains(t, out.String(), "format version 2")
+
+	opts := bcdb.DefaultOptions
+	opts.DirPath = dir
+	db, err := bcdb.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	value, err := db.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), value)
+
+	assert.Equal(t, bcdb.ErrDBDirNotFound, run([]string{"migrate", dir + "-missing"}, nil, &out))
+}
+
+func TestRun_ExportImport(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+
+	opts := bcdb.DefaultOptions
+	opts.DirPath = src
+	db, err := bcdb.Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("user:%d", i)), []byte("user")))
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("order:%d", i)), []byte("order")))
+	}
+	assert.Nil(t, db.Close())
+
+	// 导出到标准输出，从标准输入导入
+	var exported, out bytes.Buffer
+	assert.Nil(t, run([]string{"export", "-format", "json", "-prefix", "user:", src}, nil, &exported))
+	assert.Equal(t, 10, bytes.Count(exported.Bytes(), []byte("\n")))
+	assert.Nil(t, run([]string{"import", dst}, &exported, &out))
+	assert.Equal(t, "imported 10 keys into "+dst+"\n", out.String())
+
+	// 导出到文件，从文件导入时按前缀过滤
+	file := filepath.Join(t.TempDir(), "export.bin")
+	out.Reset()
+	assert.Nil(t, run([]string{"export", src, file}, nil, &out))
+	assert.Equal(t, "exported 20 keys to "+file+"\n", out.String())
+	out.Reset()
+	assert.Nil(t, run([]string{"import", "-prefix", "order:", dst, file}, nil, &out))
+	assert.Equal(t, "imported 10 keys into "+dst+"\n", out.String())
+
+	opts.DirPath = dst
+	db, err = bcdb.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 20, len(db.ListKeys()))
+
+	assert.Equal(t, bcdb.ErrDBDirNotFound, run([]string{"export", src + "-missing"}, nil, &out))
+	_, err = os.Stat(src + "-missing")
+	assert.True(t, os.IsNotExist(err))
+}
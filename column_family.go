@@ -0,0 +1,309 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bcdb/index"
+	"context"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	DefaultColumnFamily        = "default"
+	DefaultCFID         uint32 = 0
+)
+
+type ColumnFamilyOptions struct {
+	IndexType index.IndexType
+}
+
+var DefaultColumnFamilyOptions = ColumnFamilyOptions{
+	IndexType: index.BTREE,
+}
+
+// 列族，与其他列族共用数据文件，拥有独立的内存索引
+type ColumnFamily struct {
+	db      *DB
+	id      uint32
+	name    string
+	options ColumnFamilyOptions
+	index   index.Indexer
+}
+
+// 创建列族，列族信息持久化之后才会返回
+func (db *DB) CreateColumnFamily(name string, opts ColumnFamilyOptions) (*ColumnFamily, error) {
+	if len(name) == 0 {
+		return nil, ErrKeyisEmpty
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if name == secondaryIndexCFName {
+		return nil, ErrColumnFamilyReserved
+	}
+	return db.createColumnFamily(name, opts)
+}
+
+// 创建列族并持久化列族信息，调用方需持有db.mu
+func (db *DB) createColumnFamily(name string, opts ColumnFamilyOptions) (*ColumnFamily, error) {
+	if _, ok := db.columnFamilies[name]; ok {
+		return nil, ErrColumnFamilyExists
+	}
+	if opts.IndexType != index.BTREE {
+		return nil, ErrInvalidIndexType
+	}
+	cf := &ColumnFamily{
+		db:      db,
+		id:      db.nextCFID,
+		name:    name,
+		options: opts,
+		index:   index.NewIndexer(opts.IndexType),
+	}
+	families := append(db.listColumnFamilies(), cf)
+	if err := db.writeColumnFamilies(families); err != nil {
+		return nil, err
+	}
+	db.columnFamilies[name] = cf
+	db.cfByID[cf.id] = cf
+	db.nextCFID++
+	return cf, nil
+}
+
+// 获取列族，不存在时返回nil，对nil列族的操作返回ErrColumnFamilyNotFound
+func (db *DB) CF(name string) *ColumnFamily {
+	if name == secondaryIndexCFName {
+		return nil
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.columnFamilies[name]
+}
+
+// 获取所有列族的名称
+func (db *DB) ColumnFamilies() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var names []string
+	for _, cf := range db.listColumnFamilies() {
+		if cf.name != secondaryIndexCFName {
+			names = append(names, cf.name)
+		}
+	}
+	return names
+}
+
+// 按id排序的列族，调用方需持有db.mu
+func (db *DB) listColumnFamilies() []*ColumnFamily {
+	families := make([]*ColumnFamily, 0, len(db.columnFamilies))
+	for _, cf := range db.columnFamilies {
+		families = append(families, cf)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].id < families[j].id
+	})
+	return families
+}
+
+func (cf *ColumnFamily) Name() string {
+	return cf.name
+}
+
+func (cf *ColumnFamily) Put(key, value []byte) error {
+	if cf == nil {
+		return ErrColumnFamilyNotFound
+	}
+	if cf.id == DefaultCFID {
+		return cf.db.Put(key, value)
+	}
+	if len(key) == 0 {
+		return ErrKeyisEmpty
+	}
+	return cf.write(key, &data.LogRecord{
+		Key:   logRecordWithSeqNo(key, NonTxnSeqNo),
+		Value: value,
+		Type:  data.LogRecordNormal,
+		CF:    cf.id,
+	})
+}
+
+func (cf *ColumnFamily) Get(key []byte) ([]byte, error) {
+	if cf == nil {
+		return nil, ErrColumnFamilyNotFound
+	}
+	if cf.id == DefaultCFID {
+		return cf.db.Get(key)
+	}
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+
+	if cf.db.closed {
+		return nil, ErrDBClosed
+	}
+	if len(key) == 0 {
+		return nil, ErrKeyisEmpty
+	}
+	recordPos := cf.index.Get(key)
+	if recordPos == nil {
+		return nil, ErrKeyNotFound
+	}
+	return cf.db.getValueByPos(recordPos)
+}
+
+func (cf *ColumnFamily) Delete(key []byte) error {
+	if cf == nil {
+		return ErrColumnFamilyNotFound
+	}
+	if cf.id == DefaultCFID {
+		return cf.db.Delete(key)
+	}
+	if len(key) == 0 {
+		return ErrKeyNotFound
+	}
+	if !cf.db.keyExistsWithLock(cf.id, key) {
+		return nil
+	}
+	return cf.write(key, &data.LogRecord{
+		Key:  logRecordWithSeqNo(key, NonTxnSeqNo),
+		Type: data.LogRecordDeleted,
+		CF:   cf.id,
+	})
+}
+
+// 列族不存在时返回nil
+func (cf *ColumnFamily) NewIterator(options IteratorOptions) *Iterator {
+	if cf == nil {
+		return nil
+	}
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+	return cf.db.newIterator(cf.index, cf.id, options)
+}
+
+// 单独merge列族，只清理该列族中失效的记录，其他列族的记录原样保留
+func (cf *ColumnFamily) Merge() error {
+	if cf == nil {
+		return ErrColumnFamilyNotFound
+	}
+	return cf.db.merge(context.Background(), cf)
+}
+
+func (cf *ColumnFamily) write(key []byte, logRecord *data.LogRecord) error {
+	if cf.db.closed {
+		return ErrDBClosed
+	}
+	if cf.db.options.SyncWrite {
+		return cf.db.groupCommit([]*data.LogRecord{logRecord})
+	}
+	return cf.db.appendLogRecordWithLock(key, logRecord)
+}
+
+// 根据日志记录类型更新列族的内存索引
+func (cf *ColumnFamily) updateIndex(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) error {
+	switch typ {
+	case data.LogRecordDeleted:
+		cf.index.Delete(key)
+	case data.LogRecordNormal:
+		if !cf.index.Put(key, pos) {
+			return ErrIndexUpdateFiled
+		}
+	}
+	return nil
+}
+
+// 加载列族信息，默认列族使用DB的索引
+func (db *DB) loadColumnFamilies() error {
+	defaultCF := &ColumnFamily{db: db, id: DefaultCFID, name: DefaultColumnFamily, index: db.index}
+	db.columnFamilies = map[string]*ColumnFamily{DefaultColumnFamily: defaultCF}
+	db.cfByID = map[uint32]*ColumnFamily{DefaultCFID: defaultCF}
+
+	fileName := filepath.Join(db.options.DirPath, data.ColumnFamilyFileName)
+	if ok, err := db.fs.Exists(fileName); err != nil || !ok {
+		return err
+	}
+	cfFile, err := data.OpenColumnFamilyFile(db.fs, fileName)
+	if err != nil {
+		return err
+	}
+	defer cfFile.Close()
+
+	var offset int64
+	for {
+		logRecord, size, err := cfFile.ReadLogRecord(offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ErrDataFileCorrupted
+		}
+		offset += size
+
+		id, n := binary.Uvarint(logRecord.Value)
+		if n <= 0 || n >= len(logRecord.Value) {
+			return ErrDataFileCorrupted
+		}
+		opts := ColumnFamilyOptions{IndexType: index.IndexType(logRecord.Value[n])}
+		cf := &ColumnFamily{
+			db:      db,
+			id:      uint32(id),
+			name:    string(logRecord.Key),
+			options: opts,
+			index:   index.NewIndexer(opts.IndexType),
+		}
+		db.columnFamilies[cf.name] = cf
+		db.cfByID[cf.id] = cf
+		if cf.id >= db.nextCFID {
+			db.nextCFID = cf.id + 1
+		}
+	}
+	return nil
+}
+
+// 将全部列族写入临时文件，持久化之后替换原文件
+func (db *DB) writeColumnFamilies(families []*ColumnFamily) error {
+	fileName := filepath.Join(db.options.DirPath, data.ColumnFamilyFileName)
+	tmpFileName := fileName + ".tmp"
+	if ok, err := db.fs.Exists(tmpFileName); err != nil {
+		return err
+	} else if ok {
+		if err := db.fs.Remove(tmpFileName); err != nil {
+			return err
+		}
+	}
+
+	cfFile, err := data.OpenColumnFamilyFile(db.fs, tmpFileName)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for _, cf := range families {
+		if cf.id == DefaultCFID {
+			continue
+		}
+		value := make([]byte, binary.MaxVarintLen32+1)
+		n := binary.PutUvarint(value, uint64(cf.id))
+		value[n] = byte(cf.options.IndexType)
+		encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+			Key:   []byte(cf.name),
+			Value: value[:n+1],
+		})
+		buf = append(buf, encRecord...)
+	}
+	if err := cfFile.Write(buf); err != nil {
+		_ = cfFile.Close()
+		return err
+	}
+	if err := cfFile.Sync(); err != nil {
+		_ = cfFile.Close()
+		return err
+	}
+	if err := cfFile.Close(); err != nil {
+		return err
+	}
+	return db.fs.Rename(tmpFileName, fileName)
+}
@@ -0,0 +1,341 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bcdb/index"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 列族测试 ====================
+
+func TestCreateColumnFamily(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, "users", users.Name())
+	assert.Equal(t, users, db.CF("users"))
+
+	_, err = db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Equal(t, ErrColumnFamilyExists, err)
+	_, err = db.CreateColumnFamily(DefaultColumnFamily, DefaultColumnFamilyOptions)
+	assert.Equal(t, ErrColumnFamilyExists, err)
+	_, err = db.CreateColumnFamily("", DefaultColumnFamilyOptions)
+	assert.Equal(t, ErrKeyisEmpty, err)
+	_, err = db.CreateColumnFamily("art", ColumnFamilyOptions{IndexType: index.ART})
+	assert.Equal(t, ErrInvalidIndexType, err)
+
+	_, err = db.CreateColumnFamily("sessions", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{DefaultColumnFamily, "users", "sessions"}, db.ColumnFamilies())
+}
+
+func TestColumnFamily_NotFound(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	cf := db.CF("missing")
+	assert.Nil(t, cf)
+	assert.Equal(t, ErrColumnFamilyNotFound, cf.Put([]byte("key"), []byte("value")))
+	_, err = cf.Get([]byte("key"))
+	assert.Equal(t, ErrColumnFamilyNotFound, err)
+	assert.Equal(t, ErrColumnFamilyNotFound, cf.Delete([]byte("key")))
+	assert.Nil(t, cf.NewIterator(DefaultIteratorOptions))
+}
+
+func TestColumnFamily_Isolation(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	sessions, err := db.CreateColumnFamily("sessions", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+
+	// 不同列族中相同的key互不影响
+	assert.Nil(t, db.Put([]byte("id-1"), []byte("default")))
+	assert.Nil(t, users.Put([]byte("id-1"), []byte("user")))
+	assert.Nil(t, sessions.Put([]byte("id-1"), []byte("session")))
+
+	value, err := db.Get([]byte("id-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), value)
+	value, err = users.Get([]byte("id-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("user"), value)
+	value, err = db.CF(DefaultColumnFamily).Get([]byte("id-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), value)
+
+	assert.Nil(t, users.Delete([]byte("id-1")))
+	_, err = users.Get([]byte("id-1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err = sessions.Get([]byte("id-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("session"), value)
+	value, err = db.Get([]byte("id-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), value)
+
+	// 默认列族的ListKeys不包含其他列族的数据
+	assert.Equal(t, 1, len(db.ListKeys()))
+
+	assert.Equal(t, ErrKeyisEmpty, users.Put(nil, []byte("value")))
+	_, err = users.Get(nil)
+	assert.Equal(t, ErrKeyisEmpty, err)
+	assert.Nil(t, users.Delete([]byte("missing")))
+}
+
+func TestColumnFamily_Iterator(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, users.Put([]byte(fmt.Sprintf("user-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("other-%d", i)), []byte("other")))
+	}
+
+	it := users.NewIterator(IteratorOptions{LowerBound: []byte("user-1"), UpperBound: []byte("user-4")})
+	defer it.Close()
+	var values []string
+	for it.ReWind(); it.Valid(); it.Next() {
+		value, err := it.Value()
+		assert.Nil(t, err)
+		values = append(values, string(it.Key())+"="+string(value))
+	}
+	assert.Equal(t, []string{"user-1=value-1", "user-2=value-2", "user-3=value-3"}, values)
+}
+
+func TestColumnFamily_Persistence(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	audit, err := db.CreateColumnFamily("audit", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key-%02d", i))
+		assert.Nil(t, users.Put(key, []byte("user")))
+		assert.Nil(t, audit.Put(key, []byte("audit")))
+		assert.Nil(t, db.Put(key, []byte("default")))
+	}
+	assert.Nil(t, users.Delete([]byte("key-00")))
+	assert.Nil(t, db.Close())
+
+	// 第二次打开时从hint文件加载
+	for i := 0; i < 2; i++ {
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{DefaultColumnFamily, "users", "audit"}, db.ColumnFamilies())
+
+		_, err = db.CF("users").Get([]byte("key-00"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		value, err := db.CF("users").Get([]byte("key-01"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("user"), value)
+		value, err = db.CF("audit").Get([]byte("key-00"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("audit"), value)
+		value, err = db.Get([]byte("key-00"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("default"), value)
+		assert.Equal(t, 50, len(db.ListKeys()))
+		assert.Nil(t, db.Close())
+	}
+
+	// 新创建的列族id不会与已有的列族重复
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	sessions, err := db.CreateColumnFamily("sessions", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), sessions.id)
+	_, err = sessions.Get([]byte("key-01"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestColumnFamily_SyncWrite(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	opts.SyncWrite = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, users.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, users.Put([]byte("b"), []byte("2")))
+	assert.Nil(t, users.Delete([]byte("a")))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = db.CF("users").Get([]byte("a"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.CF("users").Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), value)
+}
+
+// merge时每个列族的数据与各自的索引比较
+func TestColumnFamily_Merge(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 10; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			assert.Nil(t, users.Put(key, []byte(fmt.Sprintf("user-%d", round))))
+			assert.Nil(t, db.Put(key, []byte(fmt.Sprintf("default-%d", round))))
+		}
+	}
+	assert.Nil(t, users.Delete([]byte("key-0")))
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, users.Put([]byte("key-0"), []byte("after-merge")))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	value, err := db.CF("users").Get([]byte("key-0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("after-merge"), value)
+	for i := 1; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		value, err := db.CF("users").Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("user-4"), value)
+		value, err = db.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("default-4"), value)
+	}
+
+	// merge后的数据文件中只保留有效数据
+	var records int
+	for _, file := range db.olderFiles {
+		offset := data.FileHeaderSize
+		for {
+			_, size, err := file.ReadLogRecord(offset)
+			if err != nil {
+				break
+			}
+			records++
+			offset += size
+		}
+	}
+	assert.Equal(t, 19, records)
+}
+
+// 单独merge一个列族，其他列族的记录不受影响
+func TestColumnFamily_MergeSingle(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	sessions, err := db.CreateColumnFamily("sessions", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 10; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			assert.Nil(t, users.Put(key, []byte(fmt.Sprintf("user-%d", round))))
+			assert.Nil(t, sessions.Put(key, []byte(fmt.Sprintf("session-%d", round))))
+		}
+	}
+	// 批量写入的事务记录原样保留，重启后仍然生效
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("batch-1"), []byte("value-1")))
+	assert.Nil(t, wb.Put([]byte("batch-2"), []byte("value-2")))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, sessions.Delete([]byte("key-0")))
+
+	assert.Nil(t, sessions.Merge())
+	assert.Equal(t, ErrColumnFamilyNotFound, db.CF("missing").Merge())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	_, err = db.CF("sessions").Get([]byte("key-0"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		value, err := db.CF("users").Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("user-4"), value)
+		if i > 0 {
+			value, err = db.CF("sessions").Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("session-4"), value)
+		}
+	}
+	value, err := db.Get([]byte("batch-2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value-2"), value)
+
+	// users列族的旧记录和事务记录都保留，sessions列族只保留有效数据
+	counts := make(map[uint32]int)
+	for _, file := range db.olderFiles {
+		offset := data.FileHeaderSize
+		for {
+			logRecord, size, err := file.ReadLogRecord(offset)
+			if err != nil {
+				break
+			}
+			counts[logRecord.CF]++
+			offset += size
+		}
+	}
+	assert.Equal(t, map[uint32]int{DefaultCFID: 3, db.CF("users").id: 50, db.CF("sessions").id: 9}, counts)
+}
+
+func TestColumnFamily_InMemory(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bcdb-cf"
+	opts.InMemory = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, users.Put([]byte("a"), []byte("1")))
+	value, err := users.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
@@ -0,0 +1,81 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bytes"
+	"context"
+)
+
+// 当key的当前值等于old时写入new，old为nil表示key必须不存在，返回是否写入成功
+func (db *DB) CompareAndSwap(key, old, new []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyisEmpty
+	}
+	var swapped bool
+	err := db.writeWithLock(context.Background(), func() error {
+		if db.closed {
+			return ErrDBClosed
+		}
+		ok, err := db.matchValue(key, old)
+		if err != nil || !ok {
+			return err
+		}
+		swapped = true
+		return db.appendWithIndex(key, &data.LogRecord{
+			Key:   logRecordWithSeqNo(key, NonTxnSeqNo),
+			Value: new,
+			Type:  data.LogRecordNormal,
+		})
+	})
+	return swapped, err
+}
+
+// key不存在时写入，返回是否写入成功
+func (db *DB) PutIfAbsent(key, value []byte) (bool, error) {
+	return db.CompareAndSwap(key, nil, value)
+}
+
+// key的当前值等于value时删除，返回是否删除成功，value为nil时与空value相同，不表示key不存在
+func (db *DB) DeleteIfEquals(key, value []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyisEmpty
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	var deleted bool
+	err := db.writeWithLock(context.Background(), func() error {
+		if db.closed {
+			return ErrDBClosed
+		}
+		ok, err := db.matchValue(key, value)
+		if err != nil || !ok {
+			return err
+		}
+		deleted = true
+		return db.appendWithIndex(key, &data.LogRecord{
+			Key:  logRecordWithSeqNo(key, NonTxnSeqNo),
+			Type: data.LogRecordDeleted,
+		})
+	})
+	return deleted, err
+}
+
+// 判断key的当前值是否等于expected，expected为nil时判断key是否不存在，调用方需持有db.mu
+func (db *DB) matchValue(key, expected []byte) (bool, error) {
+	recordPos := db.index.Get(key)
+	if expected == nil {
+		return recordPos == nil, nil
+	}
+	if recordPos == nil {
+		return false, nil
+	}
+	value, err := db.getValue(key, recordPos)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(value, expected), nil
+}
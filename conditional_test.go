@@ -0,0 +1,320 @@
+package bcdb
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 条件写入测试 ====================
+
+func TestCompareAndSwap(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// key不存在时old为nil才能写入
+	ok, err := db.CompareAndSwap([]byte("key"), []byte("v0"), []byte("v1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.CompareAndSwap([]byte("key"), nil, []byte("v1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = db.CompareAndSwap([]byte("key"), []byte("v0"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.CompareAndSwap([]byte("key"), []byte("v1"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+
+	_, err = db.CompareAndSwap(nil, nil, []byte("v"))
+	assert.Equal(t, ErrKeyisEmpty, err)
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	ok, err := db.PutIfAbsent([]byte("key"), []byte("v1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.PutIfAbsent([]byte("key"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+
+	// 删除之后可以再次写入
+	assert.Nil(t, db.Delete([]byte("key")))
+	ok, err = db.PutIfAbsent([]byte("key"), []byte("v3"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestDeleteIfEquals(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	ok, err := db.DeleteIfEquals([]byte("key"), []byte("v1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.Nil(t, db.Put([]byte("key"), []byte("v1")))
+	ok, err = db.DeleteIfEquals([]byte("key"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.DeleteIfEquals([]byte("key"), []byte("v1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	_, err = db.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// nil与空value相同
+	assert.Nil(t, db.Put([]byte("empty"), nil))
+	ok, err = db.DeleteIfEquals([]byte("missing"), nil)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.DeleteIfEquals([]byte("empty"), nil)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestConditional_Closed(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("key"), []byte("v1")))
+	assert.Nil(t, db.Close())
+
+	_, err = db.CompareAndSwap([]byte("key"), []byte("v1"), []byte("v2"))
+	assert.Equal(t, ErrDBClosed, err)
+	_, err = db.DeleteIfEquals([]byte("key"), []byte("v1"))
+	assert.Equal(t, ErrDBClosed, err)
+}
+
+func TestConditional_Persistence(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	_, err = db.PutIfAbsent([]byte("a"), []byte("1"))
+	assert.Nil(t, err)
+	_, err = db.CompareAndSwap([]byte("a"), []byte("1"), []byte("2"))
+	assert.Nil(t, err)
+	_, err = db.PutIfAbsent([]byte("b"), []byte("1"))
+	assert.Nil(t, err)
+	_, err = db.DeleteIfEquals([]byte("b"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	value, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), value)
+	_, err = db.Get([]byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+// 并发使用CompareAndSwap实现计数器，不会丢失更新
+func TestCompareAndSwap_ConcurrentCounter(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("counter"), []byte("0")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for {
+					old, err := db.Get([]byte("counter"))
+					assert.Nil(t, err)
+					n, _ := strconv.Atoi(string(old))
+					ok, err := db.CompareAndSwap([]byte("counter"), old, []byte(strconv.Itoa(n+1)))
+					assert.Nil(t, err)
+					if ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	// 并发的普通写入不会影响计数器
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Put([]byte("other"), []byte(strconv.Itoa(i))))
+		}
+	}()
+	wg.Wait()
+
+	value, err := db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, "400", string(value))
+}
+
+// 多个客户端竞争写入同一个key，只有一个可以成功
+func TestPutIfAbsent_Concurrent(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := db.PutIfAbsent([]byte("leader"), []byte(strconv.Itoa(i)))
+			assert.Nil(t, err)
+			if ok {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, winners)
+}
+
+// ==================== WriteBatch 条件测试 ====================
+
+func TestWriteBatch_Conditions(t *testing.T) {
+	for _, syncWrites := range []bool{false, true} {
+		db, err := Open(testOptions(t))
+		assert.Nil(t, err)
+		defer db.Close()
+		wbOpts := DefaultWriteBatchOptions
+		wbOpts.SyncWrites = syncWrites
+
+		assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+		assert.Nil(t, db.Put([]byte("b"), []byte("1")))
+
+		// 任一条件不满足时整个批次都不会写入
+		wb := db.NewWriteBatch(wbOpts)
+		assert.Nil(t, wb.CompareAndSwap([]byte("a"), []byte("1"), []byte("2")))
+		assert.Nil(t, wb.PutIfAbsent([]byte("b"), []byte("2")))
+		assert.Nil(t, wb.Put([]byte("c"), []byte("1")))
+		assert.Equal(t, ErrConditionFailed, wb.Commit())
+
+		value, err := db.Get([]byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("1"), value)
+		_, err = db.Get([]byte("c"))
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		// 全部条件满足时批次正常写入
+		wb = db.NewWriteBatch(wbOpts)
+		assert.Nil(t, wb.CompareAndSwap([]byte("a"), []byte("1"), []byte("2")))
+		assert.Nil(t, wb.DeleteIfEquals([]byte("b"), []byte("1")))
+		assert.Nil(t, wb.PutIfAbsent([]byte("c"), []byte("1")))
+		assert.Nil(t, wb.Commit())
+
+		value, err = db.Get([]byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("2"), value)
+		_, err = db.Get([]byte("b"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		value, err = db.Get([]byte("c"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("1"), value)
+		assert.Equal(t, 0, len(wb.conditions))
+	}
+}
+
+// 批次已满时条件写入失败，不会留下提交条件
+func TestWriteBatch_ConditionsExceedMaxBatchSize(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("b"), []byte("1")))
+
+	wbOpts := DefaultWriteBatchOptions
+	wbOpts.MaxBatchSize = 1
+	wb := db.NewWriteBatch(wbOpts)
+	assert.Nil(t, wb.Put([]byte("a"), []byte("1")))
+	assert.Equal(t, ErrExceedMaxBatchSize, wb.DeleteIfEquals([]byte("b"), []byte("2")))
+	assert.Equal(t, ErrExceedMaxBatchSize, wb.CompareAndSwap([]byte("b"), []byte("2"), []byte("3")))
+	assert.Equal(t, ErrExceedMaxBatchSize, wb.PutIfAbsent([]byte("b"), []byte("3")))
+	assert.Equal(t, 0, len(wb.conditions))
+	assert.Nil(t, wb.Commit())
+
+	value, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+	value, err = db.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestWriteBatch_Expect(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("leader"), []byte("node-1")))
+
+	// 只有leader才能写入
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Expect([]byte("leader"), []byte("node-2")))
+	assert.Nil(t, wb.Put([]byte("config"), []byte("from-node-2")))
+	assert.Equal(t, ErrConditionFailed, wb.Commit())
+
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Expect([]byte("leader"), []byte("node-1")))
+	assert.Nil(t, wb.Expect([]byte("lock"), nil))
+	assert.Nil(t, wb.Put([]byte("config"), []byte("from-node-1")))
+	assert.Nil(t, wb.Commit())
+
+	value, err := db.Get([]byte("config"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("from-node-1"), value)
+
+	// 只有条件没有写入的批次
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Expect([]byte("leader"), []byte("node-2")))
+	assert.Equal(t, ErrConditionFailed, wb.Commit())
+
+	assert.Equal(t, ErrKeyisEmpty, wb.Expect(nil, nil))
+}
+
+func TestWriteBatch_Conditions_Persistence(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.CompareAndSwap([]byte("a"), []byte("1"), []byte("2")))
+	assert.Nil(t, wb.PutIfAbsent([]byte("b"), []byte("1")))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	value, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), value)
+	value, err = db.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
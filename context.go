@@ -0,0 +1,110 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"context"
+)
+
+// 带有context的接口在等待db.mu以及逐条处理记录时检查是否取消，取消后返回ctx.Err()
+// 已经开始写入的数据不会被中断，保证数据库的状态一致
+
+// 获取db.mu的写锁，等待期间ctx被取消时放弃加锁
+func (db *DB) lockCtx(ctx context.Context) error {
+	return acquireCtx(ctx, db.mu.TryLock, db.mu.Lock, db.mu.Unlock)
+}
+
+// 获取db.mu的读锁，等待期间ctx被取消时放弃加锁
+func (db *DB) rlockCtx(ctx context.Context) error {
+	return acquireCtx(ctx, db.mu.TryRLock, db.mu.RLock, db.mu.RUnlock)
+}
+
+func acquireCtx(ctx context.Context, tryLock func() bool, lock, unlock func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tryLock() {
+		return nil
+	}
+	// 不会被取消的context直接阻塞等待
+	if ctx.Done() == nil {
+		lock()
+		return nil
+	}
+	acquired := make(chan struct{})
+	abandoned := make(chan struct{})
+	go func() {
+		lock()
+		select {
+		case acquired <- struct{}{}:
+		case <-abandoned:
+			// 等待者已经放弃，释放拿到的锁
+			unlock()
+		}
+	}()
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		close(abandoned)
+		return ctx.Err()
+	}
+}
+
+func (db *DB) PutCtx(ctx context.Context, key, value []byte) error {
+	return db.put(ctx, key, value, nil)
+}
+
+func (db *DB) GetCtx(ctx context.Context, key []byte) ([]byte, error) {
+	return db.get(ctx, key)
+}
+
+func (db *DB) DeleteCtx(ctx context.Context, key []byte) error {
+	return db.delete(ctx, key)
+}
+
+// 遍历过程中每条记录之前检查ctx，取消时停止遍历并返回ctx.Err()
+func (db *DB) FoldCtx(ctx context.Context, fn func(key, value []byte) bool) error {
+	return db.fold(ctx, fn)
+}
+
+// merge过程中逐条记录检查ctx，取消时放弃本次merge，已有的数据文件不受影响
+func (db *DB) MergeCtx(ctx context.Context) error {
+	return db.merge(ctx, nil)
+}
+
+func (wb *WriteBatch) CommitCtx(ctx context.Context) error {
+	return wb.commit(ctx)
+}
+
+// ctx被取消后迭代器不再有效，可以通过Err获取取消原因
+func (db *DB) NewIteratorCtx(ctx context.Context, options IteratorOptions) *Iterator {
+	it := db.NewIterator(options)
+	it.ctx = ctx
+	return it
+}
+
+// 写入日志记录并更新内存索引，等待db.mu期间可以被取消
+func (db *DB) appendLogRecordWithLockCtx(ctx context.Context, key []byte, logRecord *data.LogRecord) error {
+	return db.writeWithLock(ctx, func() error {
+		return db.appendWithIndex(key, logRecord)
+	})
+}
+
+// 持有db.mu执行写入并淘汰超出磁盘预算的key，释放锁之后调用afterWrite
+// 不经过组提交的写入都通过该函数完成
+func (db *DB) writeWithLock(ctx context.Context, write func() error) error {
+	if err := db.lockCtx(ctx); err != nil {
+		return err
+	}
+	err := write()
+	var evicted [][]byte
+	if err == nil {
+		evicted, err = db.evictOverBudget()
+	}
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	db.afterWrite(evicted)
+	return nil
+}
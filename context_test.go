@@ -0,0 +1,207 @@
+package bcdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== context测试 ====================
+
+// 调用Err超过指定次数后返回取消错误
+type countdownCtx struct {
+	context.Context
+	remaining int
+}
+
+func (c *countdownCtx) Err() error {
+	if c.remaining <= 0 {
+		return context.Canceled
+	}
+	c.remaining--
+	return nil
+}
+
+func TestContext_Canceled(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, db.PutCtx(ctx, []byte("other"), []byte("value")))
+	_, err = db.GetCtx(ctx, []byte("key"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, db.DeleteCtx(ctx, []byte("key")))
+	assert.Equal(t, context.Canceled, db.FoldCtx(ctx, func(key, value []byte) bool { return true }))
+	assert.Equal(t, context.Canceled, db.MergeCtx(ctx))
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("batch"), []byte("value")))
+	assert.Equal(t, context.Canceled, wb.CommitCtx(ctx))
+
+	// 取消的操作不会写入数据，未提交的批次可以重新提交
+	assert.Equal(t, [][]byte{[]byte("key")}, db.ListKeys())
+	assert.Nil(t, wb.CommitCtx(context.Background()))
+	value, err := db.GetCtx(context.Background(), []byte("batch"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestContext_GroupCommitCanceled(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncWrite = true
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, db.PutCtx(ctx, []byte("key"), []byte("value")))
+	wb := db.NewWriteBatch(WriteBatchOptions{MaxBatchSize: 10, SyncWrites: true})
+	assert.Nil(t, wb.Put([]byte("batch"), []byte("value")))
+	assert.Equal(t, context.Canceled, wb.CommitCtx(ctx))
+	assert.Empty(t, db.ListKeys())
+
+	assert.Nil(t, db.PutCtx(context.Background(), []byte("key"), []byte("value")))
+	assert.Equal(t, [][]byte{[]byte("key")}, db.ListKeys())
+}
+
+// 等待db.mu时超时返回，锁不会被泄漏
+func TestContext_LockTimeout(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+
+	db.mu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = db.GetCtx(ctx, []byte("key"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, context.DeadlineExceeded, db.PutCtx(ctx, []byte("key"), []byte("new")))
+	assert.Equal(t, context.DeadlineExceeded, db.FoldCtx(ctx, func(key, value []byte) bool { return true }))
+	db.mu.Unlock()
+
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, db.Put([]byte("key"), []byte("new")))
+
+	// 等待期间锁被释放时正常获取
+	db.mu.Lock()
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- db.PutCtx(ctx, []byte("key"), []byte("waited"))
+	}()
+	time.Sleep(10 * time.Millisecond)
+	db.mu.Unlock()
+	assert.Nil(t, <-done)
+	value, err = db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("waited"), value)
+}
+
+func TestContext_FoldCanceled(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte("value")))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var visited int
+	err = db.FoldCtx(ctx, func(key, value []byte) bool {
+		visited++
+		if visited == 5 {
+			cancel()
+		}
+		return true
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 5, visited)
+}
+
+func TestContext_IteratorCanceled(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte("value")))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it := db.NewIteratorCtx(ctx, DefaultIteratorOptions)
+	defer it.Close()
+	var visited int
+	for it.ReWind(); it.Valid(); it.Next() {
+		_, err := it.Value()
+		assert.Nil(t, err)
+		visited++
+		if visited == 3 {
+			cancel()
+		}
+	}
+	assert.Equal(t, 3, visited)
+	assert.Equal(t, context.Canceled, it.Err())
+	_, err = it.Value()
+	assert.Equal(t, context.Canceled, err)
+
+	it2 := db.NewIterator(DefaultIteratorOptions)
+	defer it2.Close()
+	assert.Nil(t, it2.Err())
+}
+
+// merge中途取消后数据保持不变，之后可以重新merge
+func TestContext_MergeCanceled(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i%20)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	ctx := &countdownCtx{Context: context.Background(), remaining: 50}
+	assert.Equal(t, context.Canceled, db.MergeCtx(ctx))
+	assert.False(t, db.isMerge)
+	for i := 0; i < 20; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%d", 180+i)), value)
+	}
+	assert.Nil(t, db.Close())
+
+	// 未完成的merge目录在重启时被清理
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	exists, err := db.fs.Exists(db.getMergePath())
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, 20, len(db.ListKeys()))
+
+	assert.Nil(t, db.MergeCtx(context.Background()))
+	for i := 0; i < 20; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%d", 180+i)), value)
+	}
+}
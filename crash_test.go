@@ -0,0 +1,262 @@
+package bcdb
+
+import (
+	"bcdb/fio"
+	"bcdb/vfs"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 崩溃一致性测试 ====================
+
+type crashOpType int8
+
+const (
+	crashOpPut crashOpType = iota
+	crashOpDelete
+	crashOpBatch
+	crashOpMerge
+)
+
+type crashOp struct {
+	typ   crashOpType
+	key   string
+	value string
+	batch []*crashOp // 批量写入中的操作，按顺序生效
+}
+
+// 生成随机的工作负载
+func genCrashWorkload(r *rand.Rand, n int) []*crashOp {
+	randPut := func(i int) *crashOp {
+		return &crashOp{typ: crashOpPut, key: fmt.Sprintf("key-%d", r.Intn(20)), value: fmt.Sprintf("value-%d-%d", i, r.Intn(1000))}
+	}
+	randDelete := func() *crashOp {
+		return &crashOp{typ: crashOpDelete, key: fmt.Sprintf("key-%d", r.Intn(20))}
+	}
+
+	ops := make([]*crashOp, 0, n)
+	for i := 0; i < n; i++ {
+		switch p := r.Intn(100); {
+		case p < 55:
+			ops = append(ops, randPut(i))
+		case p < 75:
+			ops = append(ops, randDelete())
+		case p < 95:
+			op := &crashOp{typ: crashOpBatch}
+			for j := 0; j < 1+r.Intn(5); j++ {
+				if r.Intn(3) == 0 {
+					op.batch = append(op.batch, randDelete())
+				} else {
+					op.batch = append(op.batch, randPut(i))
+				}
+			}
+			ops = append(ops, op)
+		default:
+			ops = append(ops, &crashOp{typ: crashOpMerge})
+		}
+	}
+	return ops
+}
+
+// 在模型上应用一个操作
+func (op *crashOp) apply(model map[string]string) map[string]string {
+	next := make(map[string]string, len(model))
+	for k, v := range model {
+		next[k] = v
+	}
+	ops := []*crashOp{op}
+	if op.typ == crashOpBatch {
+		ops = op.batch
+	}
+	for _, o := range ops {
+		switch o.typ {
+		case crashOpPut:
+			next[o.key] = o.value
+		case crashOpDelete:
+			delete(next, o.key)
+		}
+	}
+	return next
+}
+
+// 在数据库上执行一个操作
+func (op *crashOp) run(db *DB) error {
+	switch op.typ {
+	case crashOpPut:
+		return db.Put([]byte(op.key), []byte(op.value))
+	case crashOpDelete:
+		return db.Delete([]byte(op.key))
+	case crashOpBatch:
+		wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+		for _, o := range op.batch {
+			var err error
+			if o.typ == crashOpPut {
+				err = wb.Put([]byte(o.key), []byte(o.value))
+			} else {
+				err = wb.Delete([]byte(o.key))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return wb.Commit()
+	default:
+		return db.Merge()
+	}
+}
+
+func crashTestOptions(fs vfs.FS) Options {
+	opts := DefaultOptions
+	opts.DirPath = "/bcdb-crash"
+	opts.MaxFileSize = 512
+	opts.SyncWrite = true
+	opts.FS = fs
+	return opts
+}
+
+// 读取数据库中的全部数据
+func dumpDB(t *testing.T, db *DB) map[string]string {
+	state := make(map[string]string)
+	assert.Nil(t, db.Fold(func(key, value []byte) bool {
+		state[string(key)] = string(value)
+		return true
+	}))
+	return state
+}
+
+// 执行工作负载直到出现错误，返回崩溃前已确认的数据，以及可能生效也可能未生效的数据
+func runCrashWorkload(t *testing.T, fs vfs.FS, ops []*crashOp, maxOps int) (committed, uncertain map[string]string) {
+	db, err := Open(crashTestOptions(fs))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	committed = make(map[string]string)
+	for i, op := range ops {
+		if i == maxOps {
+			break
+		}
+		if err := op.run(db); err != nil {
+			if op.typ == crashOpMerge {
+				return committed, nil
+			}
+			return committed, op.apply(committed)
+		}
+		committed = op.apply(committed)
+	}
+	return committed, nil
+}
+
+// 崩溃后重新打开数据库，检查数据是否与模型一致
+func checkAfterCrash(t *testing.T, memFS vfs.FS, committed, uncertain map[string]string, desc string) {
+	db, err := Open(crashTestOptions(memFS))
+	if !assert.Nil(t, err, desc) {
+		return
+	}
+	state := dumpDB(t, db)
+	if uncertain == nil {
+		assert.Equal(t, committed, state, desc)
+	} else if !assert.ObjectsAreEqual(committed, state) {
+		assert.Equal(t, uncertain, state, desc)
+	}
+
+	// 恢复之后可以继续写入、merge并再次打开
+	assert.Nil(t, db.Put([]byte("after-crash"), []byte("value")), desc)
+	state["after-crash"] = "value"
+	assert.Nil(t, db.Merge(), desc)
+	assert.Nil(t, db.Close(), desc)
+
+	db, err = Open(crashTestOptions(memFS))
+	if !assert.Nil(t, err, desc) {
+		return
+	}
+	defer db.Close()
+	assert.Equal(t, state, dumpDB(t, db), desc)
+}
+
+// 在每一次写入、持久化、读取操作上注入故障，崩溃后检查已提交的数据不会丢失
+func TestCrash_InjectedFaults(t *testing.T) {
+	ops := genCrashWorkload(rand.New(rand.NewSource(1)), 150)
+
+	// 先执行一次不注入故障的工作负载，统计各类操作的次数
+	injector := fio.NewFaultInjector()
+	runCrashWorkload(t, vfs.NewFaultFS(vfs.NewMemFS(), injector), ops, len(ops))
+	counts := map[fio.FaultOp]int{
+		fio.FaultWrite: injector.Count(fio.FaultWrite),
+		fio.FaultSync:  injector.Count(fio.FaultSync),
+		fio.FaultRead:  injector.Count(fio.FaultRead),
+	}
+	opNames := map[fio.FaultOp]string{fio.FaultWrite: "write", fio.FaultSync: "sync", fio.FaultRead: "read"}
+
+	for op, count := range counts {
+		for n := 1; n <= count; n++ {
+			memFS := vfs.NewMemFS()
+			injector := fio.NewFaultInjector()
+			injector.FailAt(op, n)
+			injector.SetShortWrite(n%2 == 0)
+			faultFS := vfs.NewFaultFS(memFS, injector)
+
+			committed, uncertain := runCrashWorkload(t, faultFS, ops, len(ops))
+			if n%3 == 0 {
+				assert.Nil(t, faultFS.CrashWithTornWrites(rand.New(rand.NewSource(int64(n)))))
+			} else {
+				assert.Nil(t, faultFS.Crash())
+			}
+			checkAfterCrash(t, memFS, committed, uncertain, fmt.Sprintf("fail %s #%d", opNames[op], n))
+			if t.Failed() {
+				return
+			}
+		}
+	}
+}
+
+// 在工作负载的每一步之后崩溃，并随机保留部分未持久化的数据
+func TestCrash_EveryStep(t *testing.T) {
+	ops := genCrashWorkload(rand.New(rand.NewSource(2)), 150)
+
+	for step := 0; step <= len(ops); step++ {
+		memFS := vfs.NewMemFS()
+		faultFS := vfs.NewFaultFS(memFS, fio.NewFaultInjector())
+
+		committed, _ := runCrashWorkload(t, faultFS, ops, step)
+		assert.Nil(t, faultFS.CrashWithTornWrites(rand.New(rand.NewSource(int64(step)))))
+		checkAfterCrash(t, memFS, committed, nil, fmt.Sprintf("crash after step %d", step))
+		if t.Failed() {
+			return
+		}
+	}
+}
+
+// 打开数据库应用merge结果时在每一次重命名上崩溃，再次打开后已提交的数据不会丢失
+func TestCrash_MergeApply(t *testing.T) {
+	ops := append(genCrashWorkload(rand.New(rand.NewSource(3)), 100), &crashOp{typ: crashOpMerge})
+
+	// 统计应用merge结果时的重命名次数
+	memFS := vfs.NewMemFS()
+	runCrashWorkload(t, vfs.NewFaultFS(memFS, fio.NewFaultInjector()), ops, len(ops))
+	injector := fio.NewFaultInjector()
+	db, err := Open(crashTestOptions(vfs.NewFaultFS(memFS, injector)))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	count := injector.Count(fio.FaultRename)
+	assert.Greater(t, count, 2)
+
+	for n := 1; n <= count; n++ {
+		memFS := vfs.NewMemFS()
+		committed, _ := runCrashWorkload(t, vfs.NewFaultFS(memFS, fio.NewFaultInjector()), ops, len(ops))
+
+		injector := fio.NewFaultInjector()
+		injector.FailAt(fio.FaultRename, n)
+		faultFS := vfs.NewFaultFS(memFS, injector)
+		_, err := Open(crashTestOptions(faultFS))
+		assert.Equal(t, fio.ErrInjectedFault, err)
+		assert.Nil(t, faultFS.Crash())
+
+		checkAfterCrash(t, memFS, committed, nil, fmt.Sprintf("fail rename #%d", n))
+		if t.Failed() {
+			return
+		}
+	}
+}
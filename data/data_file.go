@@ -2,47 +2,68 @@ package data
 
 import (
 	"bcdb/fio"
+	"bcdb/vfs"
 	"fmt"
 	"hash/crc32"
 	"io"
-	"path"
 	"path/filepath"
 )
 
 const (
 	DataFileSuffix        = ".data"
-	HintFileName          = "hint-index"
+	HintFileSuffix        = ".hint"
+	BlobFileSuffix        = ".blob"
 	MergeFinishedFileName = "merge-finished"
+	MergeAppliedFileName  = "merge-applied" // 原目录中的旧文件已经删除，只剩移动merge文件
+	ColumnFamilyFileName  = "column-families"
 )
 
 type DataFile struct {
 	Fid         uint32
 	WriteOffset int64 // Offset of the next write operation
 	IOManager   fio.IOManager
+	Header      *FileHeader // 数据文件、hint文件和merge完成标识文件的文件头
 }
 
 // 打开一个数据文件
-func OpenDataFile(dirPath string, fid uint32) (*DataFile, error) {
-	fileName := filepath.Join(dirPath, fmt.Sprintf("%09d", fid)+DataFileSuffix)
-	return newDataFile(fileName, fid)
+func OpenDataFile(fs vfs.FS, dirPath string, fid uint32) (*DataFile, error) {
+	return newDataFileWithHeader(fs, GetDataFileName(dirPath, fid), fid, FileFlagData)
 }
 
 func GetDataFileName(dirPath string, fid uint32) string {
 	return filepath.Join(dirPath, fmt.Sprintf("%09d", fid)+DataFileSuffix)
 }
 
-func OpenHintFile(dirPath string) (*DataFile, error) {
-	fileName := path.Join(dirPath, HintFileName)
-	return newDataFile(fileName, 0)
+func GetHintFileName(dirPath string, fid uint32) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", fid)+HintFileSuffix)
 }
 
-func OpenMergeFinishedFile(dirPath string) (*DataFile, error) {
+// 打开数据文件对应的hint文件
+func OpenHintFile(fs vfs.FS, dirPath string, fid uint32) (*DataFile, error) {
+	return newDataFileWithHeader(fs, GetHintFileName(dirPath, fid), fid, FileFlagHint)
+}
+
+func GetBlobFileName(dirPath string, blobID uint32) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", blobID)+BlobFileSuffix)
+}
+
+// 打开存储单个大value的blob文件
+func OpenBlobFile(fs vfs.FS, dirPath string, blobID uint32) (*DataFile, error) {
+	return newDataFile(fs, GetBlobFileName(dirPath, blobID), blobID)
+}
+
+func OpenMergeFinishedFile(fs vfs.FS, dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, MergeFinishedFileName)
-	return newDataFile(fileName, 0)
+	return newDataFileWithHeader(fs, fileName, 0, FileFlagMergeFinished)
 }
 
-func newDataFile(fileName string, fid uint32) (*DataFile, error) {
-	ioManager, err := fio.NewIOManager(fileName)
+// 打开保存列族信息的文件
+func OpenColumnFamilyFile(fs vfs.FS, fileName string) (*DataFile, error) {
+	return newDataFile(fs, fileName, 0)
+}
+
+func newDataFile(fs vfs.FS, fileName string, fid uint32) (*DataFile, error) {
+	ioManager, err := fs.OpenFile(fileName)
 	if err != nil {
 		return nil, err
 	}
@@ -53,8 +74,25 @@ func newDataFile(fileName string, fid uint32) (*DataFile, error) {
 	}, nil
 }
 
+func newDataFileWithHeader(fs vfs.FS, fileName string, fid uint32, flags uint16) (*DataFile, error) {
+	dataFile, err := newDataFile(fs, fileName, fid)
+	if err != nil {
+		return nil, err
+	}
+	if err := dataFile.loadFileHeader(flags); err != nil {
+		_ = dataFile.Close()
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return dataFile, nil
+}
+
 // 根据数据偏移读取数据
 func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
+	return df.ReadLogRecordBuf(offset, nil)
+}
+
+// 读取日志记录，容量足够时key和value复用buf的空间
+func (df *DataFile) ReadLogRecordBuf(offset int64, buf []byte) (*LogRecord, int64, error) {
 	fileSize, err := df.IOManager.Size()
 	if err != nil {
 		return nil, 0, err
@@ -78,24 +116,37 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 		return nil, 0, io.EOF
 	}
 	// 获取keySize和valueSize
-	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
-	recordSize := headerSize + keySize + valueSize
+	keySize, valueSize, metaSize := int64(header.keySize), int64(header.valueSize), int64(header.metaSize)
+	recordSize := headerSize + keySize + valueSize + metaSize
+	// 记录不完整，通常是写入过程中发生了崩溃
+	if offset+recordSize > fileSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
 
-	logRecord := &LogRecord{Type: header.recordType}
-	// 读取key和value
-	if keySize > 0 || valueSize > 0 {
-		kvBuf, err := df.readNBytes(keySize+valueSize, offset+headerSize)
+	logRecord := &LogRecord{Type: header.recordType, CF: header.cf, Version: header.version}
+	// 读取key、value和元数据
+	if bodySize := keySize + valueSize + metaSize; bodySize > 0 {
+		var kvBuf []byte
+		if int64(cap(buf)) >= bodySize {
+			kvBuf = buf[:bodySize]
+			_, err = df.IOManager.Read(kvBuf, offset+headerSize)
+		} else {
+			kvBuf, err = df.readNBytes(bodySize, offset+headerSize)
+		}
 		if err != nil {
 			return nil, 0, err
 		}
 		logRecord.Key = kvBuf[:keySize]
-		logRecord.Value = kvBuf[keySize:]
+		logRecord.Value = kvBuf[keySize : keySize+valueSize]
+		if metaSize > 0 {
+			logRecord.Meta = kvBuf[keySize+valueSize:]
+		}
 	}
 
-	// 校验数据的crc
+	// 校验数据的crc，同时返回记录长度，便于调用方判断损坏的记录是否位于文件末尾
 	crc := getLogRecordCRC(logRecord, headerBuf[crc32.Size:headerSize])
 	if crc != header.crc {
-		return nil, 0, ErrInvaildCRC
+		return nil, recordSize, ErrInvaildCRC
 	}
 	return logRecord, recordSize, nil
 }
@@ -107,6 +158,12 @@ func (df *DataFile) Sync() error {
 func (df *DataFile) Write(buf []byte) error {
 	n, err := df.IOManager.Write(buf)
 	if err != nil {
+		// 截断写入了一部分的数据，保证后续写入的位置正确
+		if n > 0 {
+			if truncErr := df.IOManager.Truncate(df.WriteOffset); truncErr != nil {
+				df.WriteOffset += int64(n)
+			}
+		}
 		return err
 	}
 	// 更新写入DataFile的offset
@@ -114,13 +171,25 @@ func (df *DataFile) Write(buf []byte) error {
 	return nil
 }
 
-func (df *DataFile) WriteHintRecord(key []byte, pos *LogRecordPos) error {
-	record := &LogRecord{
-		Key:   key,
-		Value: EncodeLogRecordPos(pos),
+// 读取hint文件中的全部记录，文件不完整或者与数据文件大小不一致时返回false
+func (df *DataFile) ReadHintRecords(dataSize int64) ([]*HintRecord, bool) {
+	var hints []*HintRecord
+	offset := FileHeaderSize
+	for {
+		logRecord, size, err := df.ReadLogRecord(offset)
+		if err != nil {
+			return nil, false
+		}
+		offset += size
+		pos := DecodeLogRecordPos(logRecord.Value)
+		if logRecord.Type == LogRecordHintFin {
+			if pos.Fid != df.Fid || pos.Offset != dataSize {
+				return nil, false
+			}
+			return hints, true
+		}
+		hints = append(hints, &HintRecord{Key: logRecord.Key, Type: logRecord.Type, Pos: pos, CF: logRecord.CF, Version: logRecord.Version})
 	}
-	encRecord, _ := EncodeLogRecord(record)
-	return df.Write(encRecord)
 }
 
 func (df *DataFile) Close() error {
@@ -132,3 +201,8 @@ func (df *DataFile) readNBytes(n, offset int64) (buf []byte, err error) {
 	_, err = df.IOManager.Read(buf, offset)
 	return
 }
+
+// 打开迁移时写入的临时文件，写入指定类型的文件头
+func OpenMigrateFile(fs vfs.FS, fileName string, flags uint16) (*DataFile, error) {
+	return newDataFileWithHeader(fs, fileName, 0, flags)
+}
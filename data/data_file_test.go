@@ -1,21 +1,21 @@
 package data
 
 import (
+	"bcdb/vfs"
 	"os"
-	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDataFileOpen(t *testing.T) {
-	dataFile, err := OpenDataFile("./", 0)
+	dataFile, err := OpenDataFile(vfs.Default, "./", 0)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 }
 
 func TestDataFileWrite(t *testing.T) {
-	dataFile, err := OpenDataFile("./", 0)
+	dataFile, err := OpenDataFile(vfs.Default, "./", 0)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -24,7 +24,10 @@ func TestDataFileWrite(t *testing.T) {
 }
 
 func TestDataFile_LoadLogRecord(t *testing.T) {
-	file, err := OpenDataFile(os.TempDir(), 22)
+	fileName := GetDataFileName(os.TempDir(), 22)
+	_ = os.Remove(fileName)
+	defer os.Remove(fileName)
+	file, err := OpenDataFile(vfs.Default, os.TempDir(), 22)
 	assert.Nil(t, err)
 	assert.NotNil(t, file)
 
@@ -38,9 +41,165 @@ func TestDataFile_LoadLogRecord(t *testing.T) {
 	err = file.Write(encLog)
 	assert.Nil(t, err)
 
-	rec2, size, err := file.ReadLogRecord(0)
+	rec2, size, err := file.ReadLogRecord(FileHeaderSize)
 	assert.Nil(t, err)
 	assert.Equal(t, rec1, rec2)
 	assert.Equal(t, logSize, size)
-	os.Remove(filepath.Join(os.TempDir(), "000000022", DataFileSuffix))
+}
+
+func TestDataFile_LogRecordWithCF(t *testing.T) {
+	file, err := OpenDataFile(vfs.NewMemFS(), "/", 1)
+	assert.Nil(t, err)
+
+	records := []*LogRecord{
+		{Key: []byte("default"), Value: []byte("v1"), Type: LogRecordNormal},
+		{Key: []byte("users"), Value: []byte("v2"), Type: LogRecordNormal, CF: 1},
+		{Key: []byte("sessions"), Type: LogRecordDeleted, CF: 300},
+	}
+	var offsets []int64
+	for _, rec := range records {
+		encLog, _ := EncodeLogRecord(rec)
+		offsets = append(offsets, file.WriteOffset)
+		assert.Nil(t, file.Write(encLog))
+	}
+
+	for i, rec := range records {
+		readRec, _, err := file.ReadLogRecord(offsets[i])
+		assert.Nil(t, err)
+		assert.Equal(t, rec.Key, readRec.Key)
+		assert.Equal(t, rec.Type, readRec.Type)
+		assert.Equal(t, rec.CF, readRec.CF)
+	}
+
+	// 默认列族的记录格式不变
+	encLog, _ := EncodeLogRecord(records[0])
+	assert.Equal(t, byte(LogRecordNormal), encLog[4])
+}
+
+func TestHintRecord_CF(t *testing.T) {
+	file, err := OpenHintFile(vfs.NewMemFS(), "/", 3)
+	assert.Nil(t, err)
+	hint := &HintRecord{Key: []byte("key"), Type: LogRecordNormal, Pos: &LogRecordPos{Fid: 3, Offset: 10}, CF: 2}
+	assert.Nil(t, file.Write(EncodeHintRecord(hint)))
+	assert.Nil(t, file.Write(EncodeHintFinRecord(3, 100)))
+
+	hints, ok := file.ReadHintRecords(100)
+	assert.True(t, ok)
+	assert.Equal(t, []*HintRecord{hint}, hints)
+}
+
+func TestDataFile_LogRecordWithVersion(t *testing.T) {
+	file, err := OpenDataFile(vfs.NewMemFS(), "/", 1)
+	assert.Nil(t, err)
+
+	records := []*LogRecord{
+		{Key: []byte("plain"), Value: []byte("v1"), Type: LogRecordNormal},
+		{Key: []byte("versioned"), Value: []byte("v2"), Type: LogRecordNormal, Version: RecordVersion{Seq: 1, Timestamp: 1700000000000000000}},
+		{Key: []byte("both"), Type: LogRecordDeleted, CF: 3, Version: RecordVersion{Seq: 1 << 40, Timestamp: -1}},
+	}
+	var offsets []int64
+	for _, rec := range records {
+		encLog, _ := EncodeLogRecord(rec)
+		offsets = append(offsets, file.WriteOffset)
+		assert.Nil(t, file.Write(encLog))
+	}
+
+	for i, rec := range records {
+		readRec, _, err := file.ReadLogRecord(offsets[i])
+		assert.Nil(t, err)
+		assert.Equal(t, rec.Key, readRec.Key)
+		assert.Equal(t, rec.Type, readRec.Type)
+		assert.Equal(t, rec.CF, readRec.CF)
+		assert.Equal(t, rec.Version, readRec.Version)
+	}
+
+	// 没有版本的记录格式不变
+	encLog, _ := EncodeLogRecord(records[0])
+	assert.Equal(t, byte(LogRecordNormal), encLog[4])
+}
+
+func TestHintRecord_Version(t *testing.T) {
+	file, err := OpenHintFile(vfs.NewMemFS(), "/", 3)
+	assert.Nil(t, err)
+	hint := &HintRecord{
+		Key:     []byte("key"),
+		Type:    LogRecordMergeOperand,
+		Pos:     &LogRecordPos{Fid: 3, Offset: 10},
+		Version: RecordVersion{Seq: 42, Timestamp: 1700000000000000000},
+	}
+	assert.Nil(t, file.Write(EncodeHintRecord(hint)))
+	assert.Nil(t, file.Write(EncodeHintFinRecord(3, 100)))
+
+	hints, ok := file.ReadHintRecords(100)
+	assert.True(t, ok)
+	assert.Equal(t, []*HintRecord{hint}, hints)
+}
+
+func TestDataFile_LogRecordWithMeta(t *testing.T) {
+	file, err := OpenDataFile(vfs.NewMemFS(), "/", 1)
+	assert.Nil(t, err)
+
+	records := []*LogRecord{
+		{Key: []byte("timestamp"), Value: []byte("v1"), Version: RecordVersion{Timestamp: 1700000000000000000}},
+		{Key: []byte("meta"), Value: []byte("v2"), Meta: []byte("content-type=json"), Version: RecordVersion{Timestamp: 1}},
+		{Key: []byte("all"), Value: []byte("v3"), CF: 2, Meta: []byte{0}, Version: RecordVersion{Seq: 9, Timestamp: 2}},
+		{Key: []byte("empty"), Meta: []byte("only-meta")},
+	}
+	var offsets []int64
+	for _, rec := range records {
+		encLog, _ := EncodeLogRecord(rec)
+		offsets = append(offsets, file.WriteOffset)
+		assert.Nil(t, file.Write(encLog))
+	}
+
+	for i, rec := range records {
+		readRec, _, err := file.ReadLogRecord(offsets[i])
+		assert.Nil(t, err)
+		assert.Equal(t, rec.Key, readRec.Key)
+		assert.Equal(t, rec.Version, readRec.Version)
+		assert.Equal(t, rec.Meta, readRec.Meta)
+		assert.Equal(t, rec.CF, readRec.CF)
+		if len(rec.Value) > 0 {
+			assert.Equal(t, rec.Value, readRec.Value)
+		} else {
+			assert.Equal(t, 0, len(readRec.Value))
+		}
+	}
+
+	// 复用缓冲区读取
+	buf := make([]byte, 0, 64)
+	readRec, _, err := file.ReadLogRecordBuf(offsets[1], buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), readRec.Value)
+	assert.Equal(t, []byte("content-type=json"), readRec.Meta)
+}
+
+// 元数据也在crc校验范围内
+func TestDataFile_LogRecordMetaCRC(t *testing.T) {
+	fs := vfs.NewMemFS()
+	encLog, _ := EncodeLogRecord(&LogRecord{Key: []byte("key"), Value: []byte("value"), Meta: []byte("meta")})
+	encLog[len(encLog)-1] ^= 0xff
+	file, err := OpenDataFile(fs, "/", 1)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Write(encLog))
+
+	_, _, err = file.ReadLogRecord(FileHeaderSize)
+	assert.Equal(t, ErrInvaildCRC, err)
+}
+
+func TestHintRecord_Timestamp(t *testing.T) {
+	file, err := OpenHintFile(vfs.NewMemFS(), "/", 3)
+	assert.Nil(t, err)
+	hint := &HintRecord{
+		Key:     []byte("key"),
+		Type:    LogRecordNormal,
+		Pos:     &LogRecordPos{Fid: 3, Offset: 10},
+		Version: RecordVersion{Timestamp: 1700000000000000000},
+	}
+	assert.Nil(t, file.Write(EncodeHintRecord(hint)))
+	assert.Nil(t, file.Write(EncodeHintFinRecord(3, 100)))
+
+	hints, ok := file.ReadHintRecords(100)
+	assert.True(t, ok)
+	assert.Equal(t, []*HintRecord{hint}, hints)
 }
@@ -47,3 +47,13 @@ func TestGetLogCRC(t *testing.T) {
 	crc := getLogRecordCRC(rec1, bytes)
 	t.Log(crc)
 }
+
+func TestEncodeLogRecordPos_Size(t *testing.T) {
+	pos := &LogRecordPos{Fid: 3, Offset: 1024, Size: 57}
+	assert.Equal(t, pos, DecodeLogRecordPos(EncodeLogRecordPos(pos)))
+
+	// 没有记录大小时与旧版本的编码相同
+	legacy := &LogRecordPos{Fid: 3, Offset: 1024}
+	assert.Equal(t, 3, len(EncodeLogRecordPos(legacy)))
+	assert.Equal(t, legacy, DecodeLogRecordPos(EncodeLogRecordPos(legacy)))
+}
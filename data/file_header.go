@@ -0,0 +1,110 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// 文件头：magic|version|flags|ctime|crc
+const (
+	FileMagic            = "BCDB"
+	FileHeaderSize int64 = 20
+	// 当前的文件格式版本，版本1为没有文件头的旧格式
+	FormatVersion uint16 = 2
+)
+
+// 文件头中的flags标识文件类型
+const (
+	FileFlagData          uint16 = 0
+	FileFlagHint          uint16 = 1
+	FileFlagMergeFinished uint16 = 2
+)
+
+var (
+	ErrLegacyFormat             = errors.New("file has no header, run `bcdb migrate` to upgrade the directory")
+	ErrUnsupportedFormatVersion = errors.New("unsupported file format version")
+	ErrInvalidFileHeader        = errors.New("invalid file header")
+)
+
+type FileHeader struct {
+	Version   uint16
+	Flags     uint16
+	CreatedAt int64 // UnixNano
+}
+
+func EncodeFileHeader(header *FileHeader) []byte {
+	buf := make([]byte, FileHeaderSize)
+	copy(buf[:4], FileMagic)
+	binary.LittleEndian.PutUint16(buf[4:6], header.Version)
+	binary.LittleEndian.PutUint16(buf[6:8], header.Flags)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(header.CreatedAt))
+	binary.LittleEndian.PutUint32(buf[16:], crc32.ChecksumIEEE(buf[:16]))
+	return buf
+}
+
+// 解析文件头，没有magic时返回ErrLegacyFormat
+func DecodeFileHeader(buf []byte) (*FileHeader, error) {
+	if len(buf) < len(FileMagic) || !bytes.Equal(buf[:4], []byte(FileMagic)) {
+		return nil, ErrLegacyFormat
+	}
+	if int64(len(buf)) < FileHeaderSize || binary.LittleEndian.Uint32(buf[16:FileHeaderSize]) != crc32.ChecksumIEEE(buf[:16]) {
+		return nil, ErrInvalidFileHeader
+	}
+	header := &FileHeader{
+		Version:   binary.LittleEndian.Uint16(buf[4:6]),
+		Flags:     binary.LittleEndian.Uint16(buf[6:8]),
+		CreatedAt: int64(binary.LittleEndian.Uint64(buf[8:16])),
+	}
+	if header.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedFormatVersion, header.Version)
+	}
+	return header, nil
+}
+
+// 新文件写入文件头，已有的文件校验文件头，之后的记录从FileHeaderSize开始
+func (df *DataFile) loadFileHeader(flags uint16) error {
+	size, err := df.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	if size > 0 && size < FileHeaderSize {
+		buf, err := df.readNBytes(size, 0)
+		if err != nil {
+			return err
+		}
+		// 创建文件时崩溃，文件头没有写完整
+		if !bytes.HasPrefix([]byte(FileMagic), buf[:min(len(buf), len(FileMagic))]) {
+			return ErrLegacyFormat
+		}
+		if err := df.IOManager.Truncate(0); err != nil {
+			return err
+		}
+		size = 0
+	}
+	if size == 0 {
+		df.Header = &FileHeader{Version: FormatVersion, Flags: flags, CreatedAt: time.Now().UnixNano()}
+		if err := df.Write(EncodeFileHeader(df.Header)); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	buf, err := df.readNBytes(FileHeaderSize, 0)
+	if err != nil {
+		return err
+	}
+	header, err := DecodeFileHeader(buf)
+	if err != nil {
+		return err
+	}
+	if header.Flags != flags {
+		return ErrInvalidFileHeader
+	}
+	df.Header = header
+	df.WriteOffset = FileHeaderSize
+	return nil
+}
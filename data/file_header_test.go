@@ -0,0 +1,104 @@
+package data
+
+import (
+	"bcdb/vfs"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileHeader_EncodeDecode(t *testing.T) {
+	header := &FileHeader{Version: FormatVersion, Flags: FileFlagHint, CreatedAt: 1700000000000000000}
+	buf := EncodeFileHeader(header)
+	assert.Equal(t, FileHeaderSize, int64(len(buf)))
+	assert.Equal(t, []byte(FileMagic), buf[:4])
+
+	decoded, err := DecodeFileHeader(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, header, decoded)
+
+	// 没有magic的旧格式文件
+	rec, _ := EncodeLogRecord(&LogRecord{Key: []byte("key"), Value: []byte("value")})
+	_, err = DecodeFileHeader(rec)
+	assert.Equal(t, ErrLegacyFormat, err)
+
+	// 文件头损坏
+	corrupted := append([]byte(nil), buf...)
+	corrupted[10] ^= 0xff
+	_, err = DecodeFileHeader(corrupted)
+	assert.Equal(t, ErrInvalidFileHeader, err)
+
+	// 未知的版本
+	future := append([]byte(nil), buf...)
+	binary.LittleEndian.PutUint16(future[4:6], FormatVersion+1)
+	binary.LittleEndian.PutUint32(future[16:], crc32.ChecksumIEEE(future[:16]))
+	_, err = DecodeFileHeader(future)
+	assert.ErrorIs(t, err, ErrUnsupportedFormatVersion)
+	assert.Contains(t, err.Error(), "3")
+}
+
+func TestDataFile_Header(t *testing.T) {
+	fs := vfs.NewMemFS()
+	file, err := OpenDataFile(fs, "/", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, FileHeaderSize, file.WriteOffset)
+	assert.Equal(t, FormatVersion, file.Header.Version)
+	assert.Equal(t, FileFlagData, file.Header.Flags)
+
+	rec := &LogRecord{Key: []byte("key"), Value: []byte("value")}
+	encLog, _ := EncodeLogRecord(rec)
+	assert.Nil(t, file.Write(encLog))
+	assert.Nil(t, file.Close())
+
+	// 重新打开时读取已有的文件头
+	file, err = OpenDataFile(fs, "/", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, FileHeaderSize, file.WriteOffset)
+	readRec, _, err := file.ReadLogRecord(FileHeaderSize)
+	assert.Nil(t, err)
+	assert.Equal(t, rec.Key, readRec.Key)
+	createdAt := file.Header.CreatedAt
+	assert.Nil(t, file.Close())
+	file, err = OpenDataFile(fs, "/", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, createdAt, file.Header.CreatedAt)
+	assert.Nil(t, file.Close())
+
+	// 文件类型不匹配
+	assert.Nil(t, fs.Rename(GetDataFileName("/", 1), GetHintFileName("/", 1)))
+	_, err = OpenHintFile(fs, "/", 1)
+	assert.ErrorIs(t, err, ErrInvalidFileHeader)
+}
+
+func TestDataFile_LegacyFile(t *testing.T) {
+	fs := vfs.NewMemFS()
+	file, err := fs.OpenFile(GetDataFileName("/", 0))
+	assert.Nil(t, err)
+	encLog, _ := EncodeLogRecord(&LogRecord{Key: []byte("key"), Value: []byte("value")})
+	_, err = file.Write(encLog)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	_, err = OpenDataFile(fs, "/", 0)
+	assert.ErrorIs(t, err, ErrLegacyFormat)
+	assert.Contains(t, err.Error(), "000000000.data")
+}
+
+// 创建文件时崩溃留下不完整的文件头，打开时重新写入
+func TestDataFile_PartialHeader(t *testing.T) {
+	fs := vfs.NewMemFS()
+	file, err := fs.OpenFile(GetDataFileName("/", 0))
+	assert.Nil(t, err)
+	_, err = file.Write(EncodeFileHeader(&FileHeader{Version: FormatVersion})[:7])
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	dataFile, err := OpenDataFile(fs, "/", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, FileHeaderSize, dataFile.WriteOffset)
+	size, err := dataFile.IOManager.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, FileHeaderSize, size)
+}
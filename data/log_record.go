@@ -12,29 +12,76 @@ const (
 	LogRecordNormal LogRecordType = iota
 	LogRecordDeleted
 	LogRecordTxnFin
+	LogRecordHintFin      // hint文件的结束标识
+	LogRecordBlob         // value存储在单独的blob文件中，记录中只保存blob的引用
+	LogRecordMergeOperand // 合并操作数，读取时通过MergeOperator合并到已有的value上
+	LogRecordRangeDeleted // 范围删除标识，key中保存删除范围的起止位置
 )
 
-// Header: crc|type|keysize|valuesize
-const MaxLogRecordHeaderSize = binary.MaxVarintLen32*2 + 5
+// Header: crc|type|[cf]|[version]|[timestamp]|keysize|valuesize|[metasize]
+const MaxLogRecordHeaderSize = binary.MaxVarintLen32*4 + binary.MaxVarintLen64*2 + 5
+
+// type的最高位表示header中带有列族id，默认列族的记录不写入列族id
+const logRecordCFFlag = 0x80
+
+// type的次高位表示header中带有版本号和写入时间，未开启多版本时不写入
+const logRecordVersionFlag = 0x40
+
+// header中只带有写入时间，没有版本号
+const logRecordTimestampFlag = 0x20
+
+// 记录带有用户元数据，header中存储元数据长度，元数据在value之后
+const logRecordMetaFlag = 0x10
+
+const logRecordFlags = logRecordCFFlag | logRecordVersionFlag | logRecordTimestampFlag | logRecordMetaFlag
 
 var ErrInvaildCRC = errors.New("invalid crc value")
 
 type LogRecordPos struct {
 	Fid    uint32 // 标识文件
 	Offset int64  // 标识偏移量
+	Size   uint32 // 记录占用的字节数，旧版本hint文件中没有记录时为0
 }
 
 type LogRecord struct {
-	Key   []byte
-	Value []byte
-	Type  LogRecordType //墓碑标识
+	Key     []byte
+	Value   []byte
+	Type    LogRecordType //墓碑标识
+	CF      uint32        // 列族id，0表示默认列族
+	Version RecordVersion
+	Meta    []byte // 用户元数据
+}
+
+// 记录的版本号和写入时间，Seq为0表示没有记录版本，Timestamp为0表示旧数据没有写入时间
+type RecordVersion struct {
+	Seq       uint64
+	Timestamp int64 // UnixNano
 }
 
 type logRecordHeader struct {
 	crc        uint32
 	recordType LogRecordType
+	cf         uint32
+	version    RecordVersion
 	keySize    uint32
 	valueSize  uint32
+	metaSize   uint32
+}
+
+// hint文件中的一条记录，对应数据文件中的一条日志记录
+type HintRecord struct {
+	Key     []byte // 带有事务序列号的key
+	Type    LogRecordType
+	Pos     *LogRecordPos
+	CF      uint32
+	Version RecordVersion
+}
+
+// 分离存储的value在blob文件中的引用
+type BlobRef struct {
+	ID   uint32 // blob文件id
+	Size int64  // value大小
+	CRC  uint32 // value的crc校验值
 }
 
 type TransactionRecord struct { // 暂存的事务数据
@@ -43,17 +90,34 @@ type TransactionRecord struct { // 暂存的事务数据
 }
 
 // 对记录进行编码
-// logRecord: crc|type|keysize|valuesize|key|value
+// logRecord: crc|type|[cf]|[version]|[timestamp]|keysize|valuesize|[metasize]|key|value|[meta]
 func EncodeLogRecord(lr *LogRecord) ([]byte, int64) {
 	header := make([]byte, MaxLogRecordHeaderSize)
 	// 第5个字节 logRecordType
 	header[4] = byte(lr.Type)
-	// 开始存储keySize和valueSize
 	var index int = 5
+	// 非默认列族的记录在type之后存储列族id
+	if lr.CF != 0 {
+		header[4] |= logRecordCFFlag
+		index += binary.PutUvarint(header[index:], uint64(lr.CF))
+	}
+	if lr.Version.Seq != 0 {
+		header[4] |= logRecordVersionFlag
+		index += binary.PutUvarint(header[index:], lr.Version.Seq)
+		index += binary.PutVarint(header[index:], lr.Version.Timestamp)
+	} else if lr.Version.Timestamp != 0 {
+		header[4] |= logRecordTimestampFlag
+		index += binary.PutVarint(header[index:], lr.Version.Timestamp)
+	}
+	// 开始存储keySize和valueSize
 	index += binary.PutVarint(header[index:], int64(len(lr.Key)))
 	index += binary.PutVarint(header[index:], int64(len(lr.Value)))
+	if len(lr.Meta) > 0 {
+		header[4] |= logRecordMetaFlag
+		index += binary.PutVarint(header[index:], int64(len(lr.Meta)))
+	}
 
-	var logSize = index + len(lr.Key) + len(lr.Value)
+	var logSize = index + len(lr.Key) + len(lr.Value) + len(lr.Meta)
 
 	encBytes := make([]byte, logSize)
 	// 拷贝header数据到起始位置
@@ -62,6 +126,7 @@ func EncodeLogRecord(lr *LogRecord) ([]byte, int64) {
 	// 拷贝key和alue
 	copy(encBytes[index:], lr.Key)
 	copy(encBytes[index+len(lr.Key):], lr.Value)
+	copy(encBytes[index+len(lr.Key)+len(lr.Value):], lr.Meta)
 
 	// 执行crc校验
 	crc := crc32.ChecksumIEEE(encBytes[4:])
@@ -76,16 +141,52 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	}
 	header := &logRecordHeader{
 		crc:        binary.LittleEndian.Uint32(buf[:4]),
-		recordType: LogRecordType(buf[4]),
+		recordType: LogRecordType(buf[4] &^ logRecordFlags),
 	}
 	// 获取数据
 	index := 5
+	if buf[4]&logRecordCFFlag != 0 {
+		cf, n := binary.Uvarint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.cf = uint32(cf)
+		index += n
+	}
+	if buf[4]&logRecordVersionFlag != 0 {
+		seq, n := binary.Uvarint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		index += n
+		timestamp, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		index += n
+		header.version = RecordVersion{Seq: seq, Timestamp: timestamp}
+	} else if buf[4]&logRecordTimestampFlag != 0 {
+		timestamp, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		index += n
+		header.version = RecordVersion{Timestamp: timestamp}
+	}
 	keySize, n := binary.Varint(buf[index:])
 	header.keySize = uint32(keySize)
 	index += n
 	valueSize, n := binary.Varint(buf[index:])
 	header.valueSize = uint32(valueSize)
 	index += n
+	if buf[4]&logRecordMetaFlag != 0 {
+		metaSize, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.metaSize = uint32(metaSize)
+		index += n
+	}
 
 	return header, int64(index)
 }
@@ -97,14 +198,19 @@ func getLogRecordCRC(lr *LogRecord, header []byte) uint32 {
 	crc := crc32.ChecksumIEEE(header[:])
 	crc = crc32.Update(crc, crc32.IEEETable, lr.Key)
 	crc = crc32.Update(crc, crc32.IEEETable, lr.Value)
+	crc = crc32.Update(crc, crc32.IEEETable, lr.Meta)
 	return crc
 }
 
 func EncodeLogRecordPos(pos *LogRecordPos) []byte {
-	buf := make([]byte, binary.MaxVarintLen32+binary.MaxVarintLen64)
+	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64)
 	var index = 0
 	index += binary.PutVarint(buf[index:], int64(pos.Fid))
 	index += binary.PutVarint(buf[index:], pos.Offset)
+	// 记录大小为0时不写入，与旧版本的编码相同
+	if pos.Size > 0 {
+		index += binary.PutUvarint(buf[index:], uint64(pos.Size))
+	}
 	return buf[:index]
 }
 
@@ -112,10 +218,56 @@ func DecodeLogRecordPos(buf []byte) *LogRecordPos {
 	var index = 0
 	fid, n := binary.Varint(buf[index:])
 	index += n
-	offset, _ := binary.Varint(buf[index:])
+	offset, n := binary.Varint(buf[index:])
+	index += n
+	size, _ := binary.Uvarint(buf[index:])
 	return &LogRecordPos{
 		Fid:    uint32(fid),
 		Offset: offset,
+		Size:   uint32(size),
 	}
 
 }
+
+// 对hint记录进行编码，value部分存储日志记录的位置
+func EncodeHintRecord(hint *HintRecord) []byte {
+	encRecord, _ := EncodeLogRecord(&LogRecord{
+		Key:     hint.Key,
+		Value:   EncodeLogRecordPos(hint.Pos),
+		Type:    hint.Type,
+		CF:      hint.CF,
+		Version: hint.Version,
+	})
+	return encRecord
+}
+
+// 编码hint文件的结束标识，记录对应数据文件的fid和大小
+func EncodeHintFinRecord(fid uint32, dataSize int64) []byte {
+	encRecord, _ := EncodeLogRecord(&LogRecord{
+		Value: EncodeLogRecordPos(&LogRecordPos{Fid: fid, Offset: dataSize}),
+		Type:  LogRecordHintFin,
+	})
+	return encRecord
+}
+
+func EncodeBlobRef(ref *BlobRef) []byte {
+	buf := make([]byte, binary.MaxVarintLen32+binary.MaxVarintLen64+4)
+	var index = 0
+	index += binary.PutVarint(buf[index:], int64(ref.ID))
+	index += binary.PutVarint(buf[index:], ref.Size)
+	binary.LittleEndian.PutUint32(buf[index:], ref.CRC)
+	return buf[:index+4]
+}
+
+func DecodeBlobRef(buf []byte) *BlobRef {
+	var index = 0
+	id, n := binary.Varint(buf[index:])
+	index += n
+	size, n := binary.Varint(buf[index:])
+	index += n
+	return &BlobRef{
+		ID:   uint32(id),
+		Size: size,
+		CRC:  binary.LittleEndian.Uint32(buf[index:]),
+	}
+}
@@ -3,45 +3,118 @@ package bcdb
 import (
 	"bcdb/data"
 	"bcdb/index"
+	"bcdb/metrics"
+	"bcdb/vfs"
+	"context"
 	"io"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // 面向用户的操作接口
 type DB struct {
 	options    Options
-	fidList    []int // 文件ID列表，加载索引时使用
+	fs         vfs.FS // 数据目录所在的文件系统
+	fidList    []int  // 文件ID列表，加载索引时使用
 	mu         *sync.RWMutex
 	activeFile *data.DataFile
 	olderFiles map[uint32]*data.DataFile
 	index      index.Indexer // 内存索引结构，例如BTree
 	seqNo      uint64        // 事务的序列号,全局递增
 	closed     bool
-	isMerge    bool // 是否正在合并
+	isMerge    bool   // 是否正在合并
+	hintBuf    []byte // 活跃文件中记录对应的hint数据，文件关闭时写入hint文件
+	bytesWrite uint   // 活跃文件上次持久化之后写入的字节数
+
+	nextBlobID   uint32              // 下一个blob文件的id
+	pendingBlobs map[uint32]struct{} // 正在写入的blob文件
+	blobSizes    map[uint32]int64    // 每个blob文件的大小，未设置MaxDiskBytes时为nil
+
+	operands map[string]*operandChain // 存在合并操作数的key，按写入顺序记录操作数的位置
+
+	columnFamilies map[string]*ColumnFamily // 列族名称到列族的映射，包含默认列族
+	cfByID         map[uint32]*ColumnFamily
+	nextCFID       uint32 // 下一个列族的id
+
+	secondaryIndexes map[string]IndexExtractor // 已注册的二级索引
+
+	versions     map[string][]*keyVersion // 开启多版本时每个key按写入顺序保存的版本
+	versionSeq   uint64                   // 最新分配的版本号
+	lastTxnSeqNo uint64                   // 最近一次分配版本号的事务，同一个事务的记录共用版本号
+	lastVersion  data.RecordVersion
+
+	metrics *metrics.Metrics // 为nil时不统计监控指标
+	cache   *valueCache      // 为nil时不缓存value
+	logger  *slog.Logger
+	events  EventListener
+
+	eviction       *evictionTracker // 未设置MaxDiskBytes时为nil
+	evictMergeSize int64            // 上一次merge之后无法回收的磁盘空间
+	budgetMerge    bool             // 是否已经在后台触发了merge
+
+	mergeGen uint64 // merge直接替换数据文件的次数，用于判断迭代器是否失效
+
+	commitCh  chan *commitRequest // 组提交的写入请求
+	closeCh   chan struct{}       // 关闭时通知后台协程退出
+	closeOnce *sync.Once
+	bgWg      *sync.WaitGroup // 等待后台协程退出
 }
 
-func Open(options Options) (*DB, error) {
+func Open(options Options) (_ *DB, err error) {
 	// 校验配置项
 	if err := checkOptions(options); err != nil {
 		return nil, err
 	}
+	if options.BlobThreshold == 0 {
+		options.BlobThreshold = DefaultOptions.BlobThreshold
+	}
+	start := time.Now()
+	logger := optionsLogger(options)
+	logger.Info("opening database", "dir", options.DirPath)
+	defer func() {
+		if err != nil {
+			logger.Error("open database failed", "dir", options.DirPath, "error", err)
+		}
+	}()
+	fs := optionsFS(options)
 	// 创建数据目录
-	if _, err := os.Stat(options.DirPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(options.DirPath, os.ModePerm); err != nil {
+	if ok, err := fs.Exists(options.DirPath); err != nil {
+		return nil, err
+	} else if !ok {
+		if err := fs.MkdirAll(options.DirPath); err != nil {
 			return nil, err
 		}
 	}
 
 	db := &DB{
-		options:    options,
-		mu:         new(sync.RWMutex),
-		olderFiles: make(map[uint32]*data.DataFile),
-		index:      index.NewIndexer(options.IndexType),
+		options:          options,
+		fs:               fs,
+		mu:               new(sync.RWMutex),
+		olderFiles:       make(map[uint32]*data.DataFile),
+		index:            index.NewIndexer(options.IndexType),
+		pendingBlobs:     make(map[uint32]struct{}),
+		operands:         make(map[string]*operandChain),
+		nextCFID:         1,
+		secondaryIndexes: make(map[string]IndexExtractor),
+		versions:         make(map[string][]*keyVersion),
+		metrics:          options.Metrics,
+		logger:           logger,
+		events:           optionsEventListener(options),
+		commitCh:         make(chan *commitRequest),
+		closeCh:          make(chan struct{}),
+		closeOnce:        new(sync.Once),
+		bgWg:             new(sync.WaitGroup),
+	}
+
+	if options.MaxDiskBytes > 0 {
+		db.eviction = newEvictionTracker()
+		db.blobSizes = make(map[uint32]int64)
 	}
 
 	// 加载merge目录
@@ -49,49 +122,98 @@ func Open(options Options) (*DB, error) {
 		return nil, err
 	}
 
+	// 加载列族，重放数据之前需要知道每个列族的索引
+	if err := db.loadColumnFamilies(); err != nil {
+		return nil, err
+	}
+
 	// 加载数据文件
 	if err := db.loadDataFiles(); err != nil {
 		return nil, err
 	}
-	// 从hint文件中加载索引
-	if err := db.loadIndexFromHintFile(); err != nil {
+	// 加载blob文件
+	if err := db.loadBlobFiles(); err != nil {
 		return nil, err
 	}
-
 	// 加载内存索引
+	loadStart := time.Now()
 	if err := db.loadIndexFromDataFiles(); err != nil {
 		return nil, err
 	}
+	db.notifyIndexLoaded(time.Since(loadStart), db.index.Size())
+	// 索引加载完成之后再开启缓存，加载过程中不需要维护缓存
+	if options.CacheSize > 0 {
+		db.cache = newValueCache(options.CacheSize)
+	}
+
+	if db.metrics != nil {
+		db.metrics.IndexSize.Set(func() float64 {
+			db.mu.RLock()
+			defer db.mu.RUnlock()
+			return float64(db.index.Size())
+		})
+	}
+
+	// 启动组提交协程
+	db.bgWg.Add(1)
+	go db.runGroupCommit()
+	// 启动定期持久化协程
+	if options.SyncInterval > 0 {
+		db.bgWg.Add(1)
+		go db.runPeriodicSync()
+	}
+	// 调小MaxDiskBytes之后重新打开时立即淘汰
+	if err := db.writeWithLock(context.Background(), func() error { return nil }); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	logger.Info("database opened", "dir", options.DirPath, "duration", time.Since(start))
 	return db, nil
 }
 
 func (db *DB) Put(key, value []byte) error {
+	return db.put(context.Background(), key, value, nil)
+}
+
+func (db *DB) put(ctx context.Context, key, value, meta []byte) error {
+	if m := db.metrics; m != nil {
+		defer m.PutDuration.ObserveSince(time.Now())
+	}
 	if len(key) == 0 {
 		return ErrKeyisEmpty
 	}
 	if db.closed {
 		return ErrDBClosed
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	logRecord := &data.LogRecord{
 		Key:   logRecordWithSeqNo(key, NonTxnSeqNo),
 		Value: value,
 		Type:  data.LogRecordNormal,
+		Meta:  meta,
 	}
-
-	recordPos, err := db.appendLogRecordWithLock(logRecord)
-	if err != nil {
-		return err
-	}
-	// 更新内存索引
-	if ok := db.index.Put(key, recordPos); !ok {
-		return ErrIndexUpdateFiled
+	// 同步写入时通过组提交合并并发写入的持久化操作
+	if db.options.SyncWrite {
+		return db.groupCommitRecordCtx(ctx, key, logRecord)
 	}
-	return nil
+
+	return db.appendLogRecordWithLockCtx(ctx, key, logRecord)
 }
 
 func (db *DB) Get(key []byte) ([]byte, error) {
+	return db.get(context.Background(), key)
+}
+
+func (db *DB) get(ctx context.Context, key []byte) ([]byte, error) {
+	if m := db.metrics; m != nil {
+		defer m.GetDuration.ObserveSince(time.Now())
+	}
 	// 加锁
-	db.mu.RLock()
+	if err := db.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
 	defer db.mu.RUnlock()
 
 	if db.closed {
@@ -108,10 +230,54 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 		return nil, ErrKeyNotFound
 	}
 
+	value, err := db.getValue(key, recordPos)
+	if err == nil {
+		db.touchEviction(key)
+	}
+	return value, err
+}
+
+// 读取key的value，存在合并操作数时合并到基础value上，调用方需持有db.mu
+func (db *DB) getValue(key []byte, recordPos *data.LogRecordPos) ([]byte, error) {
+	if chain := db.operands[string(key)]; chain != nil {
+		return db.mergeOperands(key, chain)
+	}
 	return db.getValueByPos(recordPos)
 }
 
 func (db *DB) getValueByPos(recordPos *data.LogRecordPos) ([]byte, error) {
+	if db.cache != nil {
+		if value, ok := db.cache.get(*recordPos); ok {
+			return value, nil
+		}
+	}
+	logRecord, err := db.getLogRecordByPos(recordPos)
+	if err != nil {
+		return nil, err
+	}
+	value := logRecord.Value
+	switch logRecord.Type {
+	// 判断logRecord是否已被删除
+	case data.LogRecordDeleted:
+		return nil, ErrKeyNotFound
+	// value分离存储在blob文件中
+	case data.LogRecordBlob:
+		if value, err = db.readBlobValue(data.DecodeBlobRef(logRecord.Value)); err != nil {
+			return nil, err
+		}
+	}
+	if db.cache != nil {
+		db.cache.add(*recordPos, value)
+	}
+	return value, nil
+}
+
+func (db *DB) getLogRecordByPos(recordPos *data.LogRecordPos) (*data.LogRecord, error) {
+	return db.readLogRecord(recordPos, nil)
+}
+
+// 根据位置读取日志记录，容量足够时复用buf
+func (db *DB) readLogRecord(recordPos *data.LogRecordPos, buf []byte) (*data.LogRecord, error) {
 	// 根据recordPos找到文件以及数据位置
 	var dataFile *data.DataFile
 
@@ -126,41 +292,53 @@ func (db *DB) getValueByPos(recordPos *data.LogRecordPos) ([]byte, error) {
 	}
 
 	// 根据数据偏移读取数据
-	logRecord, _, err := dataFile.ReadLogRecord(recordPos.Offset)
+	logRecord, size, err := dataFile.ReadLogRecordBuf(recordPos.Offset, buf)
 	if err != nil {
 		return nil, err
 	}
-	// 判断logRecord是否已被删除
-	if logRecord.Type == data.LogRecordDeleted {
-		return nil, ErrKeyNotFound
+	if db.metrics != nil {
+		db.metrics.BytesRead.Add(uint64(size))
 	}
-	return logRecord.Value, nil
-
+	return logRecord, nil
 }
 
 func (db *DB) Delete(key []byte) error {
+	return db.delete(context.Background(), key)
+}
+
+func (db *DB) delete(ctx context.Context, key []byte) error {
+	if m := db.metrics; m != nil {
+		defer m.DeleteDuration.ObserveSince(time.Now())
+	}
 	if len(key) == 0 {
 		return ErrKeyNotFound
 	}
 	if db.closed {
 		return ErrDBClosed
 	}
-	if pos := db.index.Get(key); pos == nil {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !db.keyExistsWithLock(DefaultCFID, key) {
 		return nil
 	}
 	logRecord := &data.LogRecord{
 		Key:  logRecordWithSeqNo(key, NonTxnSeqNo),
 		Type: data.LogRecordDeleted,
 	}
-	_, err := db.appendLogRecordWithLock(logRecord)
-	if err != nil {
-		return err
-	}
-	// 从内存索引中删除数据
-	if ok := db.index.Delete(key); !ok {
-		return ErrIndexUpdateFiled
+	if db.options.SyncWrite {
+		return db.groupCommitRecordCtx(ctx, key, logRecord)
 	}
-	return nil
+	return db.appendLogRecordWithLockCtx(ctx, key, logRecord)
+}
+
+// 在读锁内判断key是否存在，merge直接替换数据文件时会替换索引
+func (db *DB) keyExistsWithLock(cf uint32, key []byte) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	family := db.cfByID[cf]
+	return family != nil && family.index.Get(key) != nil
 }
 
 // 获取数据库中所有的key
@@ -183,7 +361,13 @@ func (db *DB) ListKeys() [][]byte {
 
 // 获取所有数据，执行特定的操作
 func (db *DB) Fold(fn func(key, value []byte) bool) error {
-	db.mu.RLock()
+	return db.fold(context.Background(), fn)
+}
+
+func (db *DB) fold(ctx context.Context, fn func(key, value []byte) bool) error {
+	if err := db.rlockCtx(ctx); err != nil {
+		return err
+	}
 	defer db.mu.RUnlock()
 
 	if db.closed {
@@ -191,7 +375,10 @@ func (db *DB) Fold(fn func(key, value []byte) bool) error {
 	}
 	iter := db.index.Iterator(db.options.Reverse)
 	for iter.ReWind(); iter.Valid(); iter.Next() {
-		value, err := db.getValueByPos(iter.Value())
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		value, err := db.getValue(iter.Key(), iter.Value())
 		if err != nil {
 			return err
 		}
@@ -203,11 +390,21 @@ func (db *DB) Fold(fn func(key, value []byte) bool) error {
 }
 
 func (db *DB) Close() error {
+	// 通知后台协程退出并等待，在锁内通知，之后不会再启动新的后台协程
+	db.mu.Lock()
+	db.closeOnce.Do(func() {
+		close(db.closeCh)
+	})
+	db.mu.Unlock()
+	db.bgWg.Wait()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	if db.activeFile == nil {
+		db.closed = true
 		return nil
 	}
-	db.mu.Lock()
-	defer db.mu.Unlock()
 
 	if err := db.activeFile.Close(); err != nil {
 		return err
@@ -219,8 +416,10 @@ func (db *DB) Close() error {
 		}
 	}
 	db.activeFile = nil
-	db.activeFile = nil
 	db.closed = true
+	if db.metrics != nil {
+		db.metrics.IndexSize.Set(nil)
+	}
 	return nil
 }
 
@@ -235,56 +434,326 @@ func (db *DB) Sync() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	return db.activeFile.Sync()
+	return db.syncActiveFile()
 }
 
-func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// 持久化活跃文件，并重置累计写入的字节数
+func (db *DB) syncActiveFile() error {
+	if m := db.metrics; m != nil {
+		m.Fsyncs.Inc()
+		defer m.FsyncDuration.ObserveSince(time.Now())
+	}
+	if err := db.activeFile.Sync(); err != nil {
+		db.notifySyncError(err)
+		return err
+	}
+	db.bytesWrite = 0
+	return nil
+}
 
-	return db.appendLogRecord(logRecord)
+// 定期持久化协程，每隔SyncInterval持久化一次有新写入的活跃文件
+func (db *DB) runPeriodicSync() {
+	defer db.bgWg.Done()
+	ticker := time.NewTicker(db.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			db.mu.Lock()
+			if !db.closed && db.activeFile != nil && db.bytesWrite > 0 {
+				// 持久化失败时保留累计字节数，下一次继续尝试
+				_ = db.syncActiveFile()
+			}
+			db.mu.Unlock()
+		case <-db.closeCh:
+			return
+		}
+	}
+}
+
+// 写入日志记录，并在同一把锁内更新内存索引，避免与条件写入交错
+func (db *DB) appendLogRecordWithLock(key []byte, logRecord *data.LogRecord) error {
+	return db.appendLogRecordWithLockCtx(context.Background(), key, logRecord)
+}
+
+// 写入日志记录并更新内存索引，调用方需持有db.mu
+func (db *DB) appendWithIndex(key []byte, logRecord *data.LogRecord) error {
+	// 存在二级索引时，数据和索引在同一个事务中写入
+	if db.needsSecondaryIndexes(logRecord) {
+		return db.appendWithSecondaryIndexes([]*data.LogRecord{{Key: key, Value: logRecord.Value, Type: logRecord.Type, Meta: logRecord.Meta}}, false)
+	}
+	recordPos, err := db.appendLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+	return db.updateIndex(logRecord.CF, key, logRecord.Type, recordPos, logRecord.Version)
+}
+
+// 根据日志记录类型更新内存索引，调用方需持有db.mu
+func (db *DB) updateIndex(cf uint32, key []byte, typ data.LogRecordType, pos *data.LogRecordPos, ver data.RecordVersion) error {
+	if db.cache != nil {
+		db.invalidateCache(cf, key, typ)
+	}
+	if cf != DefaultCFID {
+		if family := db.cfByID[cf]; family != nil {
+			return family.updateIndex(key, typ, pos)
+		}
+		return nil
+	}
+	if ver.Seq > db.versionSeq {
+		db.versionSeq = ver.Seq
+	}
+	if typ == data.LogRecordRangeDeleted {
+		start, end := decodeRangeKey(key)
+		for _, deleted := range db.index.DeleteRange(start, end) {
+			delete(db.operands, string(deleted))
+			db.addVersion(deleted, data.LogRecordDeleted, pos, ver)
+			if db.eviction != nil {
+				db.eviction.remove(deleted)
+			}
+		}
+		return nil
+	}
+	db.addVersion(key, typ, pos, ver)
+	if db.eviction != nil {
+		db.trackEviction(key, typ, pos)
+	}
+
+	switch typ {
+	case data.LogRecordDeleted:
+		db.index.Delete(key)
+		delete(db.operands, string(key))
+		return nil
+	case data.LogRecordMergeOperand:
+		// 索引指向最新的操作数，第一个操作数之前的记录作为合并的基础value
+		chain := db.operands[string(key)]
+		if chain == nil {
+			chain = &operandChain{base: db.index.Get(key)}
+			db.operands[string(key)] = chain
+		}
+		chain.operands = append(chain.operands, pos)
+	default:
+		delete(db.operands, string(key))
+	}
+	if !db.index.Put(key, pos) {
+		return ErrIndexUpdateFiled
+	}
+	return nil
 }
 
 func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	positions, err := db.appendLogRecords([]*data.LogRecord{logRecord})
+	if err != nil {
+		return nil, err
+	}
+	// 如果开启了同步写入，持久化数据到磁盘
+	if db.options.SyncWrite {
+		if err := db.syncActiveFile(); err != nil {
+			return nil, err
+		}
+	}
+	return positions[0], nil
+}
 
+// 批量写入日志记录，同一个数据文件中的记录通过一次Write写入
+func (db *DB) appendLogRecords(logRecords []*data.LogRecord) ([]*data.LogRecordPos, error) {
 	if db.activeFile == nil {
 		if err := db.setActiveFile(); err != nil {
 			return nil, err
 		}
 	}
 
-	// 对记录进行编码
-	encodedRecord, recordLen := data.EncodeLogRecord(logRecord)
-	// 如果写入文件达到了活跃文件的阈值，关闭当前活跃文件，构造新的活跃文件
-	if db.activeFile.WriteOffset+recordLen > db.options.MaxFileSize {
-		// 持久化当前活跃文件数据到磁盘当中
-		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
+	var buf, hintBuf []byte
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
 		}
-		// 将当前文件放入旧的数据文件中
-		db.olderFiles[db.activeFile.Fid] = db.activeFile
-		// 构造新的数据文件
-		if err := db.setActiveFile(); err != nil {
-			return nil, err
+		if err := db.activeFile.Write(buf); err != nil {
+			return err
+		}
+		db.bytesWrite += uint(len(buf))
+		if db.metrics != nil {
+			db.metrics.BytesWritten.Add(uint64(len(buf)))
 		}
+		// 写入成功后才记录对应的hint数据
+		db.hintBuf = append(db.hintBuf, hintBuf...)
+		buf, hintBuf = buf[:0], hintBuf[:0]
+		return nil
 	}
-	// 写入数据
+
+	positions := make([]*data.LogRecordPos, len(logRecords))
 	writeOffset := db.activeFile.WriteOffset
-	if err := db.activeFile.Write(encodedRecord); err != nil {
+	for i, logRecord := range logRecords {
+		db.stampVersion(logRecord)
+		// 对记录进行编码
+		encodedRecord, recordLen := data.EncodeLogRecord(logRecord)
+		// 如果写入文件达到了活跃文件的阈值，关闭当前活跃文件，构造新的活跃文件
+		if writeOffset+recordLen > db.options.MaxFileSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if err := db.rotateActiveFile(); err != nil {
+				return nil, err
+			}
+			writeOffset = db.activeFile.WriteOffset
+		}
+		// 返回索引信息
+		positions[i] = &data.LogRecordPos{
+			Fid:    db.activeFile.Fid,
+			Offset: writeOffset,
+			Size:   uint32(recordLen),
+		}
+		buf = append(buf, encodedRecord...)
+		writeOffset += recordLen
+		hintBuf = append(hintBuf, data.EncodeHintRecord(&data.HintRecord{
+			Key:     logRecord.Key,
+			Type:    logRecord.Type,
+			Pos:     positions[i],
+			CF:      logRecord.CF,
+			Version: logRecord.Version,
+		})...)
+	}
+	// 写入数据
+	if err := flush(); err != nil {
 		return nil, err
 	}
-	// 如果开启了同步写入，持久化数据到磁盘
-	if db.options.SyncWrite {
-		if err := db.activeFile.Sync(); err != nil {
+	// 累计写入的字节数达到阈值时持久化
+	if db.options.BytesPerSync > 0 && db.bytesWrite >= db.options.BytesPerSync {
+		if err := db.syncActiveFile(); err != nil {
 			return nil, err
 		}
 	}
-	// 返回索引信息
-	recordPos := &data.LogRecordPos{
-		Fid:    db.activeFile.Fid,
-		Offset: writeOffset,
+	return positions, nil
+}
+
+// 将当前活跃文件转为旧数据文件，生成对应的hint文件后打开新的活跃文件
+func (db *DB) rotateActiveFile() error {
+	// 持久化当前活跃文件数据到磁盘当中
+	if err := db.syncActiveFile(); err != nil {
+		return err
+	}
+	// hint文件只用于加快启动，写入失败时下次启动读取数据文件重建索引
+	if err := db.writeHintFile(db.activeFile.Fid, db.hintBuf, db.activeFile.WriteOffset); err != nil {
+		db.logger.Warn("write hint file failed", "fid", db.activeFile.Fid, "error", err)
+	}
+	db.hintBuf = nil
+	if db.metrics != nil {
+		db.metrics.FileRotations.Inc()
+	}
+	// 将当前文件放入旧的数据文件中
+	oldFid := db.activeFile.Fid
+	db.olderFiles[oldFid] = db.activeFile
+	// 构造新的数据文件
+	if err := db.setActiveFile(); err != nil {
+		return err
+	}
+	db.notifyFileRotated(oldFid, db.activeFile.Fid)
+	return nil
+}
+
+// 写入数据文件对应的hint文件，末尾追加结束标识用于校验完整性
+func (db *DB) writeHintFile(fid uint32, hintBuf []byte, dataSize int64) error {
+	hintFileName := data.GetHintFileName(db.options.DirPath, fid)
+	if err := db.fs.Remove(hintFileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	hintFile, err := data.OpenHintFile(db.fs, db.options.DirPath, fid)
+	if err != nil {
+		return err
+	}
+	defer hintFile.Close()
+
+	buf := make([]byte, 0, len(hintBuf)+data.MaxLogRecordHeaderSize*2)
+	buf = append(buf, hintBuf...)
+	buf = append(buf, data.EncodeHintFinRecord(fid, dataSize)...)
+	if err := hintFile.Write(buf); err != nil {
+		return err
+	}
+	return hintFile.Sync()
+}
+
+// 单个数据文件的索引加载结果
+type fileIndexResult struct {
+	hints   []*data.HintRecord
+	size    int64 // 数据文件的有效大小
+	scanned bool  // 是否读取了数据文件，为true时需要补全hint文件
+	err     error
+}
+
+// 读取单个数据文件中的索引信息，旧数据文件优先读取hint文件
+func (db *DB) loadFileIndex(dataFile *data.DataFile, isActive bool) *fileIndexResult {
+	if !isActive {
+		if hints, ok := db.readHintFile(dataFile); ok {
+			return &fileIndexResult{hints: hints}
+		}
+	}
+
+	res := &fileIndexResult{scanned: true}
+	offset := data.FileHeaderSize
+	// 持续读取文件中的数据
+	for {
+		logRecord, recordSize, err := dataFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if isActive && (err == io.ErrUnexpectedEOF || err == data.ErrInvaildCRC) {
+				// 活跃文件末尾不完整的记录是崩溃时未写完的数据，加载时截断
+				torn, sizeErr := db.isTornTail(dataFile, offset+recordSize, err)
+				if sizeErr != nil {
+					res.err = sizeErr
+					return res
+				}
+				if torn {
+					break
+				}
+				// 损坏的记录之后还有数据，不能截断
+				err = ErrDataFileCorrupted
+			}
+			res.err = err
+			return res
+		}
+		res.hints = append(res.hints, &data.HintRecord{
+			Key:     logRecord.Key,
+			Type:    logRecord.Type,
+			Pos:     &data.LogRecordPos{Fid: dataFile.Fid, Offset: offset, Size: uint32(recordSize)},
+			CF:      logRecord.CF,
+			Version: logRecord.Version,
+		})
+		offset += recordSize
+	}
+	res.size = offset
+	return res
+}
+
+// 判断读取失败的记录是否延伸到了文件末尾，只有这样的记录才是崩溃时写了一半的数据
+func (db *DB) isTornTail(dataFile *data.DataFile, recordEnd int64, err error) (bool, error) {
+	if err == io.ErrUnexpectedEOF {
+		return true, nil
+	}
+	fileSize, err := dataFile.IOManager.Size()
+	if err != nil {
+		return false, err
 	}
-	return recordPos, nil
+	return recordEnd >= fileSize, nil
+}
+
+// 从hint文件中读取旧数据文件的索引信息，hint文件缺失或损坏时返回false
+func (db *DB) readHintFile(dataFile *data.DataFile) ([]*data.HintRecord, bool) {
+	hintFileName := data.GetHintFileName(db.options.DirPath, dataFile.Fid)
+	if ok, err := db.fs.Exists(hintFileName); err != nil || !ok {
+		return nil, false
+	}
+	dataSize, err := dataFile.IOManager.Size()
+	if err != nil {
+		return nil, false
+	}
+	hintFile, err := data.OpenHintFile(db.fs, db.options.DirPath, dataFile.Fid)
+	if err != nil {
+		return nil, false
+	}
+	defer hintFile.Close()
+	return hintFile.ReadHintRecords(dataSize)
 }
 
 func (db *DB) setActiveFile() error {
@@ -293,7 +762,7 @@ func (db *DB) setActiveFile() error {
 		initialFileID = db.activeFile.Fid + 1
 	}
 	// 构造新的数据文件
-	dataFile, err := data.OpenDataFile(db.options.DirPath, initialFileID)
+	dataFile, err := data.OpenDataFile(db.fs, db.options.DirPath, initialFileID)
 	if err != nil {
 		return err
 	}
@@ -301,6 +770,17 @@ func (db *DB) setActiveFile() error {
 	return nil
 }
 
+// 配置项中的文件系统，为nil时根据InMemory选择
+func optionsFS(options Options) vfs.FS {
+	if options.FS != nil {
+		return options.FS
+	}
+	if options.InMemory {
+		return vfs.NewMemFS()
+	}
+	return vfs.Default
+}
+
 func checkOptions(options Options) error {
 	if options.DirPath == "" {
 		return ErrDBDirisEmpty
@@ -308,20 +788,23 @@ func checkOptions(options Options) error {
 	if options.MaxFileSize <= 0 {
 		return ErrMaxFileSizeInvalid
 	}
+	if options.BlobThreshold < 0 {
+		return ErrBlobThresholdInvalid
+	}
 	return nil
 }
 
 func (db *DB) loadDataFiles() error {
-	dirEntries, err := os.ReadDir(db.options.DirPath)
+	fileNames, err := db.fs.ReadDir(db.options.DirPath)
 	if err != nil {
 		return err
 	}
 
 	var fidList []int
 	// 遍历所有以.data结尾的文件
-	for _, entry := range dirEntries {
-		if strings.HasSuffix(entry.Name(), data.DataFileSuffix) {
-			fidStr := strings.Split(entry.Name(), ".")[0]
+	for _, fileName := range fileNames {
+		if strings.HasSuffix(fileName, data.DataFileSuffix) {
+			fidStr := strings.Split(fileName, ".")[0]
 			fid, err := strconv.Atoi(fidStr)
 			if err != nil {
 				// 数据文件损坏
@@ -334,7 +817,7 @@ func (db *DB) loadDataFiles() error {
 	sort.Ints(fidList)
 	db.fidList = fidList
 	for i, fid := range fidList {
-		dataFile, err := data.OpenDataFile(db.options.DirPath, uint32(fid))
+		dataFile, err := data.OpenDataFile(db.fs, db.options.DirPath, uint32(fid))
 		if err != nil {
 			return err
 		}
@@ -348,31 +831,14 @@ func (db *DB) loadDataFiles() error {
 	return nil
 }
 
-// 从数据文件中加载索引
+// 从数据文件中加载索引，旧数据文件优先从hint文件加载
 func (db *DB) loadIndexFromDataFiles() error {
 	if len(db.fidList) == 0 {
 		return nil
 	}
-	// 检查是否发生过merge
-	hasMerge, recentMergeFid := false, uint32(0)
-	mergeFileName := filepath.Join(db.getMergePath(), data.MergeFinishedFileName)
-	if _, err := os.Stat(mergeFileName); err == nil {
-		mergeid, err := db.getRecentMergeFid(db.getMergePath())
-		if err != nil {
-			return err
-		}
-		hasMerge = true
-		recentMergeFid = mergeid
-	}
 
-	updateIndex := func(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
-		var ok bool
-		if typ == data.LogRecordDeleted {
-			ok = db.index.Delete(key)
-		} else {
-			ok = db.index.Put(key, pos)
-		}
-		if !ok {
+	updateIndex := func(cf uint32, key []byte, typ data.LogRecordType, pos *data.LogRecordPos, ver data.RecordVersion) {
+		if err := db.updateIndex(cf, key, typ, pos, ver); err != nil {
 			panic("DB index update failed.")
 		}
 	}
@@ -381,63 +847,105 @@ func (db *DB) loadIndexFromDataFiles() error {
 	transactionRecord := make(map[uint64][]*data.TransactionRecord)
 	var currSeqNo = NonTxnSeqNo
 
-	//取出所有文件中的数据
+	applyRecord := func(hint *data.HintRecord) {
+		// 解析key
+		realKey, seqNo := parseLogRecordKey(hint.Key)
+		if seqNo == NonTxnSeqNo {
+			// 非事务操作
+			updateIndex(hint.CF, realKey, hint.Type, hint.Pos, hint.Version)
+		} else {
+			// 事务操作
+			if hint.Type == data.LogRecordTxnFin {
+				for _, txnRecord := range transactionRecord[seqNo] {
+					rec := txnRecord.Record
+					updateIndex(rec.CF, rec.Key, rec.Type, txnRecord.Pos, rec.Version)
+				}
+				delete(transactionRecord, seqNo)
+			} else {
+				// 暂存事务的数据
+				transactionRecord[seqNo] = append(transactionRecord[seqNo], &data.TransactionRecord{
+					Record: &data.LogRecord{Key: realKey, Type: hint.Type, CF: hint.CF, Version: hint.Version},
+					Pos:    hint.Pos,
+				})
+			}
+		}
+
+		if seqNo > currSeqNo {
+			currSeqNo = seqNo
+		}
+	}
+
+	// 多个goroutine并发读取数据文件，按照fid顺序应用到索引中
+	total := len(db.fidList)
+	concurrency := db.options.LoadConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	results := make([]chan *fileIndexResult, total)
+	for i := range results {
+		results[i] = make(chan *fileIndexResult, 1)
+	}
+	// 已读取但还未应用的文件数不超过并发数，限制内存占用
+	sem := make(chan struct{}, concurrency)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i, fid := range db.fidList {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			isActive := i == total-1
+			var dataFile *data.DataFile
+			if isActive {
+				dataFile = db.activeFile
+			} else {
+				dataFile = db.olderFiles[uint32(fid)]
+			}
+			go func(i int) {
+				results[i] <- db.loadFileIndex(dataFile, isActive)
+			}(i)
+		}
+	}()
+
 	for i, fid := range db.fidList {
-		if hasMerge && fid <= int(recentMergeFid) {
-			continue
+		res := <-results[i]
+		<-sem
+		if res.err != nil {
+			return res.err
 		}
 		var fileID = uint32(fid)
-		var dataFile *data.DataFile
-		if fileID == db.activeFile.Fid {
-			dataFile = db.activeFile
-		} else {
-			dataFile = db.olderFiles[fileID]
+		var hintBuf []byte
+		for _, hint := range res.hints {
+			applyRecord(hint)
+			if res.scanned {
+				hintBuf = append(hintBuf, data.EncodeHintRecord(hint)...)
+			}
 		}
 
-		var offset int64
-		// 持续读取文件中的数据
-		for {
-			logRecord, recordSize, err := dataFile.ReadLogRecord(offset)
+		if i == total-1 {
+			// 截断活跃文件末尾不完整的数据
+			fileSize, err := db.activeFile.IOManager.Size()
 			if err != nil {
-				if err == io.EOF {
-					break
-				}
 				return err
 			}
-			logRecordPos := &data.LogRecordPos{Fid: fileID, Offset: offset}
-
-			// 解析key
-			realKey, seqNo := parseLogRecordKey(logRecord.Key)
-			logRecord.Key = realKey
-			if seqNo == NonTxnSeqNo {
-				// 非事务操作
-				updateIndex(realKey, logRecord.Type, logRecordPos)
-			} else {
-				// 事务操作
-				if logRecord.Type == data.LogRecordTxnFin {
-					for _, txnRecord := range transactionRecord[seqNo] {
-						updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
-					}
-					delete(transactionRecord, seqNo)
-				} else {
-					// 暂存事务的数据
-					transactionRecord[seqNo] = append(transactionRecord[seqNo], &data.TransactionRecord{
-						Record: logRecord,
-						Pos:    logRecordPos,
-					})
+			if fileSize > res.size {
+				if err := db.activeFile.IOManager.Truncate(res.size); err != nil {
+					return err
 				}
+				db.notifyRecoveryTruncate(fileID, fileSize, res.size)
 			}
-
-			if seqNo > currSeqNo {
-				currSeqNo = seqNo
-			}
-
-			offset += recordSize
+			// 更新当前活跃文件的写入Offset
+			db.activeFile.WriteOffset = res.size
+			db.hintBuf = hintBuf
+		} else if res.scanned {
+			// 补全缺失的hint文件，失败时下次启动仍会读取数据文件
+			_ = db.writeHintFile(fileID, hintBuf, res.size)
 		}
 
-		// 更新当前活跃文件的写入Offset
-		if i == len(db.fidList)-1 {
-			db.activeFile.WriteOffset = offset
+		if db.options.LoadProgress != nil {
+			db.options.LoadProgress(i+1, total)
 		}
 	}
 	db.seqNo = currSeqNo
@@ -1,9 +1,13 @@
 package bcdb
 
 import (
+	"bcdb/data"
+	"bcdb/vfs"
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -11,6 +15,13 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// 测试使用的默认配置，数据目录位于t.TempDir()中，merge目录与其相邻，测试结束后一起清理
+func testOptions(t *testing.T) Options {
+	opts := DefaultOptions
+	opts.DirPath = filepath.Join(t.TempDir(), "bcdb")
+	return opts
+}
+
 // ==================== ListKeys 测试 ====================
 
 // 测试空数据库的 ListKeys
@@ -590,6 +601,24 @@ func TestOpen_InvalidOptions_InvalidFileSize(t *testing.T) {
 	assert.Nil(t, db)
 }
 
+func TestOpen_InvalidOptions_BlobThreshold(t *testing.T) {
+	opts := testOptions(t)
+
+	opts.BlobThreshold = -1
+	db, err := Open(opts)
+	assert.Equal(t, ErrBlobThresholdInvalid, err)
+	assert.Nil(t, db)
+
+	// 0使用默认阈值，小value不会写入blob文件
+	opts.BlobThreshold = 0
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, DefaultOptions.BlobThreshold, db.options.BlobThreshold)
+	assert.Nil(t, db.PutStream([]byte("key"), strings.NewReader("value")))
+	assert.Equal(t, 0, countBlobFiles(t, opts.DirPath))
+}
+
 // 测试打开已存在数据的数据库（加载索引）
 func TestOpen_LoadExistingData(t *testing.T) {
 	opts := DefaultOptions
@@ -642,6 +671,44 @@ func TestOpen_EmptyDatabase(t *testing.T) {
 	assert.Equal(t, 0, len(keys))
 }
 
+// 测试活跃文件中间的记录损坏时打开失败，末尾的记录损坏时截断
+func TestOpen_CorruptedActiveFile(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	assert.Nil(t, db.Close())
+
+	fileName := data.GetDataFileName(opts.DirPath, 0)
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	corrupt := func(value string) []byte {
+		corrupted := bytes.Clone(content)
+		corrupted[bytes.Index(corrupted, []byte(value))] ^= 0xff
+		return corrupted
+	}
+
+	// 中间的记录损坏，之后的数据不能被截断
+	assert.Nil(t, os.WriteFile(fileName, corrupt("value-3"), 0644))
+	_, err = Open(opts)
+	assert.Equal(t, ErrDataFileCorrupted, err)
+	stat, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), stat.Size())
+
+	// 最后一条记录损坏视为崩溃时写了一半的数据
+	assert.Nil(t, os.WriteFile(fileName, corrupt("value-9"), 0644))
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 9, len(db.ListKeys()))
+	_, err = db.Get([]byte("key-9"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
 // ==================== Put 函数测试 ====================
 
 // 测试插入正常的 key-value
@@ -1964,3 +2031,225 @@ func TestSync_FullLifecycle(t *testing.T) {
 		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), val)
 	}
 }
+
+// ==================== Hint 文件测试 ====================
+
+// 测试活跃文件切换时生成hint文件
+func TestHintFile_CreatedOnRotation(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	for i := 0; i < 50; i++ {
+		err = db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d_padding_to_make_it_larger", i)))
+		assert.Nil(t, err)
+	}
+	assert.True(t, len(db.olderFiles) > 0)
+
+	// 每个旧数据文件都有对应的hint文件，活跃文件没有
+	for fid := range db.olderFiles {
+		_, err := os.Stat(data.GetHintFileName(opts.DirPath, fid))
+		assert.Nil(t, err)
+	}
+	_, err = os.Stat(data.GetHintFileName(opts.DirPath, db.activeFile.Fid))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// 测试通过hint文件加载索引
+func TestHintFile_LoadIndex(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 50; i++ {
+		err = db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d_padding_to_make_it_larger", i)))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Delete([]byte(fmt.Sprintf("key_%d", i))))
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("key_0"), []byte("batch_value")))
+	assert.Nil(t, wb.Commit())
+	seqNo := db.seqNo
+	assert.Nil(t, db.Close())
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+
+	assert.Equal(t, seqNo, db2.seqNo)
+	assert.Equal(t, 41, len(db2.ListKeys()))
+	val, err := db2.Get([]byte("key_0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("batch_value"), val)
+	for i := 1; i < 10; i++ {
+		_, err := db2.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	for i := 10; i < 50; i++ {
+		val, err := db2.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d_padding_to_make_it_larger", i)), val)
+	}
+}
+
+// 测试hint文件缺失或损坏时回退到读取数据文件，并重新生成hint文件
+func TestHintFile_Fallback(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 50; i++ {
+		err = db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d_padding_to_make_it_larger", i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Close())
+
+	// 删除第一个hint文件，截断第二个hint文件
+	assert.Nil(t, os.Remove(data.GetHintFileName(opts.DirPath, 0)))
+	hintName := data.GetHintFileName(opts.DirPath, 1)
+	stat, err := os.Stat(hintName)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(hintName, stat.Size()-3))
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+
+	for i := 0; i < 50; i++ {
+		val, err := db2.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d_padding_to_make_it_larger", i)), val)
+	}
+
+	// hint文件被重新生成
+	for _, fid := range []uint32{0, 1} {
+		hintFile, err := data.OpenHintFile(vfs.Default, opts.DirPath, fid)
+		assert.Nil(t, err)
+		size, err := db2.olderFiles[fid].IOManager.Size()
+		assert.Nil(t, err)
+		_, ok := hintFile.ReadHintRecords(size)
+		assert.True(t, ok)
+		hintFile.Close()
+	}
+}
+
+// ==================== 并发加载索引测试 ====================
+
+// 测试不同并发数下加载的索引一致，且跨文件的事务与覆盖写入保持正确
+func TestOpen_LoadConcurrency(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("key_%d", i))
+			if i%7 == round {
+				assert.Nil(t, db.Delete(key))
+				continue
+			}
+			assert.Nil(t, db.Put(key, []byte(fmt.Sprintf("value_%d_%d", round, i))))
+		}
+		// 事务数据跨越多个数据文件
+		wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+		for i := 0; i < 20; i++ {
+			assert.Nil(t, wb.Put([]byte(fmt.Sprintf("txn_%d", i)), []byte(fmt.Sprintf("txn_value_%d_%d", round, i))))
+		}
+		assert.Nil(t, wb.Commit())
+	}
+	expected := make(map[string][]byte)
+	assert.Nil(t, db.Fold(func(key, value []byte) bool {
+		expected[string(key)] = value
+		return true
+	}))
+	seqNo := db.seqNo
+	assert.Nil(t, db.Close())
+
+	for _, concurrency := range []int{1, 3, 16} {
+		// 删除hint文件，强制读取数据文件
+		if concurrency == 3 {
+			entries, err := os.ReadDir(opts.DirPath)
+			assert.Nil(t, err)
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), data.HintFileSuffix) {
+					assert.Nil(t, os.Remove(opts.DirPath+"/"+entry.Name()))
+				}
+			}
+		}
+
+		var calls, lastLoaded, lastTotal int
+		opts.LoadConcurrency = concurrency
+		opts.LoadProgress = func(loaded, total int) {
+			calls++
+			lastLoaded, lastTotal = loaded, total
+		}
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, len(db.fidList), calls)
+		assert.Equal(t, lastTotal, lastLoaded)
+		assert.Equal(t, seqNo, db.seqNo)
+
+		actual := make(map[string][]byte)
+		assert.Nil(t, db.Fold(func(key, value []byte) bool {
+			actual[string(key)] = value
+			return true
+		}))
+		assert.Equal(t, expected, actual)
+		assert.Nil(t, db.Close())
+	}
+}
+
+// ==================== 持久化策略测试 ====================
+
+// 测试累计写入字节数达到阈值后持久化
+func TestSync_BytesPerSync(t *testing.T) {
+	opts := testOptions(t)
+	opts.BytesPerSync = 256
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	assert.True(t, db.bytesWrite > 0)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+		assert.True(t, db.bytesWrite < opts.BytesPerSync)
+	}
+}
+
+// 测试后台定期持久化，以及关闭时后台协程退出
+func TestSync_SyncInterval(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncInterval = 10 * time.Millisecond
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	assert.Eventually(t, func() bool {
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		return db.bytesWrite == 0
+	}, time.Second, 5*time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, db.Close())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close 未能停止后台持久化协程")
+	}
+}
@@ -10,11 +10,33 @@ var (
 	ErrKeyNotFound      = errors.New("key not found")
 	ErrDataFileNotFound = errors.New("data file not found")
 
-	ErrDBDirisEmpty       = errors.New("db dir is empty")
-	ErrMaxFileSizeInvalid = errors.New("max file size is invalid")
-	ErrDataFileCorrupted  = errors.New("data file corrupted")
+	ErrDBDirisEmpty         = errors.New("db dir is empty")
+	ErrMaxFileSizeInvalid   = errors.New("max file size is invalid")
+	ErrDataFileCorrupted    = errors.New("data file corrupted")
+	ErrBlobThresholdInvalid = errors.New("blob threshold is invalid")
 
 	ErrDBClosed           = errors.New("db closed")
 	ErrExceedMaxBatchSize = errors.New("exceed max batch size")
 	ErrMergeInProgress    = errors.New("merge in progress")
+	ErrConditionFailed    = errors.New("write batch condition failed")
+
+	ErrMergeOperatorNotSet = errors.New("merge operator not set")
+	ErrInvalidMergeOperand = errors.New("invalid merge operand")
+	ErrIteratorKeysOnly    = errors.New("iterator is keys only")
+	ErrIteratorInvalidated = errors.New("iterator invalidated by merge")
+
+	ErrColumnFamilyExists   = errors.New("column family already exists")
+	ErrColumnFamilyNotFound = errors.New("column family not found")
+	ErrInvalidIndexType     = errors.New("invalid index type")
+	ErrColumnFamilyReserved = errors.New("column family name is reserved")
+
+	ErrSecondaryIndexExists   = errors.New("secondary index already exists")
+	ErrSecondaryIndexNotFound = errors.New("secondary index not found")
+
+	ErrVersionsNotKept = errors.New("versions are not kept, set Options.KeepVersions")
+
+	ErrDBDirNotFound = errors.New("database dir not found")
+
+	ErrInvalidExportFormat = errors.New("invalid export format")
+	ErrExportCorrupted     = errors.New("export data corrupted")
 )
@@ -0,0 +1,81 @@
+package bcdb
+
+import (
+	"log/slog"
+	"time"
+)
+
+// 引擎生命周期事件的回调，回调可能在持有DB内部锁时调用，不能再调用DB的方法
+type EventListener interface {
+	// 活跃文件写满后切换到新的数据文件
+	OnFileRotated(oldFid, newFid uint32)
+	// merge开始，files为参与merge的数据文件数量
+	OnMergeBegin(files int)
+	// merge结束，err不为nil表示merge失败
+	OnMergeEnd(duration time.Duration, reclaimedBytes int64, err error)
+	// 启动时截断了活跃文件末尾不完整的数据
+	OnRecoveryTruncate(fid uint32, size, validSize int64)
+	// 启动时索引加载完成
+	OnIndexLoaded(duration time.Duration, keys int)
+	// 持久化活跃文件失败
+	OnSyncError(err error)
+}
+
+// 不做任何处理的EventListener，嵌入后只需要实现关心的回调
+type NopEventListener struct{}
+
+func (NopEventListener) OnFileRotated(oldFid, newFid uint32)                                {}
+func (NopEventListener) OnMergeBegin(files int)                                             {}
+func (NopEventListener) OnMergeEnd(duration time.Duration, reclaimedBytes int64, err error) {}
+func (NopEventListener) OnRecoveryTruncate(fid uint32, size, validSize int64)               {}
+func (NopEventListener) OnIndexLoaded(duration time.Duration, keys int)                     {}
+func (NopEventListener) OnSyncError(err error)                                              {}
+
+// 配置项中的日志，为nil时不输出
+func optionsLogger(options Options) *slog.Logger {
+	if options.Logger != nil {
+		return options.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+func optionsEventListener(options Options) EventListener {
+	if options.EventListener != nil {
+		return options.EventListener
+	}
+	return NopEventListener{}
+}
+
+func (db *DB) notifyFileRotated(oldFid, newFid uint32) {
+	db.logger.Debug("active file rotated", "old_fid", oldFid, "new_fid", newFid)
+	db.events.OnFileRotated(oldFid, newFid)
+}
+
+func (db *DB) notifyMergeBegin(files int) {
+	db.logger.Info("merge started", "files", files)
+	db.events.OnMergeBegin(files)
+}
+
+func (db *DB) notifyMergeEnd(duration time.Duration, reclaimedBytes int64, err error) {
+	if err != nil {
+		db.logger.Error("merge failed", "duration", duration, "error", err)
+	} else {
+		db.logger.Info("merge finished", "duration", duration, "reclaimed_bytes", reclaimedBytes)
+	}
+	db.events.OnMergeEnd(duration, reclaimedBytes, err)
+}
+
+func (db *DB) notifyRecoveryTruncate(fid uint32, size, validSize int64) {
+	db.logger.Warn("truncated incomplete records at the end of active file", "fid", fid, "size", size, "valid_size", validSize)
+	db.events.OnRecoveryTruncate(fid, size, validSize)
+}
+
+func (db *DB) notifyIndexLoaded(duration time.Duration, keys int) {
+	db.logger.Info("index loaded", "files", len(db.fidList), "keys", keys, "duration", duration)
+	db.events.OnIndexLoaded(duration, keys)
+}
+
+func (db *DB) notifySyncError(err error) {
+	db.logger.Error("sync active file failed", "error", err)
+	db.events.OnSyncError(err)
+}
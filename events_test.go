@@ -0,0 +1,231 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bcdb/fio"
+	"bcdb/vfs"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 事件回调测试 ====================
+
+type recordingListener struct {
+	NopEventListener
+	mu         sync.Mutex
+	rotations  [][2]uint32
+	mergeBegin []int
+	mergeEnd   []error
+	reclaimed  int64
+	truncates  [][2]int64
+	indexKeys  []int
+	syncErrors []error
+}
+
+func (l *recordingListener) OnFileRotated(oldFid, newFid uint32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotations = append(l.rotations, [2]uint32{oldFid, newFid})
+}
+
+func (l *recordingListener) OnMergeBegin(files int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mergeBegin = append(l.mergeBegin, files)
+}
+
+func (l *recordingListener) OnMergeEnd(duration time.Duration, reclaimedBytes int64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mergeEnd = append(l.mergeEnd, err)
+	l.reclaimed += reclaimedBytes
+}
+
+func (l *recordingListener) OnRecoveryTruncate(fid uint32, size, validSize int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.truncates = append(l.truncates, [2]int64{size, validSize})
+}
+
+func (l *recordingListener) OnIndexLoaded(duration time.Duration, keys int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.indexKeys = append(l.indexKeys, keys)
+}
+
+func (l *recordingListener) OnSyncError(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncErrors = append(l.syncErrors, err)
+}
+
+func TestEvents_RotateAndMerge(t *testing.T) {
+	listener := &recordingListener{}
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	opts.EventListener = listener
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0}, listener.indexKeys)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i%10)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	assert.NotEmpty(t, listener.rotations)
+	for i, rotation := range listener.rotations {
+		assert.Equal(t, uint32(i), rotation[0])
+		assert.Equal(t, uint32(i+1), rotation[1])
+	}
+
+	rotations := len(listener.rotations)
+	assert.Nil(t, db.Merge())
+	// merge前切换一次活跃文件，参与merge的是切换前的全部文件
+	assert.Equal(t, rotations+1, len(listener.rotations))
+	assert.Equal(t, []int{rotations + 1}, listener.mergeBegin)
+	assert.Equal(t, []error{nil}, listener.mergeEnd)
+	assert.Greater(t, listener.reclaimed, int64(0))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, []int{0, 10}, listener.indexKeys)
+	assert.Empty(t, listener.truncates)
+}
+
+func TestEvents_MergeSkipped(t *testing.T) {
+	listener := &recordingListener{}
+	opts := testOptions(t)
+	opts.EventListener = listener
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// 没有数据或已经在merge时直接返回，不触发回调
+	assert.Nil(t, db.Merge())
+	assert.Empty(t, listener.mergeBegin)
+
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	db.isMerge = true
+	assert.Equal(t, ErrMergeInProgress, db.Merge())
+	db.isMerge = false
+	assert.Empty(t, listener.mergeBegin)
+	assert.Empty(t, listener.mergeEnd)
+}
+
+func TestEvents_RecoveryTruncate(t *testing.T) {
+	listener := &recordingListener{}
+	opts := testOptions(t)
+	opts.EventListener = listener
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")))
+	}
+	assert.Nil(t, db.Close())
+
+	// 在活跃文件末尾追加写入一半的记录
+	fileName := data.GetDataFileName(opts.DirPath, 0)
+	stat, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: []byte("torn"), Value: bytes.Repeat([]byte("v"), 64)})
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write(encRecord[:len(encRecord)/2])
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, [][2]int64{{stat.Size() + int64(len(encRecord)/2), stat.Size()}}, listener.truncates)
+	assert.Equal(t, []int{0, 10}, listener.indexKeys)
+}
+
+func TestEvents_SyncError(t *testing.T) {
+	listener := &recordingListener{}
+	injector := fio.NewFaultInjector()
+	opts := crashTestOptions(vfs.NewFaultFS(vfs.NewMemFS(), injector))
+	opts.EventListener = listener
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	injector.FailAt(fio.FaultSync, injector.Count(fio.FaultSync)+1)
+	assert.Equal(t, fio.ErrInjectedFault, db.Put([]byte("key"), []byte("value")))
+	assert.Equal(t, []error{fio.ErrInjectedFault}, listener.syncErrors)
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	assert.Equal(t, 1, len(listener.syncErrors))
+}
+
+func TestEvents_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	opts.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i%10)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	assert.Nil(t, db.Merge())
+
+	logs := buf.String()
+	assert.Contains(t, logs, "msg=\"index loaded\"")
+	assert.Contains(t, logs, "msg=\"database opened\"")
+	assert.Contains(t, logs, "msg=\"active file rotated\" old_fid=0 new_fid=1")
+	assert.Contains(t, logs, "msg=\"merge started\"")
+	assert.Contains(t, logs, "msg=\"merge finished\"")
+	// merge时内部打开的临时数据库不输出日志
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("msg=\"database opened\"")))
+
+	// 打开失败时输出错误日志
+	buf.Reset()
+	badOpts := opts
+	badOpts.DirPath = filepath.Join(t.TempDir(), "not-a-dir")
+	assert.Nil(t, os.WriteFile(badOpts.DirPath, []byte("not a dir"), 0644))
+	_, err = Open(badOpts)
+	assert.NotNil(t, err)
+	assert.Contains(t, buf.String(), "level=ERROR msg=\"open database failed\"")
+}
+
+// hint文件写入失败时只输出日志，不影响写入
+func TestEvents_HintFileError(t *testing.T) {
+	var buf bytes.Buffer
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+	opts.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	// hint文件的位置被非空目录占用，无法写入
+	hintFileName := data.GetHintFileName(opts.DirPath, 0)
+	assert.Nil(t, os.MkdirAll(hintFileName, os.ModePerm))
+	assert.Nil(t, os.WriteFile(filepath.Join(hintFileName, "file"), nil, 0644))
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")))
+	}
+	assert.Contains(t, buf.String(), "level=WARN msg=\"write hint file failed\" fid=0")
+	assert.Nil(t, db.Close())
+
+	// 重新打开时读取数据文件加载索引
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 20, len(db.ListKeys()))
+}
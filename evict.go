@@ -0,0 +1,264 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"container/list"
+	"sync"
+)
+
+// 超出磁盘预算时选择淘汰key的策略
+type EvictionPolicy byte
+
+const (
+	// 淘汰最早写入的key
+	EvictOldestWritten EvictionPolicy = iota
+	// 淘汰最久没有读写的key，重启后按写入顺序恢复
+	EvictLeastRecentlyUsed
+)
+
+// 记录默认列族中每个key占用的字节数以及写入或访问的先后顺序
+type evictionTracker struct {
+	mu        *sync.Mutex
+	ll        *list.List // 头部为最近写入或访问的key
+	items     map[string]*list.Element
+	liveBytes int64 // 有效数据占用的字节数
+}
+
+type evictionEntry struct {
+	key  string
+	size int64
+}
+
+func newEvictionTracker() *evictionTracker {
+	return &evictionTracker{
+		mu:    new(sync.Mutex),
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// 写入key，append为true时在原有大小上累加，用于合并操作数
+func (et *evictionTracker) write(key []byte, size int64, append bool) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	if elem, ok := et.items[string(key)]; ok {
+		entry := elem.Value.(*evictionEntry)
+		if !append {
+			et.liveBytes -= entry.size
+			entry.size = 0
+		}
+		entry.size += size
+		et.liveBytes += size
+		et.ll.MoveToFront(elem)
+		return
+	}
+	et.items[string(key)] = et.ll.PushFront(&evictionEntry{key: string(key), size: size})
+	et.liveBytes += size
+}
+
+func (et *evictionTracker) touch(key []byte) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	if elem, ok := et.items[string(key)]; ok {
+		et.ll.MoveToFront(elem)
+	}
+}
+
+func (et *evictionTracker) remove(key []byte) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	if elem, ok := et.items[string(key)]; ok {
+		et.liveBytes -= et.ll.Remove(elem).(*evictionEntry).size
+		delete(et.items, string(key))
+	}
+}
+
+func (et *evictionTracker) size() int64 {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	return et.liveBytes
+}
+
+// 清空全部记录，返回从最久到最近排列的key，merge重新加载索引之后用于恢复淘汰顺序
+func (et *evictionTracker) reset() []string {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	keys := make([]string, 0, et.ll.Len())
+	for elem := et.ll.Back(); elem != nil; elem = elem.Prev() {
+		keys = append(keys, elem.Value.(*evictionEntry).key)
+	}
+	et.ll.Init()
+	et.items = make(map[string]*list.Element)
+	et.liveBytes = 0
+	return keys
+}
+
+// 按照keys的先后顺序排列已有的key
+func (et *evictionTracker) keepOrder(keys []string) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := et.items[key]; ok {
+			et.ll.MoveToFront(elem)
+		}
+	}
+}
+
+// 从最久的key开始选择淘汰对象，直到剩余数据不超过limit
+func (et *evictionTracker) victims(limit int64) [][]byte {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	var keys [][]byte
+	remaining := et.liveBytes
+	for elem := et.ll.Back(); elem != nil && remaining > limit; elem = elem.Prev() {
+		entry := elem.Value.(*evictionEntry)
+		keys = append(keys, []byte(entry.key))
+		remaining -= entry.size
+	}
+	return keys
+}
+
+// 有效数据占用的字节数，包含blob文件中的value，未设置MaxDiskBytes时返回0
+func (db *DB) LiveBytes() int64 {
+	if db.eviction == nil {
+		return 0
+	}
+	return db.eviction.size()
+}
+
+// 根据索引的变化更新淘汰记录，调用方需持有db.mu
+func (db *DB) trackEviction(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
+	switch typ {
+	case data.LogRecordDeleted:
+		db.eviction.remove(key)
+	case data.LogRecordMergeOperand:
+		db.eviction.write(key, int64(pos.Size), true)
+	case data.LogRecordBlob:
+		// blob文件中的value同样占用磁盘空间
+		size := int64(pos.Size)
+		if logRecord, err := db.getLogRecordByPos(pos); err == nil {
+			size += data.DecodeBlobRef(logRecord.Value).Size
+		}
+		db.eviction.write(key, size, false)
+	default:
+		db.eviction.write(key, int64(pos.Size), false)
+	}
+}
+
+// 数据文件和blob文件占用的磁盘空间，调用方需持有db.mu
+func (db *DB) diskUsage() int64 {
+	size := db.dataFilesSize()
+	for _, blobSize := range db.blobSizes {
+		size += blobSize
+	}
+	return size
+}
+
+// 有效数据超出预算时写入删除记录淘汰旧的key，返回被淘汰的key，调用方需持有db.mu
+// 与写入在同一把锁内执行，merge不会读到超出预算的有效数据
+func (db *DB) evictOverBudget() ([][]byte, error) {
+	if db.eviction == nil {
+		return nil, nil
+	}
+	// merge之后每个数据文件的文件头也占用空间，淘汰时预留出来
+	reserved := data.FileHeaderSize * (db.options.MaxDiskBytes/db.options.MaxFileSize + 2)
+	victims := db.eviction.victims(db.options.MaxDiskBytes - reserved)
+	if err := db.evictKeys(victims); err != nil {
+		return nil, err
+	}
+	return victims, nil
+}
+
+// 每次写入完成并释放db.mu之后调用，通知被淘汰的key，磁盘空间超出MaxDiskBytes时在后台触发merge回收失效数据
+func (db *DB) afterWrite(evicted [][]byte) {
+	if len(evicted) > 0 {
+		db.logger.Debug("evicted keys", "keys", len(evicted), "live_bytes", db.eviction.size())
+		if db.options.OnEvict != nil {
+			db.options.OnEvict(evicted)
+		}
+	}
+	if db.eviction == nil {
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed || db.isMerge || db.budgetMerge {
+		return
+	}
+	size := db.diskUsage()
+	// merge之后仍然超出预算时（例如其他列族的数据），写入的数据再超出一个预算之后才重新merge，避免每次写入都触发merge
+	if size <= db.options.MaxDiskBytes ||
+		(db.evictMergeSize > db.options.MaxDiskBytes && size-db.evictMergeSize <= db.options.MaxDiskBytes) {
+		return
+	}
+	// 在锁内检查并登记后台协程，与Close的关闭通知互斥
+	select {
+	case <-db.closeCh:
+	default:
+		db.budgetMerge = true
+		db.bgWg.Add(1)
+		go db.runBudgetMerge()
+	}
+}
+
+// 后台执行超出磁盘预算时触发的merge，不阻塞写入，已经在merge时直接跳过
+func (db *DB) runBudgetMerge() {
+	defer db.bgWg.Done()
+	err := db.Merge()
+	db.mu.Lock()
+	db.budgetMerge = false
+	db.mu.Unlock()
+	if err != nil && err != ErrMergeInProgress {
+		db.logger.Warn("disk budget merge failed", "error", err)
+	}
+}
+
+// 写入淘汰key的删除记录并更新索引，调用方需持有db.mu
+func (db *DB) evictKeys(keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if db.hasSecondaryIndexes() {
+		writes := make([]*data.LogRecord, len(keys))
+		for i, key := range keys {
+			writes[i] = &data.LogRecord{Key: key, Type: data.LogRecordDeleted}
+		}
+		return db.appendWithSecondaryIndexes(writes, db.options.SyncWrite)
+	}
+	records := make([]*data.LogRecord, len(keys))
+	for i, key := range keys {
+		records[i] = &data.LogRecord{
+			Key:  logRecordWithSeqNo(key, NonTxnSeqNo),
+			Type: data.LogRecordDeleted,
+		}
+	}
+	positions, err := db.appendLogRecords(records)
+	if err != nil {
+		return err
+	}
+	if db.options.SyncWrite {
+		if err := db.syncActiveFile(); err != nil {
+			return err
+		}
+	}
+	for i, key := range keys {
+		if err := db.updateIndex(DefaultCFID, key, data.LogRecordDeleted, positions[i], records[i].Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按访问时间淘汰时，读取key之后更新访问顺序
+func (db *DB) touchEviction(key []byte) {
+	if db.eviction != nil && db.options.EvictionPolicy == EvictLeastRecentlyUsed {
+		db.eviction.touch(key)
+	}
+}
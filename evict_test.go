@@ -0,0 +1,326 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 磁盘预算淘汰测试 ====================
+
+type evictRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *evictRecorder) onEvict(keys [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		r.keys = append(r.keys, string(key))
+	}
+}
+
+// 每条记录的大小
+func evictTestRecordSize(key string, value []byte) int64 {
+	_, size := data.EncodeLogRecord(&data.LogRecord{
+		Key:     logRecordWithSeqNo([]byte(key), NonTxnSeqNo),
+		Value:   value,
+		Version: data.RecordVersion{Timestamp: time.Now().UnixNano()},
+	})
+	return size
+}
+
+// 容纳n条记录的磁盘预算，包含数据文件头以及淘汰时预留的空间
+func evictTestBudget(n int, recordSize int64) int64 {
+	return int64(n)*recordSize + 2*data.FileHeaderSize
+}
+
+// 等待后台merge把磁盘空间降到预算以内，merge开始之后写入的数据需要再检查一次预算
+func waitDiskBudget(t *testing.T, db *DB) {
+	for i := 0; i < 1000; i++ {
+		db.mu.RLock()
+		merging, size := db.isMerge || db.budgetMerge, db.diskUsage()
+		db.mu.RUnlock()
+		if merging {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if size <= db.options.MaxDiskBytes {
+			return
+		}
+		db.afterWrite(nil)
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("disk usage exceeds MaxDiskBytes")
+}
+
+func TestEvictionTracker(t *testing.T) {
+	et := newEvictionTracker()
+	et.write([]byte("a"), 10, false)
+	et.write([]byte("b"), 20, false)
+	et.write([]byte("c"), 30, false)
+	assert.Equal(t, int64(60), et.size())
+
+	// 覆盖写入时替换大小，追加操作数时累加大小
+	et.write([]byte("a"), 5, false)
+	et.write([]byte("a"), 5, true)
+	assert.Equal(t, int64(60), et.size())
+	assert.Equal(t, [][]byte{[]byte("b")}, et.victims(40))
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c")}, et.victims(39))
+
+	et.touch([]byte("b"))
+	assert.Equal(t, [][]byte{[]byte("c")}, et.victims(30))
+	et.remove([]byte("c"))
+	et.remove([]byte("missing"))
+	assert.Equal(t, int64(30), et.size())
+	assert.Empty(t, et.victims(30))
+
+	// merge重新加载之后按原来的顺序排列
+	order := et.reset()
+	assert.Equal(t, int64(0), et.size())
+	et.write([]byte("b"), 20, false)
+	et.write([]byte("a"), 10, false)
+	et.keepOrder(order)
+	assert.Equal(t, [][]byte{[]byte("a")}, et.victims(20))
+}
+
+func TestDB_EvictOldestWritten(t *testing.T) {
+	recorder := &evictRecorder{}
+	value := make([]byte, 100)
+	recordSize := evictTestRecordSize("key-00", value)
+	opts := testOptions(t)
+	opts.MaxFileSize = 4096
+	opts.MaxDiskBytes = evictTestBudget(10, recordSize)
+	opts.OnEvict = recorder.onEvict
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), value))
+	}
+	assert.Empty(t, recorder.keys)
+	// 读取不影响按写入时间淘汰的顺序，覆盖写入会更新写入时间
+	_, err = db.Get([]byte("key-00"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key-01"), value))
+	for i := 10; i < 13; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), value))
+	}
+	assert.Equal(t, []string{"key-00", "key-02", "key-03"}, recorder.keys)
+	assert.Equal(t, 10*recordSize, db.LiveBytes())
+	assert.Equal(t, 10, len(db.ListKeys()))
+	_, err = db.Get([]byte("key-00"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get([]byte("key-01"))
+	assert.Nil(t, err)
+
+	// 删除key之后释放预算
+	liveBytes := db.LiveBytes()
+	assert.Nil(t, db.Delete([]byte("key-12")))
+	assert.Equal(t, liveBytes-recordSize, db.LiveBytes())
+	assert.Nil(t, db.Close())
+
+	// 重启后从hint文件恢复每个key的大小和写入顺序
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, liveBytes-recordSize, db.LiveBytes())
+	for i := 13; i < 15; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), value))
+	}
+	assert.Equal(t, []string{"key-00", "key-02", "key-03", "key-04"}, recorder.keys)
+}
+
+func TestDB_EvictLeastRecentlyUsed(t *testing.T) {
+	recorder := &evictRecorder{}
+	value := make([]byte, 100)
+	opts := testOptions(t)
+	opts.MaxFileSize = 4096
+	opts.MaxDiskBytes = evictTestBudget(5, evictTestRecordSize("key-00", value))
+	opts.OnEvict = recorder.onEvict
+	opts.EvictionPolicy = EvictLeastRecentlyUsed
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), value))
+	}
+	_, err = db.Get([]byte("key-00"))
+	assert.Nil(t, err)
+	_, errs := db.MultiGet([][]byte{[]byte("key-01")})
+	assert.Nil(t, errs[0])
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("key-05"), value))
+	assert.Nil(t, wb.Put([]byte("key-06"), value))
+	assert.Nil(t, wb.Commit())
+	assert.Equal(t, []string{"key-02", "key-03"}, recorder.keys)
+	_, err = db.Get([]byte("key-00"))
+	assert.Nil(t, err)
+}
+
+// 磁盘空间超出预算时在后台触发merge，merge完成后立即删除旧文件
+func TestDB_EvictTriggersMerge(t *testing.T) {
+	recorder := &evictRecorder{}
+	listener := &recordingListener{}
+	value := make([]byte, 100)
+	opts := testOptions(t)
+	opts.MaxFileSize = 4096
+	opts.MaxDiskBytes = evictTestBudget(20, evictTestRecordSize("key-000", value))
+	opts.OnEvict = recorder.onEvict
+	opts.SyncWrite = true
+	opts.EventListener = listener
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%03d", i)), value))
+	}
+	assert.Equal(t, 180, len(recorder.keys))
+	waitDiskBudget(t, db)
+	assert.Nil(t, db.Close())
+	assert.NotEmpty(t, listener.mergeBegin)
+	assert.Equal(t, len(listener.mergeBegin), len(listener.mergeEnd))
+	for _, err := range listener.mergeEnd {
+		assert.Nil(t, err)
+	}
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.LessOrEqual(t, db.diskUsage(), opts.MaxDiskBytes)
+	assert.Equal(t, 20, len(db.ListKeys()))
+	for i := 180; i < 200; i++ {
+		_, err := db.Get([]byte(fmt.Sprintf("key-%03d", i)))
+		assert.Nil(t, err)
+	}
+}
+
+// 反复覆盖同一个key时有效数据不超出预算，但失效数据占用的磁盘空间同样需要回收
+func TestDB_EvictOverwriteTriggersMerge(t *testing.T) {
+	recorder := &evictRecorder{}
+	opts := testOptions(t)
+	opts.MaxFileSize = 4096
+	opts.MaxDiskBytes = 8 * 1024
+	opts.OnEvict = recorder.onEvict
+	opts.MaxFileSize = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 20000; i++ {
+		assert.Nil(t, db.Put([]byte("key"), []byte(fmt.Sprintf("value-%05d", i))))
+	}
+	waitDiskBudget(t, db)
+	assert.Empty(t, recorder.keys)
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value-19999"), value)
+
+	// 旧文件在merge完成时已经从数据目录中删除
+	entries, err := os.ReadDir(opts.DirPath)
+	assert.Nil(t, err)
+	var size int64
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), data.DataFileSuffix) {
+			info, err := entry.Info()
+			assert.Nil(t, err)
+			size += info.Size()
+		}
+	}
+	assert.LessOrEqual(t, size, opts.MaxDiskBytes)
+}
+
+// blob文件同样计入磁盘预算
+func TestDB_EvictBlobs(t *testing.T) {
+	recorder := &evictRecorder{}
+	opts := testOptions(t)
+	opts.MaxFileSize = 4096
+	opts.MaxDiskBytes = 3 * 1024
+	opts.OnEvict = recorder.onEvict
+	opts.BlobThreshold = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, db.PutStream([]byte(fmt.Sprintf("key-%d", i)), bytes.NewReader(make([]byte, 1024))))
+	}
+	assert.Equal(t, []string{"key-0", "key-1", "key-2"}, recorder.keys)
+	waitDiskBudget(t, db)
+	_, err = db.Get([]byte("key-4"))
+	assert.Nil(t, err)
+}
+
+// 条件写入、合并操作数以及其他列族的写入同样检查磁盘预算
+func TestDB_EvictWritePaths(t *testing.T) {
+	recorder := &evictRecorder{}
+	listener := &recordingListener{}
+	value := make([]byte, 100)
+	recordSize := evictTestRecordSize("key-00", value)
+	opts := testOptions(t)
+	opts.MaxFileSize = 4096
+	opts.MaxDiskBytes = evictTestBudget(2, recordSize)
+	opts.OnEvict = recorder.onEvict
+	opts.MergeOperator = AppendOperator
+	opts.EventListener = listener
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	// 其他列族的数据不会被淘汰，但占用的磁盘空间超出预算时同样触发merge
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, users.Put([]byte("user"), value))
+	}
+	assert.Nil(t, db.Close())
+	assert.NotEmpty(t, listener.mergeBegin)
+	assert.Empty(t, recorder.keys)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		ok, err := db.PutIfAbsent([]byte(fmt.Sprintf("key-%02d", i)), value)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, []string{"key-00"}, recorder.keys)
+	assert.Nil(t, db.MergeValue([]byte("key-03"), value))
+	assert.Equal(t, []string{"key-00", "key-01"}, recorder.keys)
+}
+
+// 调小预算后重新打开时立即淘汰
+func TestDB_EvictOnOpen(t *testing.T) {
+	recorder := &evictRecorder{}
+	value := make([]byte, 100)
+	recordSize := evictTestRecordSize("key-00", value)
+	opts := testOptions(t)
+	opts.MaxFileSize = 4096
+	opts.MaxDiskBytes = 0
+	opts.OnEvict = recorder.onEvict
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%02d", i)), value))
+	}
+	assert.Equal(t, int64(0), db.LiveBytes())
+	assert.Nil(t, db.Close())
+
+	opts.MaxDiskBytes = evictTestBudget(4, recordSize)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, []string{"key-00", "key-01", "key-02", "key-03", "key-04", "key-05"}, recorder.keys)
+	assert.Equal(t, 4*recordSize, db.LiveBytes())
+}
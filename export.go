@@ -0,0 +1,232 @@
+package bcdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// 导出数据的格式
+type ExportFormat byte
+
+const (
+	// 二进制格式：magic|version，之后每条记录为keysize|valuesize|key|value|crc，以0和记录数量结尾
+	ExportBinary ExportFormat = iota
+	// 每行一个JSON对象，key和value使用base64编码
+	ExportJSONLines
+)
+
+// 二进制导出格式的magic和版本号
+var exportMagic = []byte("BCDX")
+
+const exportVersion = 1
+
+// 导入时每个批次写入的记录数
+const importBatchSize = 1000
+
+type ExportOptions struct {
+	Format ExportFormat
+	// 只导出带有该前缀的key，为空表示导出全部
+	Prefix []byte
+}
+
+type ImportOptions struct {
+	// 只导入带有该前缀的key，为空表示导入全部
+	Prefix []byte
+	// 每个批次写入的记录数，小于等于0时使用默认值
+	BatchSize int
+}
+
+// JSON lines格式中的一条记录，[]byte编码为base64
+type exportRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// 将默认列族的数据导出到w，返回导出的记录数
+// 导出基于创建迭代器时的索引快照，导出期间的写入不会影响导出的key
+func (db *DB) Export(w io.Writer, options ExportOptions) (int, error) {
+	if options.Format != ExportBinary && options.Format != ExportJSONLines {
+		return 0, ErrInvalidExportFormat
+	}
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	bw := bufio.NewWriter(w)
+	it := db.NewIterator(IteratorOptions{Prefix: options.Prefix})
+	defer it.Close()
+
+	var writeRecord func(key, value []byte) error
+	switch options.Format {
+	case ExportBinary:
+		if _, err := bw.Write(append(exportMagic, exportVersion)); err != nil {
+			return 0, err
+		}
+		writeRecord = func(key, value []byte) error {
+			return writeExportRecord(bw, key, value)
+		}
+	case ExportJSONLines:
+		encoder := json.NewEncoder(bw)
+		writeRecord = func(key, value []byte) error {
+			return encoder.Encode(&exportRecord{Key: key, Value: value})
+		}
+	}
+
+	var count int
+	for it.ReWind(); it.Valid(); it.Next() {
+		value, err := it.Value()
+		// 创建迭代器之后被删除的key
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := writeRecord(it.Key(), value); err != nil {
+			return count, err
+		}
+		count++
+	}
+	// 二进制格式以0和记录数量结尾，导入时用于检查数据是否完整
+	if options.Format == ExportBinary {
+		buf := make([]byte, 1+binary.MaxVarintLen64)
+		n := binary.PutUvarint(buf[1:], uint64(count))
+		if _, err := bw.Write(buf[:n+1]); err != nil {
+			return count, err
+		}
+	}
+	return count, bw.Flush()
+}
+
+func writeExportRecord(w io.Writer, key, value []byte) error {
+	header := make([]byte, binary.MaxVarintLen64*2)
+	var index int
+	index += binary.PutUvarint(header[index:], uint64(len(key)))
+	index += binary.PutUvarint(header[index:], uint64(len(value)))
+	crc := crc32.ChecksumIEEE(key)
+	crc = crc32.Update(crc, crc32.IEEETable, value)
+	crcBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crcBuf, crc)
+	for _, b := range [][]byte{header[:index], key, value, crcBuf} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从r导入Export导出的数据，根据开头的内容自动识别格式，返回导入的记录数
+// 数据分批写入，导入失败时已经提交的批次不会回滚
+func (db *DB) Import(r io.Reader, options ImportOptions) (int, error) {
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = importBatchSize
+	}
+	br := bufio.NewReader(r)
+
+	var count, pending int
+	wb := db.NewWriteBatch(WriteBatchOptions{MaxBatchSize: uint(batchSize)})
+	put := func(key, value []byte) error {
+		if !bytes.HasPrefix(key, options.Prefix) {
+			return nil
+		}
+		if err := wb.Put(key, value); err != nil {
+			return err
+		}
+		count++
+		pending++
+		if pending < batchSize {
+			return nil
+		}
+		pending = 0
+		return wb.Commit()
+	}
+
+	magic, err := br.Peek(len(exportMagic))
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if bytes.Equal(magic, exportMagic) {
+		err = readBinaryExport(br, put)
+	} else {
+		err = readJSONLinesExport(br, put)
+	}
+	if err != nil {
+		return count - pending, err
+	}
+	if err := wb.Commit(); err != nil {
+		return count - pending, err
+	}
+	return count, db.Sync()
+}
+
+func readBinaryExport(br *bufio.Reader, put func(key, value []byte) error) error {
+	header := make([]byte, len(exportMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return ErrInvalidExportFormat
+	}
+	if header[len(exportMagic)] != exportVersion {
+		return ErrInvalidExportFormat
+	}
+	var read uint64
+	for {
+		keySize, err := binary.ReadUvarint(br)
+		if err != nil {
+			return ErrExportCorrupted
+		}
+		// 结束标识，检查记录数量
+		if keySize == 0 {
+			count, err := binary.ReadUvarint(br)
+			if err != nil || count != read {
+				return ErrExportCorrupted
+			}
+			return nil
+		}
+		valueSize, err := binary.ReadUvarint(br)
+		if err != nil || keySize > math.MaxUint32 || valueSize > math.MaxUint32 {
+			return ErrExportCorrupted
+		}
+		buf := make([]byte, keySize+valueSize+4)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return ErrExportCorrupted
+		}
+		key, value := buf[:keySize], buf[keySize:keySize+valueSize]
+		crc := crc32.ChecksumIEEE(buf[:keySize+valueSize])
+		if crc != binary.LittleEndian.Uint32(buf[keySize+valueSize:]) {
+			return ErrExportCorrupted
+		}
+		if err := put(key, value); err != nil {
+			return err
+		}
+		read++
+	}
+}
+
+func readJSONLinesExport(br *bufio.Reader, put func(key, value []byte) error) error {
+	decoder := json.NewDecoder(br)
+	for {
+		var rec exportRecord
+		if err := decoder.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidExportFormat, err)
+		}
+		if len(rec.Key) == 0 {
+			return ErrInvalidExportFormat
+		}
+		if rec.Value == nil {
+			rec.Value = []byte{}
+		}
+		if err := put(rec.Key, rec.Value); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 导出导入测试 ====================
+
+func dumpStrings(t *testing.T, db *DB) map[string]string {
+	state := make(map[string]string)
+	assert.Nil(t, db.Fold(func(key, value []byte) bool {
+		state[string(key)] = string(value)
+		return true
+	}))
+	return state
+}
+
+func TestDB_ExportImport(t *testing.T) {
+	for _, format := range []ExportFormat{ExportBinary, ExportJSONLines} {
+		src, err := Open(testOptions(t))
+		assert.Nil(t, err)
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, src.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%d", i))))
+		}
+		assert.Nil(t, src.Put([]byte("binary\x00\xff"), []byte{0, 1, 2, 0xff}))
+		assert.Nil(t, src.Put([]byte("empty"), []byte{}))
+		assert.Nil(t, src.Delete([]byte("key-000")))
+
+		var buf bytes.Buffer
+		count, err := src.Export(&buf, ExportOptions{Format: format})
+		assert.Nil(t, err)
+		assert.Equal(t, 101, count)
+
+		dst, err := Open(testOptions(t))
+		assert.Nil(t, err)
+		assert.Nil(t, dst.Put([]byte("existing"), []byte("value")))
+		count, err = dst.Import(bytes.NewReader(buf.Bytes()), ImportOptions{BatchSize: 7})
+		assert.Nil(t, err)
+		assert.Equal(t, 101, count)
+
+		expected := dumpStrings(t, src)
+		expected["existing"] = "value"
+		assert.Equal(t, expected, dumpStrings(t, dst))
+		assert.Nil(t, src.Close())
+		assert.Nil(t, dst.Close())
+	}
+}
+
+func TestDB_ExportFormats(t *testing.T) {
+	db, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, db.Put([]byte("b"), []byte("2")))
+
+	var buf bytes.Buffer
+	_, err = db.Export(&buf, ExportOptions{Format: ExportJSONLines})
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"key\":\"YQ==\",\"value\":\"MQ==\"}\n{\"key\":\"Yg==\",\"value\":\"Mg==\"}\n", buf.String())
+
+	buf.Reset()
+	_, err = db.Export(&buf, ExportOptions{Format: ExportBinary})
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("BCDX\x01\x01\x01a1")))
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte{0, 2}))
+
+	_, err = db.Export(&buf, ExportOptions{Format: ExportFormat(9)})
+	assert.Equal(t, ErrInvalidExportFormat, err)
+}
+
+func TestDB_ExportImportPrefix(t *testing.T) {
+	src, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer src.Close()
+	for _, key := range []string{"user:1", "user:2", "order:1", "order:2", "order:3"} {
+		assert.Nil(t, src.Put([]byte(key), []byte(key)))
+	}
+
+	var buf bytes.Buffer
+	count, err := src.Export(&buf, ExportOptions{Prefix: []byte("order:")})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	// 导入时再次按前缀过滤
+	dst, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer dst.Close()
+	var all bytes.Buffer
+	_, err = src.Export(&all, ExportOptions{Format: ExportJSONLines})
+	assert.Nil(t, err)
+	count, err = dst.Import(&all, ImportOptions{Prefix: []byte("user:")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, map[string]string{"user:1": "user:1", "user:2": "user:2"}, dumpStrings(t, dst))
+
+	count, err = dst.Import(&buf, ImportOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 5, len(dst.ListKeys()))
+}
+
+func TestDB_ImportCorrupted(t *testing.T) {
+	src, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer src.Close()
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, src.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")))
+	}
+	var buf bytes.Buffer
+	_, err = src.Export(&buf, ExportOptions{})
+	assert.Nil(t, err)
+	exported := buf.Bytes()
+
+	dst, err := Open(testOptions(t))
+	assert.Nil(t, err)
+	defer dst.Close()
+
+	// 数据被截断
+	count, err := dst.Import(bytes.NewReader(exported[:len(exported)-1]), ImportOptions{BatchSize: 4})
+	assert.Equal(t, ErrExportCorrupted, err)
+	assert.Equal(t, 8, count)
+
+	// crc校验失败
+	corrupted := append([]byte{}, exported...)
+	corrupted[len(exportMagic)+4] ^= 0xff
+	_, err = dst.Import(bytes.NewReader(corrupted), ImportOptions{})
+	assert.Equal(t, ErrExportCorrupted, err)
+
+	// 不支持的版本
+	corrupted = append([]byte{}, exported...)
+	corrupted[len(exportMagic)] = 9
+	_, err = dst.Import(bytes.NewReader(corrupted), ImportOptions{})
+	assert.Equal(t, ErrInvalidExportFormat, err)
+
+	_, err = dst.Import(strings.NewReader("not json\n"), ImportOptions{})
+	assert.ErrorIs(t, err, ErrInvalidExportFormat)
+	_, err = dst.Import(strings.NewReader("{\"value\":\"MQ==\"}\n"), ImportOptions{})
+	assert.ErrorIs(t, err, ErrInvalidExportFormat)
+
+	count, err = dst.Import(strings.NewReader(""), ImportOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
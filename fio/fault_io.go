@@ -0,0 +1,136 @@
+package fio
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrInjectedFault = errors.New("injected fault")
+
+type FaultOp int8
+
+const (
+	FaultWrite FaultOp = iota
+	FaultSync
+	FaultRead
+	FaultRename
+)
+
+// 故障注入器，被多个FaultIO共享，统计所有文件上的操作次数
+type FaultInjector struct {
+	mu         *sync.Mutex
+	counts     [4]int
+	failAt     [4]int // 第N次操作失败，0表示不注入故障
+	shortWrite bool   // 写入失败时只写入一半的数据
+	crashed    bool   // 模拟崩溃之后所有写入和持久化操作都失败
+}
+
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{mu: new(sync.Mutex)}
+}
+
+// 设置第n次op操作失败，n为0时取消注入
+func (fi *FaultInjector) FailAt(op FaultOp, n int) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.failAt[op] = n
+}
+
+// 设置写入失败时是否写入部分数据
+func (fi *FaultInjector) SetShortWrite(shortWrite bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.shortWrite = shortWrite
+}
+
+// 获取op操作已经执行的次数
+func (fi *FaultInjector) Count(op FaultOp) int {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.counts[op]
+}
+
+// 模拟进程崩溃
+func (fi *FaultInjector) Crash() {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.crashed = true
+}
+
+func (fi *FaultInjector) Crashed() bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.crashed
+}
+
+// 记录一次操作，返回本次操作是否需要失败
+func (fi *FaultInjector) hit(op FaultOp) bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if fi.crashed && op != FaultRead {
+		return true
+	}
+	fi.counts[op]++
+	return fi.counts[op] == fi.failAt[op]
+}
+
+// 记录一次op操作，需要失败时返回ErrInjectedFault，供其他包中的文件系统使用
+func (fi *FaultInjector) Inject(op FaultOp) error {
+	if fi.hit(op) {
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// 支持故障注入的IOManager
+type FaultIO struct {
+	inner    IOManager
+	injector *FaultInjector
+}
+
+func NewFaultIOManager(inner IOManager, injector *FaultInjector) *FaultIO {
+	return &FaultIO{inner: inner, injector: injector}
+}
+
+func (fio *FaultIO) Read(b []byte, offset int64) (int, error) {
+	if fio.injector.hit(FaultRead) {
+		return 0, ErrInjectedFault
+	}
+	return fio.inner.Read(b, offset)
+}
+
+func (fio *FaultIO) Write(b []byte) (int, error) {
+	if fio.injector.hit(FaultWrite) {
+		fio.injector.mu.Lock()
+		shortWrite := fio.injector.shortWrite && !fio.injector.crashed
+		fio.injector.mu.Unlock()
+		if shortWrite && len(b) > 1 {
+			n, _ := fio.inner.Write(b[:len(b)/2])
+			return n, ErrInjectedFault
+		}
+		return 0, ErrInjectedFault
+	}
+	return fio.inner.Write(b)
+}
+
+func (fio *FaultIO) Sync() error {
+	if fio.injector.hit(FaultSync) {
+		return ErrInjectedFault
+	}
+	return fio.inner.Sync()
+}
+
+func (fio *FaultIO) Close() error {
+	return fio.inner.Close()
+}
+
+func (fio *FaultIO) Size() (int64, error) {
+	return fio.inner.Size()
+}
+
+func (fio *FaultIO) Truncate(size int64) error {
+	if fio.injector.Crashed() {
+		return ErrInjectedFault
+	}
+	return fio.inner.Truncate(size)
+}
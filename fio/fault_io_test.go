@@ -0,0 +1,65 @@
+package fio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultIO_FailAt(t *testing.T) {
+	injector := NewFaultInjector()
+	injector.FailAt(FaultWrite, 2)
+	injector.FailAt(FaultSync, 1)
+	fio := NewFaultIOManager(NewMemoryIOManager(NewMemFile()), injector)
+
+	_, err := fio.Write([]byte("first"))
+	assert.Nil(t, err)
+	n, err := fio.Write([]byte("second"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Equal(t, 0, n)
+	_, err = fio.Write([]byte("third"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, ErrInjectedFault, fio.Sync())
+	assert.Nil(t, fio.Sync())
+
+	assert.Equal(t, 3, injector.Count(FaultWrite))
+	assert.Equal(t, 2, injector.Count(FaultSync))
+	size, err := fio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+}
+
+func TestFaultIO_ShortWrite(t *testing.T) {
+	injector := NewFaultInjector()
+	injector.FailAt(FaultWrite, 1)
+	injector.SetShortWrite(true)
+	fio := NewFaultIOManager(NewMemoryIOManager(NewMemFile()), injector)
+
+	n, err := fio.Write([]byte("abcdef"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Equal(t, 3, n)
+
+	buf := make([]byte, 3)
+	_, err = fio.Read(buf, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("abc"), buf)
+}
+
+func TestFaultIO_Crash(t *testing.T) {
+	injector := NewFaultInjector()
+	fio := NewFaultIOManager(NewMemoryIOManager(NewMemFile()), injector)
+	_, err := fio.Write([]byte("data"))
+	assert.Nil(t, err)
+
+	injector.Crash()
+	assert.True(t, injector.Crashed())
+	_, err = fio.Write([]byte("data"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Equal(t, ErrInjectedFault, fio.Sync())
+
+	// 崩溃后仍然可以读取
+	buf := make([]byte, 4)
+	_, err = fio.Read(buf, 0)
+	assert.Nil(t, err)
+}
@@ -8,6 +8,7 @@ type IOManager interface {
 	Sync() error                     // 同步文件数据到磁盘
 	Close() error                    // 关闭文件
 	Size() (int64, error)            // 获取文件大小
+	Truncate(int64) error            // 截断文件到指定大小
 }
 
 func NewIOManager(path string) (IOManager, error) {
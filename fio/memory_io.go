@@ -0,0 +1,92 @@
+package fio
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// 内存中的文件数据，可以被多个MemoryIO共享
+type MemFile struct {
+	mu   *sync.RWMutex
+	data []byte
+}
+
+func NewMemFile() *MemFile {
+	return &MemFile{mu: new(sync.RWMutex)}
+}
+
+// 基于内存的IOManager，数据不会写入磁盘
+type MemoryIO struct {
+	file   *MemFile
+	closed bool
+}
+
+func NewMemoryIOManager(file *MemFile) *MemoryIO {
+	return &MemoryIO{file: file}
+}
+
+func (mio *MemoryIO) Read(b []byte, offset int64) (int, error) {
+	if mio.closed {
+		return 0, os.ErrClosed
+	}
+	mio.file.mu.RLock()
+	defer mio.file.mu.RUnlock()
+
+	if offset >= int64(len(mio.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, mio.file.data[offset:])
+	// 与ReadAt保持一致，读取的数据不足时返回EOF
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mio *MemoryIO) Write(b []byte) (int, error) {
+	if mio.closed {
+		return 0, os.ErrClosed
+	}
+	mio.file.mu.Lock()
+	defer mio.file.mu.Unlock()
+
+	mio.file.data = append(mio.file.data, b...)
+	return len(b), nil
+}
+
+func (mio *MemoryIO) Sync() error {
+	if mio.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (mio *MemoryIO) Close() error {
+	mio.closed = true
+	return nil
+}
+
+func (mio *MemoryIO) Truncate(size int64) error {
+	if mio.closed {
+		return os.ErrClosed
+	}
+	mio.file.mu.Lock()
+	defer mio.file.mu.Unlock()
+
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	if size <= int64(len(mio.file.data)) {
+		mio.file.data = mio.file.data[:size]
+	} else {
+		mio.file.data = append(mio.file.data, make([]byte, size-int64(len(mio.file.data)))...)
+	}
+	return nil
+}
+
+func (mio *MemoryIO) Size() (int64, error) {
+	mio.file.mu.RLock()
+	defer mio.file.mu.RUnlock()
+	return int64(len(mio.file.data)), nil
+}
@@ -0,0 +1,69 @@
+package fio
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryIO_Write(t *testing.T) {
+	mio := NewMemoryIOManager(NewMemFile())
+
+	n, err := mio.Write([]byte("Hello, World!"))
+	assert.Nil(t, err)
+	assert.Equal(t, 13, n)
+
+	n, err = mio.Write([]byte(""))
+	assert.Equal(t, 0, n)
+	assert.Nil(t, err)
+
+	size, err := mio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(13), size)
+}
+
+func TestMemoryIO_Read(t *testing.T) {
+	mio := NewMemoryIOManager(NewMemFile())
+	_, err := mio.Write([]byte("Hello, World!"))
+	assert.Nil(t, err)
+
+	buf := make([]byte, 5)
+	n, err := mio.Read(buf, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, []byte("World"), buf)
+
+	// 读取超过文件末尾
+	n, err = mio.Read(buf, 10)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 3, n)
+
+	_, err = mio.Read(buf, 13)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMemoryIO_SharedFile(t *testing.T) {
+	file := NewMemFile()
+	writer := NewMemoryIOManager(file)
+	_, err := writer.Write([]byte("data"))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	// 关闭之后数据仍然保留，可以重新打开读取
+	reader := NewMemoryIOManager(file)
+	buf := make([]byte, 4)
+	_, err = reader.Read(buf, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), buf)
+}
+
+func TestMemoryIO_Close(t *testing.T) {
+	mio := NewMemoryIOManager(NewMemFile())
+	assert.Nil(t, mio.Sync())
+	assert.Nil(t, mio.Close())
+
+	_, err := mio.Write([]byte("data"))
+	assert.NotNil(t, err)
+	assert.NotNil(t, mio.Sync())
+}
@@ -0,0 +1,145 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"context"
+	"errors"
+)
+
+// 一次组提交中最多合并的写入请求数量
+const maxGroupCommitSize = 256
+
+// 组提交不维护二级索引，存在二级索引时拒绝默认列族的写入，调用方在锁内重新写入
+var errSecondaryIndexesRequired = errors.New("write requires secondary index maintenance")
+
+// 等待组提交的写入请求
+type commitRequest struct {
+	records []*data.LogRecord
+	done    chan error
+	evicted [][]byte // 本组写入之后被淘汰的key，只交给组内第一个请求通知
+}
+
+// 将日志记录交给组提交协程写入，持久化到磁盘并更新内存索引后返回
+func (db *DB) groupCommit(records []*data.LogRecord) error {
+	return db.groupCommitCtx(context.Background(), records)
+}
+
+// 请求被组提交协程接收之前可以取消，接收之后需要等待写入完成，避免调用方无法确定写入结果
+func (db *DB) groupCommitCtx(ctx context.Context, records []*data.LogRecord) error {
+	req := &commitRequest{
+		records: records,
+		done:    make(chan error, 1),
+	}
+	select {
+	case db.commitCh <- req:
+	case <-db.closeCh:
+		return ErrDBClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := <-req.done; err != nil {
+		return err
+	}
+	db.afterWrite(req.evicted)
+	return nil
+}
+
+// 通过组提交写入单条日志记录，需要维护二级索引时在锁内重新写入
+func (db *DB) groupCommitRecord(key []byte, logRecord *data.LogRecord) error {
+	return db.groupCommitRecordCtx(context.Background(), key, logRecord)
+}
+
+func (db *DB) groupCommitRecordCtx(ctx context.Context, key []byte, logRecord *data.LogRecord) error {
+	err := db.groupCommitCtx(ctx, []*data.LogRecord{logRecord})
+	if err == errSecondaryIndexesRequired {
+		return db.appendLogRecordWithLockCtx(ctx, key, logRecord)
+	}
+	return err
+}
+
+// 组提交协程，收集并发的写入请求，一次写入、一次持久化后唤醒所有等待者
+func (db *DB) runGroupCommit() {
+	defer db.bgWg.Done()
+	for {
+		var reqs []*commitRequest
+		select {
+		case req := <-db.commitCh:
+			reqs = append(reqs, req)
+		case <-db.closeCh:
+			return
+		}
+		// 收集已经在等待的写入请求
+	collect:
+		for len(reqs) < maxGroupCommitSize {
+			select {
+			case req := <-db.commitCh:
+				reqs = append(reqs, req)
+			default:
+				break collect
+			}
+		}
+
+		reqs, evicted, err := db.commitGroup(reqs)
+		if len(reqs) > 0 {
+			reqs[0].evicted = evicted
+		}
+		for _, req := range reqs {
+			req.done <- err
+		}
+	}
+}
+
+// 写入组内的请求，返回实际写入的请求，需要维护二级索引的请求直接返回errSecondaryIndexesRequired
+func (db *DB) commitGroup(reqs []*commitRequest) ([]*commitRequest, [][]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return reqs, nil, ErrDBClosed
+	}
+
+	// 在写入的同一把锁内判断是否存在二级索引，避免与RegisterIndex交错
+	var records []*data.LogRecord
+	committed := reqs[:0]
+	for _, req := range reqs {
+		if db.requestNeedsSecondaryIndexes(req) {
+			req.done <- errSecondaryIndexesRequired
+			continue
+		}
+		committed = append(committed, req)
+		records = append(records, req.records...)
+	}
+	if len(records) == 0 {
+		return committed, nil, nil
+	}
+	positions, err := db.appendLogRecords(records)
+	if err != nil {
+		return committed, nil, err
+	}
+	if err := db.syncActiveFile(); err != nil {
+		return committed, nil, err
+	}
+
+	// 数据持久化之后再更新内存索引
+	for i, rec := range records {
+		if rec.Type == data.LogRecordTxnFin {
+			continue
+		}
+		realKey, _ := parseLogRecordKey(rec.Key)
+		if err := db.updateIndex(rec.CF, realKey, rec.Type, positions[i], rec.Version); err != nil {
+			return committed, nil, err
+		}
+	}
+	evicted, err := db.evictOverBudget()
+	return committed, evicted, err
+}
+
+// 调用方需持有db.mu
+func (db *DB) requestNeedsSecondaryIndexes(req *commitRequest) bool {
+	for _, rec := range req.records {
+		if db.needsSecondaryIndexes(rec) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package bcdb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 组提交测试 ====================
+
+// 测试并发的同步写入全部成功并且可以持久化
+func TestGroupCommit_ConcurrentSyncWrite(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncWrite = true
+	opts.MaxFileSize = 8 * 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := []byte(fmt.Sprintf("key_%d_%d", g, i))
+				assert.Nil(t, db.Put(key, []byte(fmt.Sprintf("value_%d_%d", g, i))))
+				// 写入成功后立即可读
+				val, err := db.Get(key)
+				assert.Nil(t, err)
+				assert.Equal(t, []byte(fmt.Sprintf("value_%d_%d", g, i)), val)
+			}
+			assert.Nil(t, db.Delete([]byte(fmt.Sprintf("key_%d_0", g))))
+		}(g)
+	}
+	wg.Wait()
+	assert.True(t, len(db.olderFiles) > 0)
+	assert.Nil(t, db.Close())
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+	assert.Equal(t, 16*49, len(db2.ListKeys()))
+	for g := 0; g < 16; g++ {
+		_, err := db2.Get([]byte(fmt.Sprintf("key_%d_0", g)))
+		assert.Equal(t, ErrKeyNotFound, err)
+		for i := 1; i < 50; i++ {
+			val, err := db2.Get([]byte(fmt.Sprintf("key_%d_%d", g, i)))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("value_%d_%d", g, i)), val)
+		}
+	}
+}
+
+// 测试同步提交的 WriteBatch 与同步写入的 Put 并发执行
+func TestGroupCommit_WriteBatch(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncWrite = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+			for i := 0; i < 10; i++ {
+				assert.Nil(t, wb.Put([]byte(fmt.Sprintf("batch_%d_%d", g, i)), []byte("v")))
+			}
+			assert.Nil(t, wb.Commit())
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("put_%d", g)), []byte("v")))
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 88, len(db.ListKeys()))
+	assert.Equal(t, uint64(8), db.seqNo)
+	assert.Nil(t, db.Close())
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+	assert.Equal(t, 88, len(db2.ListKeys()))
+}
+
+// 测试关闭后的同步写入返回错误
+func TestGroupCommit_AfterClose(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncWrite = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	assert.Nil(t, db.Close())
+
+	err = db.groupCommit(nil)
+	assert.Equal(t, ErrDBClosed, err)
+}
@@ -60,6 +60,26 @@ func (bt *BTree) Delete(key []byte) bool {
 	return true
 }
 
+func (bt *BTree) DeleteRange(start, end []byte) [][]byte {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	var items []btree.Item
+	bt.tree.AscendGreaterOrEqual(&Item{key: start}, func(it btree.Item) bool {
+		if len(end) > 0 && bytes.Compare(it.(*Item).key, end) >= 0 {
+			return false
+		}
+		items = append(items, it)
+		return true
+	})
+	keys := make([][]byte, 0, len(items))
+	for _, item := range items {
+		bt.tree.Delete(item)
+		keys = append(keys, item.(*Item).key)
+	}
+	return keys
+}
+
 func (bt *BTree) Iterator(reverse bool) Interator {
 	if bt.tree == nil {
 		return nil
@@ -76,6 +96,15 @@ type bTreeInterator struct {
 	values    []*Item // 存储迭代的值->key + pos
 }
 
+func (bt *BTree) RangeIterator(lower, upper []byte, reverse bool) Interator {
+	if bt.tree == nil {
+		return nil
+	}
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return newBTreeRangeIterator(bt.tree, lower, upper, reverse)
+}
+
 func NewBTreeIterator(tree *btree.BTree, reverse bool) *bTreeInterator {
 	var idx int
 	values := make([]*Item, tree.Len())
@@ -100,6 +129,49 @@ func NewBTreeIterator(tree *btree.BTree, reverse bool) *bTreeInterator {
 	}
 }
 
+// 只复制范围内的元素，离开范围后立即停止遍历
+func newBTreeRangeIterator(tree *btree.BTree, lower, upper []byte, reverse bool) *bTreeInterator {
+	var values []*Item
+	if reverse {
+		visit := func(it btree.Item) bool {
+			item := it.(*Item)
+			if len(upper) > 0 && bytes.Compare(item.key, upper) >= 0 {
+				return true
+			}
+			if len(lower) > 0 && bytes.Compare(item.key, lower) < 0 {
+				return false
+			}
+			values = append(values, item)
+			return true
+		}
+		if len(upper) > 0 {
+			tree.DescendLessOrEqual(&Item{key: upper}, visit)
+		} else {
+			tree.Descend(visit)
+		}
+	} else {
+		visit := func(it btree.Item) bool {
+			item := it.(*Item)
+			if len(upper) > 0 && bytes.Compare(item.key, upper) >= 0 {
+				return false
+			}
+			values = append(values, item)
+			return true
+		}
+		if len(lower) > 0 {
+			tree.AscendGreaterOrEqual(&Item{key: lower}, visit)
+		} else {
+			tree.Ascend(visit)
+		}
+	}
+
+	return &bTreeInterator{
+		currIndex: 0,
+		reverse:   reverse,
+		values:    values,
+	}
+}
+
 func (it *bTreeInterator) ReWind() {
 	it.currIndex = 0
 }
@@ -2,6 +2,7 @@ package index
 
 import (
 	"bcdb/data"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -265,3 +266,69 @@ func TestBTree_Iterator_LargeData(t *testing.T) {
 	}
 	assert.Equal(t, 100, count)
 }
+
+// ==================== 范围迭代器测试 ====================
+
+func collectKeys(iter Interator) []string {
+	var keys []string
+	for iter.ReWind(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	return keys
+}
+
+func TestBTree_RangeIterator(t *testing.T) {
+	bt := NewBTree()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		bt.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: 1})
+	}
+
+	assert.Equal(t, []string{"b", "c", "d"}, collectKeys(bt.RangeIterator([]byte("b"), []byte("e"), false)))
+	assert.Equal(t, []string{"d", "c", "b"}, collectKeys(bt.RangeIterator([]byte("b"), []byte("e"), true)))
+	assert.Equal(t, []string{"a", "b"}, collectKeys(bt.RangeIterator(nil, []byte("c"), false)))
+	assert.Equal(t, []string{"b", "a"}, collectKeys(bt.RangeIterator(nil, []byte("c"), true)))
+	assert.Equal(t, []string{"d", "e"}, collectKeys(bt.RangeIterator([]byte("d"), nil, false)))
+	assert.Equal(t, []string{"e", "d"}, collectKeys(bt.RangeIterator([]byte("d"), nil, true)))
+	assert.Equal(t, 5, len(collectKeys(bt.RangeIterator(nil, nil, false))))
+
+	// 范围不在树中
+	assert.Equal(t, 0, len(collectKeys(bt.RangeIterator([]byte("x"), []byte("z"), false))))
+	assert.Equal(t, 0, len(collectKeys(bt.RangeIterator([]byte("c"), []byte("c"), true))))
+	// 上下界不在树中
+	assert.Equal(t, []string{"c", "d"}, collectKeys(bt.RangeIterator([]byte("bb"), []byte("dd"), false)))
+	assert.Equal(t, []string{"d", "c"}, collectKeys(bt.RangeIterator([]byte("bb"), []byte("dd"), true)))
+}
+
+func TestBTree_RangeIterator_Seek(t *testing.T) {
+	bt := NewBTree()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		bt.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: 1})
+	}
+
+	iter := bt.RangeIterator([]byte("b"), []byte("e"), false)
+	iter.Seek([]byte("a"))
+	assert.Equal(t, []byte("b"), iter.Key())
+	iter.Seek([]byte("cc"))
+	assert.Equal(t, []byte("d"), iter.Key())
+	iter.Seek([]byte("e"))
+	assert.False(t, iter.Valid())
+
+	iter = bt.RangeIterator([]byte("b"), []byte("e"), true)
+	iter.Seek([]byte("z"))
+	assert.Equal(t, []byte("d"), iter.Key())
+	iter.Seek([]byte("a"))
+	assert.False(t, iter.Valid())
+}
+
+// 范围迭代器只复制范围内的元素
+func TestBTree_RangeIterator_Size(t *testing.T) {
+	bt := NewBTree()
+	for i := 0; i < 10000; i++ {
+		bt.Put([]byte(fmt.Sprintf("key-%05d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	iter := bt.RangeIterator([]byte("key-01000"), []byte("key-01010"), false).(*bTreeInterator)
+	assert.Equal(t, 10, len(iter.values))
+	iter = bt.RangeIterator([]byte("key-01000"), []byte("key-01010"), true).(*bTreeInterator)
+	assert.Equal(t, 10, len(iter.values))
+}
@@ -48,3 +48,25 @@ func TestBTree_Delete(t *testing.T) {
 	res4 := bt.Delete([]byte("hello"))
 	assert.True(t, res4)
 }
+
+func TestBTree_DeleteRange(t *testing.T) {
+	bt := NewBTree()
+	for _, key := range []string{"a", "b", "ba", "bz", "c", "d"} {
+		bt.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: 1})
+	}
+
+	deleted := bt.DeleteRange([]byte("b"), []byte("c"))
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("ba"), []byte("bz")}, deleted)
+	assert.Equal(t, 3, bt.Size())
+	assert.Nil(t, bt.Get([]byte("ba")))
+	assert.NotNil(t, bt.Get([]byte("c")))
+
+	// 空范围
+	assert.Equal(t, 0, len(bt.DeleteRange([]byte("x"), []byte("z"))))
+
+	// end为空时删除start之后的全部key
+	deleted = bt.DeleteRange([]byte("c"), nil)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("d")}, deleted)
+	assert.Equal(t, 1, bt.Size())
+	assert.NotNil(t, bt.Get([]byte("a")))
+}
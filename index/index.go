@@ -8,8 +8,12 @@ type Indexer interface {
 	Put(key []byte, pos *data.LogRecordPos) bool
 	Get(key []byte) *data.LogRecordPos
 	Delete(key []byte) bool
+	// 删除[start, end)范围内的key，end为空时删除start之后的全部key，返回被删除的key
+	DeleteRange(start, end []byte) [][]byte
 
 	Iterator(reverse bool) Interator
+	// 只遍历[lower, upper)范围内的key，lower或upper为空表示不限制
+	RangeIterator(lower, upper []byte, reverse bool) Interator
 	Size() int // 返回索引数量
 }
 type IndexType = int8
@@ -1,68 +1,134 @@
 package bcdb
 
 import (
+	"bcdb/data"
 	"bcdb/index"
 	"bytes"
+	"context"
 )
 
 type Iterator struct {
 	indexIter index.Interator
 	db        *DB
 	Options   IteratorOptions
+	valueBuf  []byte // 读取value时复用的缓冲区
+	cf        uint32 // 迭代的列族
+	ctx       context.Context
+	mergeGen  uint64 // 创建时DB的mergeGen，merge直接替换数据文件之后索引中的位置失效
 }
 
+// 迭代器只包含Prefix和[LowerBound, UpperBound)范围内的key
 func (db *DB) NewIterator(options IteratorOptions) *Iterator {
-	iterator := db.index.Iterator(options.Reverse)
-	it := &Iterator{
-		indexIter: iterator,
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.newIterator(db.index, DefaultCFID, options)
+}
+
+// 调用方需持有db.mu
+func (db *DB) newIterator(idx index.Indexer, cf uint32, options IteratorOptions) *Iterator {
+	lower, upper := iteratorBounds(options)
+	return &Iterator{
+		indexIter: idx.RangeIterator(lower, upper, options.Reverse),
 		db:        db,
 		Options:   options,
+		cf:        cf,
+		ctx:       context.Background(),
+		mergeGen:  db.mergeGen,
 	}
-	it.filterPrefix()
-	return it
+}
+
+// 根据Prefix和上下界计算迭代范围
+func iteratorBounds(options IteratorOptions) ([]byte, []byte) {
+	lower, upper := options.LowerBound, options.UpperBound
+	if len(options.Prefix) == 0 {
+		return lower, upper
+	}
+	if bytes.Compare(options.Prefix, lower) > 0 {
+		lower = options.Prefix
+	}
+	if end := prefixEnd(options.Prefix); end != nil && (len(upper) == 0 || bytes.Compare(end, upper) < 0) {
+		upper = end
+	}
+	// 范围为空
+	if len(upper) > 0 && bytes.Compare(lower, upper) >= 0 {
+		upper = lower
+	}
+	return lower, upper
 }
 
 func (it *Iterator) ReWind() {
 	it.indexIter.ReWind()
-	it.filterPrefix()
 }
 
 func (it *Iterator) Seek(key []byte) {
 	it.indexIter.Seek(key)
-	it.filterPrefix()
 }
 
 func (it *Iterator) Next() {
 	it.indexIter.Next()
-	it.filterPrefix()
 }
 
 func (it *Iterator) Valid() bool {
-	return it.indexIter.Valid()
+	return it.ctx.Err() == nil && it.indexIter.Valid()
+}
+
+// 迭代器的context被取消时返回ctx.Err()
+func (it *Iterator) Err() error {
+	return it.ctx.Err()
 }
 
 func (it *Iterator) Key() []byte {
 	return it.indexIter.Key()
 }
 
+// 返回的value复用迭代器的缓冲区，只在下一次调用Value之前有效
 func (it *Iterator) Value() ([]byte, error) {
-	pos := it.indexIter.Value()
-	return it.db.getValueByPos(pos)
-}
+	if it.Options.KeysOnly {
+		return nil, ErrIteratorKeysOnly
+	}
+	if err := it.db.rlockCtx(it.ctx); err != nil {
+		return nil, err
+	}
+	defer it.db.mu.RUnlock()
+	if it.mergeGen != it.db.mergeGen {
+		return nil, ErrIteratorInvalidated
+	}
 
-func (it *Iterator) Close() {
-	it.indexIter.Close()
+	key, pos := it.Key(), it.indexIter.Value()
+	if chain := it.db.operands[string(key)]; it.cf == DefaultCFID && chain != nil {
+		return it.db.mergeOperands(key, chain)
+	}
+	logRecord, err := it.db.readLogRecord(pos, it.valueBuf)
+	if err != nil {
+		return nil, err
+	}
+	switch logRecord.Type {
+	case data.LogRecordDeleted:
+		return nil, ErrKeyNotFound
+	case data.LogRecordBlob:
+		return it.db.readBlobValue(data.DecodeBlobRef(logRecord.Value))
+	}
+	if cap(logRecord.Key) > cap(it.valueBuf) {
+		it.valueBuf = logRecord.Key[:0]
+	}
+	return logRecord.Value, nil
 }
 
-func (it *Iterator) filterPrefix() {
-	prefixLen := len(it.Options.Prefix)
-	if prefixLen == 0 {
-		return
+// 当前key最后一次写入的时间和元数据，KeysOnly模式下也可以读取
+func (it *Iterator) Meta() (*RecordMeta, error) {
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
+	if it.mergeGen != it.db.mergeGen {
+		return nil, ErrIteratorInvalidated
 	}
-	for ; it.indexIter.Valid(); it.indexIter.Next() {
-		key := it.indexIter.Key()
-		if prefixLen <= len(key) && bytes.HasPrefix(key, it.Options.Prefix) {
-			break
-		}
+
+	logRecord, err := it.db.getLogRecordByPos(it.indexIter.Value())
+	if err != nil {
+		return nil, err
 	}
+	return newRecordMeta(logRecord), nil
+}
+
+func (it *Iterator) Close() {
+	it.indexIter.Close()
 }
@@ -600,3 +600,128 @@ func TestIterator_Close(t *testing.T) {
 	// Close 不应该 panic
 	// 注意：实际使用中，Close 后不应该再访问迭代器
 }
+
+// ==================== 上下界与只读key测试 ====================
+
+func iterKeys(it *Iterator) []string {
+	var keys []string
+	for it.ReWind(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	return keys
+}
+
+func TestIterator_Bounds(t *testing.T) {
+	db := createTestDB(t)
+	defer destroyTestDB(t, db)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		assert.Nil(t, db.Put([]byte(key), []byte("value-"+key)))
+	}
+
+	it := db.NewIterator(IteratorOptions{LowerBound: []byte("b"), UpperBound: []byte("d")})
+	assert.Equal(t, []string{"b", "c"}, iterKeys(it))
+	it.Close()
+
+	it = db.NewIterator(IteratorOptions{LowerBound: []byte("b"), UpperBound: []byte("d"), Reverse: true})
+	assert.Equal(t, []string{"c", "b"}, iterKeys(it))
+	it.Close()
+
+	it = db.NewIterator(IteratorOptions{LowerBound: []byte("c")})
+	assert.Equal(t, []string{"c", "d", "e"}, iterKeys(it))
+	it.Close()
+
+	it = db.NewIterator(IteratorOptions{UpperBound: []byte("c"), Reverse: true})
+	assert.Equal(t, []string{"b", "a"}, iterKeys(it))
+	it.Close()
+
+	// Seek不会越过上下界
+	it = db.NewIterator(IteratorOptions{LowerBound: []byte("b"), UpperBound: []byte("d")})
+	it.Seek([]byte("a"))
+	assert.Equal(t, []byte("b"), it.Key())
+	it.Seek([]byte("d"))
+	assert.False(t, it.Valid())
+	it.Close()
+}
+
+func TestIterator_PrefixAndBounds(t *testing.T) {
+	db := createTestDB(t)
+	defer destroyTestDB(t, db)
+	for _, key := range []string{"user/1", "user/2", "user/3", "user0", "users", "v"} {
+		assert.Nil(t, db.Put([]byte(key), []byte("value")))
+	}
+
+	it := db.NewIterator(IteratorOptions{Prefix: []byte("user/")})
+	assert.Equal(t, []string{"user/1", "user/2", "user/3"}, iterKeys(it))
+	it.Close()
+
+	// 前缀与上下界取交集
+	it = db.NewIterator(IteratorOptions{Prefix: []byte("user/"), LowerBound: []byte("user/2")})
+	assert.Equal(t, []string{"user/2", "user/3"}, iterKeys(it))
+	it.Close()
+
+	it = db.NewIterator(IteratorOptions{Prefix: []byte("user/"), UpperBound: []byte("user/3"), Reverse: true})
+	assert.Equal(t, []string{"user/2", "user/1"}, iterKeys(it))
+	it.Close()
+
+	// 交集为空
+	it = db.NewIterator(IteratorOptions{Prefix: []byte("user/"), LowerBound: []byte("v")})
+	assert.False(t, it.Valid())
+	it.Close()
+	it = db.NewIterator(IteratorOptions{Prefix: []byte("user/"), UpperBound: []byte("a")})
+	assert.False(t, it.Valid())
+	it.Close()
+}
+
+func TestIteratorBounds(t *testing.T) {
+	lower, upper := iteratorBounds(IteratorOptions{Prefix: []byte("ab")})
+	assert.Equal(t, []byte("ab"), lower)
+	assert.Equal(t, []byte("ac"), upper)
+
+	lower, upper = iteratorBounds(IteratorOptions{Prefix: []byte{0xff}, UpperBound: nil})
+	assert.Equal(t, []byte{0xff}, lower)
+	assert.Nil(t, upper)
+
+	lower, upper = iteratorBounds(IteratorOptions{Prefix: []byte("ab"), LowerBound: []byte("aa"), UpperBound: []byte("abc")})
+	assert.Equal(t, []byte("ab"), lower)
+	assert.Equal(t, []byte("abc"), upper)
+}
+
+func TestIterator_KeysOnly(t *testing.T) {
+	db := createTestDB(t)
+	defer destroyTestDB(t, db)
+	assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, db.Put([]byte("b"), []byte("2")))
+
+	it := db.NewIterator(IteratorOptions{KeysOnly: true})
+	defer it.Close()
+	assert.Equal(t, []string{"a", "b"}, iterKeys(it))
+	it.ReWind()
+	_, err := it.Value()
+	assert.Equal(t, ErrIteratorKeysOnly, err)
+}
+
+func TestIterator_ValueBufferReuse(t *testing.T) {
+	db := createTestDB(t)
+	defer destroyTestDB(t, db)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	it := db.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+	var first []byte
+	i := 0
+	for it.ReWind(); it.Valid(); it.Next() {
+		value, err := it.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("value-%d", i), string(value))
+		if first == nil {
+			first = value
+		} else {
+			// 大小相同的value复用同一块缓冲区
+			assert.True(t, &first[0] == &value[0])
+		}
+		i++
+	}
+	assert.Equal(t, 10, i)
+}
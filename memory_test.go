@@ -0,0 +1,232 @@
+package bcdb
+
+import (
+	"bcdb/vfs"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 内存模式测试 ====================
+
+// 测试内存模式下的读写、文件切换和大value，不会在磁盘上创建任何文件
+func TestInMemory_Basic(t *testing.T) {
+	opts := testOptions(t)
+	opts.InMemory = true
+	opts.MaxFileSize = 1024
+	opts.BlobThreshold = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	assert.Nil(t, db.Delete([]byte("key_0")))
+	value := bytes.Repeat([]byte("blob"), 1024)
+	assert.Nil(t, db.PutStream([]byte("blob"), bytes.NewReader(value)))
+	assert.True(t, len(db.olderFiles) > 0)
+
+	_, err = db.Get([]byte("key_0"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	for i := 1; i < 100; i++ {
+		val, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), val)
+	}
+	r, err := db.GetStream([]byte("blob"))
+	assert.Nil(t, err)
+	val, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	assert.Nil(t, r.Close())
+
+	_, err = os.Stat(opts.DirPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// 测试内存模式下的merge，以及使用同一个内存文件系统重新打开
+func TestInMemory_MergeAndReopen(t *testing.T) {
+	opts := testOptions(t)
+	opts.InMemory = true
+	opts.MaxFileSize = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i%50)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	_, err = os.Stat(db.getMergePath())
+	assert.True(t, os.IsNotExist(err))
+
+	opts.FS = db.fs
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+
+	ok, err := db2.fs.Exists(db2.getMergePath())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 50, len(db2.ListKeys()))
+	for i := 150; i < 200; i++ {
+		val, err := db2.Get([]byte(fmt.Sprintf("key_%d", i%50)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), val)
+	}
+}
+
+// 测试内存模式下merge完成后直接替换旧文件，不需要重新打开
+func TestInMemory_MergeInPlace(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bcdb-test-in-memory-merge-in-place"
+	opts.InMemory = true
+	opts.MaxFileSize = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i%50)), []byte(fmt.Sprintf("value_%d", i))))
+		assert.Nil(t, users.Put([]byte(fmt.Sprintf("user_%d", i%10)), []byte(fmt.Sprintf("user_%d", i))))
+	}
+	assert.Nil(t, db.Delete([]byte("key_0")))
+	iter := db.NewIterator(DefaultIteratorOptions)
+	defer iter.Close()
+	sizeBeforeMerge := db.dataFilesSize()
+
+	assert.Nil(t, db.Merge())
+	assert.Less(t, db.dataFilesSize(), sizeBeforeMerge/2)
+	ok, err := db.fs.Exists(db.getMergePath())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// merge之前创建的迭代器不再可用
+	assert.True(t, iter.Valid())
+	_, err = iter.Value()
+	assert.Equal(t, ErrIteratorInvalidated, err)
+
+	check := func() {
+		assert.Equal(t, 49, len(db.ListKeys()))
+		_, err := db.Get([]byte("key_0"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		for i := 150; i < 200; i++ {
+			if i%50 == 0 {
+				continue
+			}
+			value, err := db.Get([]byte(fmt.Sprintf("key_%d", i%50)))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), value)
+		}
+		value, err := users.Get([]byte("user_9"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("user_199"), value)
+	}
+	check()
+
+	// merge之后可以继续写入并再次merge
+	assert.Nil(t, db.Put([]byte("after-merge"), []byte("value")))
+	assert.Nil(t, db.Merge())
+	value, err := db.Get([]byte("after-merge"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Nil(t, db.Delete([]byte("after-merge")))
+	check()
+}
+
+// 内存模式下merge替换索引时，与并发的读写和迭代器创建不会产生数据竞争
+func TestInMemory_MergeConcurrent(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bcdb-test-in-memory-merge-concurrent"
+	opts.InMemory = true
+	opts.MaxFileSize = 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+					fn(i)
+				}
+			}
+		}()
+	}
+	// 删除不存在的key和创建迭代器都不会写入，只读取索引
+	run(func(i int) {
+		assert.Nil(t, db.Delete([]byte("missing")))
+		assert.Nil(t, users.Delete([]byte("missing")))
+	})
+	run(func(i int) {
+		wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+		assert.Nil(t, wb.Delete([]byte("missing")))
+		assert.Nil(t, wb.Commit())
+	})
+	run(func(i int) {
+		db.NewIterator(DefaultIteratorOptions).Close()
+		users.NewIterator(DefaultIteratorOptions).Close()
+	})
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i%20))
+		assert.Nil(t, db.Put(key, []byte("value")))
+		assert.Nil(t, users.Put(key, []byte("value")))
+		assert.Nil(t, db.Merge())
+	}
+	close(done)
+	wg.Wait()
+}
+
+// ==================== 自定义文件系统测试 ====================
+
+// 测试通过Options.FS将数据目录限制在沙箱目录中
+func TestOptionsFS_SubFS(t *testing.T) {
+	memFS := vfs.NewMemFS()
+	opts := DefaultOptions
+	opts.DirPath = "/bcdb-test-sub-fs"
+	opts.MaxFileSize = 1024
+	opts.FS = vfs.NewSubFS(memFS, "/sandbox")
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	names, err := memFS.ReadDir("/sandbox/bcdb-test-sub-fs")
+	assert.Nil(t, err)
+	assert.True(t, len(names) > 0)
+	ok, err := memFS.Exists("/bcdb-test-sub-fs")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+	assert.Equal(t, 100, len(db2.ListKeys()))
+	ok, err = memFS.Exists("/sandbox/bcdb-test-sub-fs" + MergeDirName)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
@@ -2,12 +2,14 @@ package bcdb
 
 import (
 	"bcdb/data"
+	"bcdb/index"
+	"context"
 	"io"
-	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"time"
 )
 
 const (
@@ -16,36 +18,67 @@ const (
 )
 
 func (db *DB) Merge() error {
+	return db.merge(context.Background(), nil)
+}
+
+// family不为nil时只回收该列族中失效记录占用的空间，其他列族的记录原样保留
+func (db *DB) merge(ctx context.Context, family *ColumnFamily) (err error) {
+	start := time.Now()
+	if err := db.lockCtx(ctx); err != nil {
+		return err
+	}
 	// 没有数据文件的情况
 	if db.activeFile == nil {
+		db.mu.Unlock()
 		return nil
 	}
-	db.mu.Lock()
 	// 如果正在合并，返回错误
 	if db.isMerge {
 		db.mu.Unlock()
 		return ErrMergeInProgress
 	}
 	db.isMerge = true
+	// merge之后无法回收的磁盘空间
+	var mergedSize int64
 	defer func() {
+		db.mu.Lock()
+		// 内存模式下没有下一次启动，设置了磁盘预算时需要立即释放空间，mergeDB关闭之后直接替换旧文件
+		if err == nil && (db.options.InMemory || db.options.MaxDiskBytes > 0) {
+			err = db.applyMergeInPlace()
+			db.evictMergeSize = mergedSize
+		}
 		db.isMerge = false
 		db.mu.Unlock()
 	}()
 
-	// 持久化当前活跃文件
-	if err := db.activeFile.Sync(); err != nil {
+	// 持久化当前活跃文件并保存到旧文件当中
+	if err := db.rotateActiveFile(); err != nil {
 		db.mu.Unlock()
 		return err
 	}
-	// 保存到旧文件当中
-	db.olderFiles[db.activeFile.Fid] = db.activeFile
 
-	if err := db.setActiveFile(); err != nil {
-		db.mu.Unlock()
-		return err
+	// 新的活跃文件不参与merge
+	nonMergeFid := db.activeFile.Fid
+
+	// 记录merge开始时的blob文件状态，之后写入的blob不会被清理
+	nextBlobID := db.nextBlobID
+	pendingBlobs := make(map[uint32]struct{}, len(db.pendingBlobs))
+	for blobID := range db.pendingBlobs {
+		pendingBlobs[blobID] = struct{}{}
+	}
+	referencedBlobs := make(map[uint32]struct{})
+
+	// 记录merge开始时的合并操作数，这些操作数都在参与merge的文件中
+	mergeChains := make(map[string]*operandChain, len(db.operands))
+	for key, chain := range db.operands {
+		mergeChains[key] = &operandChain{
+			base:     chain.base,
+			operands: append([]*data.LogRecordPos(nil), chain.operands...),
+		}
 	}
 
-	finFid := db.activeFile.Fid
+	// 记录保留时间内的历史版本，这些记录原样写入merge文件
+	retainedVersions := db.retainedVersions()
 
 	var mergeFiles []*data.DataFile
 	for _, file := range db.olderFiles {
@@ -53,6 +86,13 @@ func (db *DB) Merge() error {
 	}
 
 	db.mu.Unlock()
+
+	db.notifyMergeBegin(len(mergeFiles))
+	var reclaimed int64
+	defer func() {
+		db.notifyMergeEnd(time.Since(start), reclaimed, err)
+	}()
+
 	// 对需要merge的datafile进行排序
 	sort.Slice(mergeFiles, func(i, j int) bool {
 		return mergeFiles[i].Fid < mergeFiles[j].Fid
@@ -60,12 +100,14 @@ func (db *DB) Merge() error {
 
 	mergePath := db.getMergePath()
 	// 如果Merge目录存在，删除后重新创建
-	if _, err := os.Stat(mergePath); err == nil {
-		if err := os.RemoveAll(mergePath); err != nil {
+	if ok, err := db.fs.Exists(mergePath); err != nil {
+		return err
+	} else if ok {
+		if err := db.fs.RemoveAll(mergePath); err != nil {
 			return err
 		}
 	}
-	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+	if err := db.fs.MkdirAll(mergePath); err != nil {
 		return err
 	}
 
@@ -73,20 +115,29 @@ func (db *DB) Merge() error {
 	mergeOptions := db.options
 	mergeOptions.DirPath = mergePath
 	mergeOptions.SyncWrite = false
+	mergeOptions.SyncInterval = 0
+	mergeOptions.FS = db.fs
+	// 写入的记录保留原有的版本号
+	mergeOptions.KeepVersions = false
+	mergeOptions.Metrics = nil
+	mergeOptions.Logger = nil
+	mergeOptions.EventListener = nil
+	mergeOptions.CacheSize = 0
+	mergeOptions.MaxDiskBytes = 0
+	mergeOptions.OnEvict = nil
 
 	mergeDB, err := Open(mergeOptions)
 	if err != nil {
 		return err
 	}
-	// 打开hint文件存储索引
-	hintFile, err := data.OpenHintFile(mergePath)
-	if err != nil {
-		return err
-	}
+	defer mergeDB.Close()
 
 	for _, dataFile := range mergeFiles {
-		var offset int64 = 0
+		offset := data.FileHeaderSize
 		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			logRecord, size, err := dataFile.ReadLogRecord(offset)
 			if err != nil {
 				if err == io.EOF {
@@ -96,41 +147,79 @@ func (db *DB) Merge() error {
 			}
 			// 解析日志记录的Key
 			realKey, _ := parseLogRecordKey(logRecord.Key)
-			logRecord.Key = realKey
-
-			// 与索引中的数据进行比较
-			logRecordPos := db.index.Get(realKey)
-			if logRecordPos != nil && logRecordPos.Fid == dataFile.Fid && logRecordPos.Offset == offset {
-				// 清除事务标记
-				pos, err := mergeDB.appendLogRecord(logRecord)
-				if err != nil {
+
+			pos := &data.LogRecordPos{Fid: dataFile.Fid, Offset: offset}
+			chain := mergeChains[string(realKey)]
+			_, retained := retainedVersions[*pos]
+			switch {
+			case family != nil && (logRecord.CF != family.id || logRecord.Type == data.LogRecordTxnFin):
+				// 不属于本次merge的记录连同事务标识原样写入，重启后按原有的顺序重建索引
+				if _, err := mergeDB.appendLogRecord(logRecord); err != nil {
+					return err
+				}
+				if logRecord.Type == data.LogRecordBlob {
+					referencedBlobs[data.DecodeBlobRef(logRecord.Value).ID] = struct{}{}
+				}
+			case retained:
+				// 历史版本以及删除标识都原样保留，重启后按顺序重建版本链
+				logRecord.Key = logRecordWithSeqNo(realKey, NonTxnSeqNo)
+				if _, err := mergeDB.appendLogRecord(logRecord); err != nil {
 					return err
 				}
-				// 将位置索引写入到hint文件中
-				if err := hintFile.WriteHintRecord(realKey, pos); err != nil {
+				if logRecord.Type == data.LogRecordBlob {
+					referencedBlobs[data.DecodeBlobRef(logRecord.Value).ID] = struct{}{}
+				}
+			case logRecord.Type == data.LogRecordRangeDeleted:
+				// 被范围删除的数据不会写入merge文件，范围删除标识不再需要
+			case logRecord.CF != DefaultCFID:
+				// 其他列族的记录与所属列族的索引进行比较，同时清理过期的二级索引数据
+				if db.isLiveRecord(logRecord.CF, realKey, pos) && !db.isStaleIndexEntry(logRecord.CF, realKey) {
+					logRecord.Key = logRecordWithSeqNo(realKey, NonTxnSeqNo)
+					if _, err := mergeDB.appendLogRecord(logRecord); err != nil {
+						return err
+					}
+				}
+			case chain != nil:
+				// 在最后一个操作数的位置写入合并后的value，其余记录直接丢弃
+				if samePos(chain.operands[len(chain.operands)-1], pos) {
+					if err := db.mergeOperandChain(mergeDB, realKey, chain, referencedBlobs); err != nil {
+						return err
+					}
+				}
+			case db.isLiveRecord(DefaultCFID, realKey, pos):
+				// 清除事务标记，hint记录由mergeDB在写入时生成
+				logRecord.Key = logRecordWithSeqNo(realKey, NonTxnSeqNo)
+				if _, err := mergeDB.appendLogRecord(logRecord); err != nil {
 					return err
 				}
+				if logRecord.Type == data.LogRecordBlob {
+					referencedBlobs[data.DecodeBlobRef(logRecord.Value).ID] = struct{}{}
+				}
 			}
 
 			offset += size
 		}
 	}
 
-	if err := hintFile.Sync(); err != nil {
-		return err
-	}
-	if err := mergeDB.Sync(); err != nil {
-		return err
+	// 持久化merge后的最后一个数据文件并生成hint文件
+	if mergeDB.activeFile != nil {
+		if err := mergeDB.activeFile.Sync(); err != nil {
+			return err
+		}
+		if err := mergeDB.writeHintFile(mergeDB.activeFile.Fid, mergeDB.hintBuf, mergeDB.activeFile.WriteOffset); err != nil {
+			return err
+		}
 	}
 
 	// 全部merge完成
-	mergeFinFile, err := data.OpenMergeFinishedFile(mergePath)
+	mergeFinFile, err := data.OpenMergeFinishedFile(db.fs, mergePath)
 	if err != nil {
 		return err
 	}
+	defer mergeFinFile.Close()
 	mergeRecord := &data.LogRecord{
 		Key:   []byte(MergeFinKey),
-		Value: []byte(strconv.Itoa(int(finFid))),
+		Value: []byte(strconv.Itoa(int(nonMergeFid))),
 	}
 
 	encRecord, _ := data.EncodeLogRecord(mergeRecord)
@@ -142,74 +231,245 @@ func (db *DB) Merge() error {
 		return err
 	}
 
+	// 清理不再被引用的blob文件
+	if err := db.removeUnusedBlobs(nextBlobID, pendingBlobs, referencedBlobs); err != nil {
+		return err
+	}
+	// merge后旧文件中的大部分记录不再被引用，清空缓存
+	if db.cache != nil {
+		db.cache.purge()
+	}
+	reclaimed = max(dataFilesSize(mergeFiles)-mergeDB.dataFilesSize(), 0)
+	// merge生成的数据文件以及仍然被引用的blob文件
+	mergedSize = mergeDB.dataFilesSize()
+	db.mu.RLock()
+	for blobID := range referencedBlobs {
+		mergedSize += db.blobSizes[blobID]
+	}
+	db.mu.RUnlock()
+	if m := db.metrics; m != nil {
+		m.Merges.Inc()
+		m.MergeDuration.ObserveSince(start)
+		m.MergeReclaimedBytes.Add(uint64(reclaimed))
+	}
 	return nil
 }
 
+// 数据文件的总大小
+func dataFilesSize(files []*data.DataFile) int64 {
+	var size int64
+	for _, file := range files {
+		if fileSize, err := file.IOManager.Size(); err == nil {
+			size += fileSize
+		}
+	}
+	return size
+}
+
+func (db *DB) dataFilesSize() int64 {
+	var files []*data.DataFile
+	if db.activeFile != nil {
+		files = append(files, db.activeFile)
+	}
+	for _, file := range db.olderFiles {
+		files = append(files, file)
+	}
+	return dataFilesSize(files)
+}
+
+// 判断记录是否仍然有效：索引指向该记录，或者是merge开始后写入的操作数的基础value
+func (db *DB) isLiveRecord(cf uint32, key []byte, pos *data.LogRecordPos) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if cf != DefaultCFID {
+		family := db.cfByID[cf]
+		return family != nil && samePos(family.index.Get(key), pos)
+	}
+	if samePos(db.index.Get(key), pos) {
+		return true
+	}
+	chain := db.operands[string(key)]
+	return chain != nil && samePos(chain.base, pos)
+}
+
+// 将操作数合并为一条普通记录写入mergeDB
+func (db *DB) mergeOperandChain(mergeDB *DB, key []byte, chain *operandChain, referencedBlobs map[uint32]struct{}) error {
+	db.mu.RLock()
+	value, err := db.mergeOperands(key, chain)
+	// 合并后的记录使用最后一个操作数的写入时间和元数据
+	var lastOperand *data.LogRecord
+	if err == nil {
+		lastOperand, err = db.getLogRecordByPos(chain.operands[len(chain.operands)-1])
+	}
+	if err == nil && chain.base != nil {
+		// 重启之前仍然从原数据文件中读取，需要保留基础value的blob文件
+		var baseRecord *data.LogRecord
+		if baseRecord, err = db.getLogRecordByPos(chain.base); err == nil && baseRecord.Type == data.LogRecordBlob {
+			referencedBlobs[data.DecodeBlobRef(baseRecord.Value).ID] = struct{}{}
+		}
+	}
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	_, err = mergeDB.appendLogRecord(&data.LogRecord{
+		Key:     logRecordWithSeqNo(key, NonTxnSeqNo),
+		Value:   value,
+		Type:    data.LogRecordNormal,
+		Version: data.RecordVersion{Timestamp: lastOperand.Version.Timestamp},
+		Meta:    lastOperand.Meta,
+	})
+	return err
+}
+
+func samePos(a, b *data.LogRecordPos) bool {
+	return a != nil && b != nil && a.Fid == b.Fid && a.Offset == b.Offset
+}
+
 func (db *DB) getMergePath() string {
-	dir := path.Dir(path.Clean(db.options.DirPath)) // 获取数据文件目录的父目录
-	base := path.Base(db.options.DirPath)           // 获取数据文件目录名称
+	return mergePath(db.options.DirPath)
+}
+
+func mergePath(dirPath string) string {
+	dir := path.Dir(path.Clean(dirPath)) // 获取数据文件目录的父目录
+	base := path.Base(dirPath)           // 获取数据文件目录名称
 	return path.Join(dir, base+MergeDirName)
 }
 
 func (db *DB) loadMergeFiles() error {
 	mergePath := db.getMergePath()
-	if _, err := os.Stat(mergePath); os.IsNotExist(err) {
+	if ok, err := db.fs.Exists(mergePath); err != nil {
+		return err
+	} else if !ok {
 		return nil
 	}
-	defer func() {
-		_ = os.RemoveAll(mergePath)
-	}()
-	entryList, err := os.ReadDir(mergePath)
+	fileNames, err := db.fs.ReadDir(mergePath)
 	if err != nil {
 		return err
 	}
 	//查看merge完成标识
-	var mergeFinished bool = false
+	var mergeFinished, mergeApplied bool
 	var mergeFileNames []string
-	for _, entry := range entryList {
-		if entry.Name() == data.MergeFinishedFileName {
+	for _, fileName := range fileNames {
+		switch fileName {
+		case data.MergeFinishedFileName:
 			mergeFinished = true
-		} else {
-			mergeFileNames = append(mergeFileNames, entry.Name())
+		case data.MergeAppliedFileName:
+			mergeApplied = true
+		default:
+			mergeFileNames = append(mergeFileNames, fileName)
 		}
 	}
-	if !mergeFinished {
-		return nil
-	}
-	mergeFid, err := db.getRecentMergeFid(mergePath)
-	if err != nil {
-		return err
+	if !mergeFinished && !mergeApplied {
+		return db.fs.RemoveAll(mergePath)
 	}
 
-	// 删除原目录中的相应数据文件
-	var fid uint32 = 0
-	for ; fid <= mergeFid; fid++ {
-		dataFileName := data.GetDataFileName(db.options.DirPath, fid)
-		if _, err := os.Stat(dataFileName); err == nil {
-			if err := os.Remove(dataFileName); err != nil {
-				return err
+	// 上一次打开时已经删除了旧文件，只需要继续移动剩下的merge文件
+	if !mergeApplied {
+		mergeFid, err := db.getRecentMergeFid(mergePath)
+		if err != nil {
+			// merge完成标识没有完整写入，视为merge未完成
+			if err == io.EOF || err == io.ErrUnexpectedEOF || err == data.ErrInvaildCRC {
+				return db.fs.RemoveAll(mergePath)
 			}
+			return err
+		}
+
+		// 删除原目录中已经参与merge的数据文件以及hint文件
+		var fid uint32 = 0
+		for ; fid < mergeFid; fid++ {
+			for _, fileName := range []string{
+				data.GetDataFileName(db.options.DirPath, fid),
+				data.GetHintFileName(db.options.DirPath, fid),
+			} {
+				if ok, err := db.fs.Exists(fileName); err != nil {
+					return err
+				} else if ok {
+					if err := db.fs.Remove(fileName); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		// 旧文件删除完成之后再标记，重复执行时不会删除已经移入的merge文件
+		if err := db.fs.Rename(
+			filepath.Join(mergePath, data.MergeFinishedFileName),
+			filepath.Join(mergePath, data.MergeAppliedFileName),
+		); err != nil {
+			return err
 		}
 	}
 
-	// 将新的数据文件移动到数据目录下
+	// 将新的数据文件移动到数据目录下，中途失败时保留merge目录，下次打开时继续
 	for _, fileName := range mergeFileNames {
 		srcPath := filepath.Join(mergePath, fileName)
 		dstPath := filepath.Join(db.options.DirPath, fileName)
-		if err := os.Rename(srcPath, dstPath); err != nil {
+		if err := db.fs.Rename(srcPath, dstPath); err != nil {
 			return err
 		}
 	}
+	return db.fs.RemoveAll(mergePath)
+}
+
+// 用merge目录中的文件替换参与merge的旧文件，并重新加载索引，调用方需持有db.mu
+func (db *DB) applyMergeInPlace() error {
+	if db.closed {
+		return nil
+	}
+	for _, file := range db.olderFiles {
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	if err := db.activeFile.Close(); err != nil {
+		return err
+	}
+	db.activeFile, db.olderFiles, db.hintBuf = nil, make(map[uint32]*data.DataFile), nil
+	if err := db.loadMergeFiles(); err != nil {
+		return err
+	}
+
+	// 索引中的位置全部失效，清空后重新加载，已经创建的迭代器不再可用
+	db.mergeGen++
+	db.index = index.NewIndexer(db.options.IndexType)
+	for _, cf := range db.columnFamilies {
+		if cf.id == DefaultCFID {
+			cf.index = db.index
+		} else {
+			cf.index = index.NewIndexer(cf.options.IndexType)
+		}
+	}
+	db.operands = make(map[string]*operandChain)
+	db.versions = make(map[string][]*keyVersion)
+	var evictionOrder []string
+	if db.eviction != nil {
+		evictionOrder = db.eviction.reset()
+	}
+	if err := db.loadDataFiles(); err != nil {
+		return err
+	}
+	if err := db.loadIndexFromDataFiles(); err != nil {
+		return err
+	}
+	if db.eviction != nil {
+		db.eviction.keepOrder(evictionOrder)
+	}
+	if db.cache != nil {
+		db.cache.purge()
+	}
 	return nil
 }
 
-// 获取已经完成合并的数据文件Fid
+// 获取最早未参与合并的数据文件Fid，小于该Fid的文件都已完成合并
 func (db *DB) getRecentMergeFid(dirPath string) (uint32, error) {
-	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(db.fs, dirPath)
 	if err != nil {
 		return 0, err
 	}
-	rec, _, err := mergeFinishedFile.ReadLogRecord(0)
+	defer mergeFinishedFile.Close()
+	rec, _, err := mergeFinishedFile.ReadLogRecord(data.FileHeaderSize)
 	if err != nil {
 		return 0, err
 	}
@@ -219,33 +479,3 @@ func (db *DB) getRecentMergeFid(dirPath string) (uint32, error) {
 	}
 	return uint32(nonMergeFid), nil
 }
-
-func (db *DB) loadIndexFromHintFile() error {
-	hintFileName := filepath.Join(db.getMergePath(), data.HintFileName)
-	// 索引文件不存在
-	if _, err := os.Stat(hintFileName); os.IsNotExist(err) {
-		return nil
-	}
-	//打开索引文件
-	hintFile, err := data.OpenHintFile(hintFileName)
-	if err != nil {
-		return err
-	}
-	var offset int64 = 0
-
-	for {
-		logRecord, size, err := hintFile.ReadLogRecord(offset)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-		pos := data.DecodeLogRecordPos(logRecord.Value)
-		if !db.index.Put(logRecord.Key, pos) {
-			return ErrIndexUpdateFiled
-		}
-		offset += size
-	}
-	return nil
-}
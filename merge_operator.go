@@ -0,0 +1,108 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"encoding/binary"
+)
+
+// 合并操作符，将MergeValue写入的操作数合并到key已有的value上
+type MergeOperator interface {
+	// existing为nil表示key不存在，operands按写入顺序排列
+	FullMerge(key, existing []byte, operands [][]byte) ([]byte, error)
+}
+
+// 使用函数实现MergeOperator
+type MergeOperatorFunc func(key, existing []byte, operands [][]byte) ([]byte, error)
+
+func (f MergeOperatorFunc) FullMerge(key, existing []byte, operands [][]byte) ([]byte, error) {
+	return f(key, existing, operands)
+}
+
+// 计数器，value和操作数都是8字节大端编码的uint64
+var Uint64AddOperator MergeOperator = MergeOperatorFunc(func(key, existing []byte, operands [][]byte) ([]byte, error) {
+	var sum uint64
+	if existing != nil {
+		if len(existing) != 8 {
+			return nil, ErrInvalidMergeOperand
+		}
+		sum = binary.BigEndian.Uint64(existing)
+	}
+	for _, operand := range operands {
+		if len(operand) != 8 {
+			return nil, ErrInvalidMergeOperand
+		}
+		sum += binary.BigEndian.Uint64(operand)
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, sum)
+	return value, nil
+})
+
+// 将操作数依次追加到value的末尾
+var AppendOperator MergeOperator = MergeOperatorFunc(func(key, existing []byte, operands [][]byte) ([]byte, error) {
+	size := len(existing)
+	for _, operand := range operands {
+		size += len(operand)
+	}
+	value := make([]byte, 0, size)
+	value = append(value, existing...)
+	for _, operand := range operands {
+		value = append(value, operand...)
+	}
+	return value, nil
+})
+
+// key的合并操作数，base为第一个操作数之前的记录位置，为nil表示key不存在
+type operandChain struct {
+	base     *data.LogRecordPos
+	operands []*data.LogRecordPos
+}
+
+// 写入合并操作数，不需要读取已有的value，读取时通过MergeOperator合并
+func (db *DB) MergeValue(key, operand []byte) error {
+	if len(key) == 0 {
+		return ErrKeyisEmpty
+	}
+	if db.closed {
+		return ErrDBClosed
+	}
+	if db.options.MergeOperator == nil {
+		return ErrMergeOperatorNotSet
+	}
+	logRecord := &data.LogRecord{
+		Key:   logRecordWithSeqNo(key, NonTxnSeqNo),
+		Value: operand,
+		Type:  data.LogRecordMergeOperand,
+	}
+	if db.options.SyncWrite {
+		return db.groupCommitRecord(key, logRecord)
+	}
+	return db.appendLogRecordWithLock(key, logRecord)
+}
+
+// 将操作数合并到基础value上
+func (db *DB) mergeOperands(key []byte, chain *operandChain) ([]byte, error) {
+	if db.options.MergeOperator == nil {
+		return nil, ErrMergeOperatorNotSet
+	}
+	var existing []byte
+	if chain.base != nil {
+		value, err := db.getValueByPos(chain.base)
+		if err != nil && err != ErrKeyNotFound {
+			return nil, err
+		}
+		if err == nil && value == nil {
+			value = []byte{}
+		}
+		existing = value
+	}
+	operands := make([][]byte, len(chain.operands))
+	for i, pos := range chain.operands {
+		logRecord, err := db.getLogRecordByPos(pos)
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = logRecord.Value
+	}
+	return db.options.MergeOperator.FullMerge(key, existing, operands)
+}
@@ -0,0 +1,288 @@
+package bcdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 合并操作符测试 ====================
+
+func uint64Bytes(n uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	return buf
+}
+
+func TestMergeValue_NoOperator(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Equal(t, ErrMergeOperatorNotSet, db.MergeValue([]byte("key"), uint64Bytes(1)))
+	assert.Equal(t, ErrKeyisEmpty, db.MergeValue(nil, uint64Bytes(1)))
+}
+
+func TestMergeValue_Counter(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = Uint64AddOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// key不存在时从0开始累加
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.MergeValue([]byte("counter"), uint64Bytes(1)))
+	}
+	value, err := db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64Bytes(100), value)
+
+	// 在已有的value上累加
+	assert.Nil(t, db.Put([]byte("counter"), uint64Bytes(1000)))
+	assert.Nil(t, db.MergeValue([]byte("counter"), uint64Bytes(5)))
+	value, err = db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64Bytes(1005), value)
+
+	// 删除之后重新开始累加
+	assert.Nil(t, db.Delete([]byte("counter")))
+	_, err = db.Get([]byte("counter"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.MergeValue([]byte("counter"), uint64Bytes(7)))
+	value, err = db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64Bytes(7), value)
+
+	// 非法的操作数
+	assert.Nil(t, db.MergeValue([]byte("counter"), []byte("bad")))
+	_, err = db.Get([]byte("counter"))
+	assert.Equal(t, ErrInvalidMergeOperand, err)
+}
+
+func TestMergeValue_Append(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = AppendOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("log"), []byte("a")))
+	assert.Nil(t, db.MergeValue([]byte("log"), []byte("b")))
+	assert.Nil(t, db.MergeValue([]byte("log"), []byte("c")))
+	value, err := db.Get([]byte("log"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("abc"), value)
+
+	// 覆盖写入之后不再合并之前的操作数
+	assert.Nil(t, db.Put([]byte("log"), []byte("x")))
+	value, err = db.Get([]byte("log"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("x"), value)
+
+	// 基础value为空
+	assert.Nil(t, db.Put([]byte("empty"), []byte{}))
+	assert.Nil(t, db.MergeValue([]byte("empty"), []byte("y")))
+	value, err = db.Get([]byte("empty"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("y"), value)
+}
+
+func TestMergeValue_ReadPaths(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = AppendOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, db.MergeValue([]byte("a"), []byte("2")))
+	assert.Nil(t, db.MergeValue([]byte("b"), []byte("3")))
+
+	// Fold
+	state := dumpDB(t, db)
+	assert.Equal(t, map[string]string{"a": "12", "b": "3"}, state)
+
+	// 迭代器
+	it := db.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+	var values []string
+	for it.ReWind(); it.Valid(); it.Next() {
+		value, err := it.Value()
+		assert.Nil(t, err)
+		values = append(values, string(value))
+	}
+	assert.Equal(t, []string{"12", "3"}, values)
+
+	// 流式读取
+	r, err := db.GetStream([]byte("a"))
+	assert.Nil(t, err)
+	value, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, []byte("12"), value)
+
+	// 条件写入比较合并后的value
+	ok, err := db.CompareAndSwap([]byte("a"), []byte("12"), []byte("new"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	value, err = db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), value)
+}
+
+func TestMergeValue_SyncWrite(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = Uint64AddOperator
+	opts.SyncWrite = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				assert.Nil(t, db.MergeValue([]byte("counter"), uint64Bytes(1)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64Bytes(160), value)
+}
+
+func TestMergeValue_Persistence(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = Uint64AddOperator
+	opts.MaxFileSize = 256
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("counter"), uint64Bytes(10)))
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, db.MergeValue([]byte("counter"), uint64Bytes(2)))
+	}
+	assert.Nil(t, db.Close())
+
+	// 重启之后通过hint文件和数据文件恢复操作数
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	value, err := db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64Bytes(110), value)
+	assert.Nil(t, db.Close())
+
+	// 没有设置合并操作符时无法读取
+	opts.MergeOperator = nil
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = db.Get([]byte("counter"))
+	assert.Equal(t, ErrMergeOperatorNotSet, err)
+}
+
+func TestMergeValue_Compaction(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = AppendOperator
+	opts.MaxFileSize = 256
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.MergeValue([]byte("log"), []byte(fmt.Sprintf("%d,", i))))
+	}
+	assert.Nil(t, db.Put([]byte("base"), []byte("b")))
+	assert.Nil(t, db.MergeValue([]byte("base"), []byte("1")))
+	assert.Nil(t, db.Merge())
+
+	// merge之后，重启之前仍然可以读取
+	value, err := db.Get([]byte("base"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b1"), value)
+
+	// merge开始之后写入的操作数
+	assert.Nil(t, db.MergeValue([]byte("log"), []byte("end")))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	var expected strings.Builder
+	for i := 0; i < 100; i++ {
+		expected.WriteString(fmt.Sprintf("%d,", i))
+	}
+	expected.WriteString("end")
+	value, err = db.Get([]byte("log"))
+	assert.Nil(t, err)
+	assert.Equal(t, expected.String(), string(value))
+	value, err = db.Get([]byte("base"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b1"), value)
+
+	// 操作数已经合并为一条普通记录
+	assert.Nil(t, db.operands["base"])
+	assert.Equal(t, 1, len(db.operands["log"].operands))
+}
+
+// merge过程中并发写入操作数，数据不会丢失
+func TestMergeValue_ConcurrentMerge(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = Uint64AddOperator
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	keys := []string{"a", "b", "c", "d"}
+	for _, key := range keys {
+		assert.Nil(t, db.Put([]byte(key), uint64Bytes(0)))
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				assert.Nil(t, db.MergeValue([]byte(key), uint64Bytes(1)))
+			}
+		}(key)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			err := db.Merge()
+			assert.True(t, err == nil || err == ErrMergeInProgress)
+		}
+	}()
+	wg.Wait()
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	for _, key := range keys {
+		value, err := db.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, uint64Bytes(200), value, key)
+	}
+}
@@ -0,0 +1,105 @@
+package bcdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== Merge 测试 ====================
+
+// 测试空数据库的 Merge
+func TestMerge_Empty(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Merge())
+}
+
+// 测试 Merge 之后重新打开数据库
+func TestMerge_Reopen(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 4 * 1024
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i))))
+	}
+	// 覆盖和删除部分数据
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("new_value_%d", i))))
+	}
+	for i := 100; i < 200; i++ {
+		assert.Nil(t, db.Delete([]byte(fmt.Sprintf("key_%d", i))))
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("txn_key"), []byte("txn_value")))
+	assert.Nil(t, wb.Commit())
+
+	assert.Nil(t, db.Merge())
+	// merge之后的写入不会丢失
+	assert.Nil(t, db.Put([]byte("after_merge"), []byte("value")))
+	assert.Nil(t, db.Close())
+
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer db2.Close()
+
+	_, err = os.Stat(db2.getMergePath())
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, 402, len(db2.ListKeys()))
+	for i := 0; i < 100; i++ {
+		val, err := db2.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("new_value_%d", i)), val)
+	}
+	for i := 100; i < 200; i++ {
+		_, err := db2.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	for i := 200; i < 500; i++ {
+		val, err := db2.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_%d", i)), val)
+	}
+	val, err := db2.Get([]byte("txn_key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("txn_value"), val)
+	val, err = db2.Get([]byte("after_merge"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), val)
+}
+
+// 测试 Merge 可以重复执行
+func TestMerge_Twice(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 4 * 1024
+
+	for round := 0; round < 2; round++ {
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		for i := 0; i < 300; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d_%d", round, i))))
+		}
+		assert.Nil(t, db.Merge())
+		assert.Nil(t, db.Close())
+	}
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 300, len(db.ListKeys()))
+	for i := 0; i < 300; i++ {
+		val, err := db.Get([]byte(fmt.Sprintf("key_%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value_1_%d", i)), val)
+	}
+}
@@ -0,0 +1,63 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"context"
+	"time"
+)
+
+// 记录的写入时间和用户元数据
+type RecordMeta struct {
+	Timestamp time.Time // 写入时间，旧格式的记录为零值
+	Metadata  []byte
+}
+
+func newRecordMeta(logRecord *data.LogRecord) *RecordMeta {
+	meta := &RecordMeta{Metadata: logRecord.Meta}
+	if logRecord.Version.Timestamp != 0 {
+		meta.Timestamp = time.Unix(0, logRecord.Version.Timestamp)
+	}
+	return meta
+}
+
+// 写入数据并附带用户元数据
+func (db *DB) PutWithMeta(key, value, meta []byte) error {
+	return db.put(context.Background(), key, value, meta)
+}
+
+// 读取value以及最后一次写入的时间和元数据
+func (db *DB) GetWithMeta(key []byte) ([]byte, *RecordMeta, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, nil, ErrDBClosed
+	}
+	if len(key) == 0 {
+		return nil, nil, ErrKeyisEmpty
+	}
+	recordPos := db.index.Get(key)
+	if recordPos == nil {
+		return nil, nil, ErrKeyNotFound
+	}
+	logRecord, err := db.getLogRecordByPos(recordPos)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var value []byte
+	switch chain := db.operands[string(key)]; {
+	case chain != nil:
+		value, err = db.mergeOperands(key, chain)
+	case logRecord.Type == data.LogRecordBlob:
+		value, err = db.readBlobValue(data.DecodeBlobRef(logRecord.Value))
+	case logRecord.Type == data.LogRecordDeleted:
+		err = ErrKeyNotFound
+	default:
+		value = logRecord.Value
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, newRecordMeta(logRecord), nil
+}
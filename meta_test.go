@@ -0,0 +1,192 @@
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 写入时间和元数据测试 ====================
+
+func TestDB_GetWithMeta(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	before := time.Now()
+	assert.Nil(t, db.Put([]byte("plain"), []byte("v1")))
+	assert.Nil(t, db.PutWithMeta([]byte("meta"), []byte("v2"), []byte("content-type=json")))
+	after := time.Now()
+
+	value, meta, err := db.GetWithMeta([]byte("plain"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+	assert.Nil(t, meta.Metadata)
+	assert.False(t, meta.Timestamp.Before(before))
+	assert.False(t, meta.Timestamp.After(after))
+
+	value, meta, err = db.GetWithMeta([]byte("meta"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	assert.Equal(t, []byte("content-type=json"), meta.Metadata)
+
+	// 覆盖写入后返回最新的写入时间和元数据
+	time.Sleep(2 * time.Millisecond)
+	assert.Nil(t, db.Put([]byte("meta"), []byte("v3")))
+	_, newMeta, err := db.GetWithMeta([]byte("meta"))
+	assert.Nil(t, err)
+	assert.Nil(t, newMeta.Metadata)
+	assert.True(t, newMeta.Timestamp.After(meta.Timestamp))
+
+	value, err = db.Get([]byte("meta"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), value)
+
+	_, _, err = db.GetWithMeta([]byte("missing"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, _, err = db.GetWithMeta(nil)
+	assert.Equal(t, ErrKeyisEmpty, err)
+	assert.Equal(t, ErrKeyisEmpty, db.PutWithMeta(nil, []byte("v"), []byte("m")))
+}
+
+func TestDB_GetWithMeta_WriteBatch(t *testing.T) {
+	for _, syncWrites := range []bool{false, true} {
+		opts := testOptions(t)
+
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		wbOpts := DefaultWriteBatchOptions
+		wbOpts.SyncWrites = syncWrites
+		wb := db.NewWriteBatch(wbOpts)
+		assert.Nil(t, wb.PutWithMeta([]byte("a"), []byte("1"), []byte("meta-a")))
+		assert.Nil(t, wb.Put([]byte("b"), []byte("2")))
+		assert.Nil(t, wb.Commit())
+
+		_, meta, err := db.GetWithMeta([]byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("meta-a"), meta.Metadata)
+		_, metaB, err := db.GetWithMeta([]byte("b"))
+		assert.Nil(t, err)
+		assert.Nil(t, metaB.Metadata)
+		assert.False(t, metaB.Timestamp.IsZero())
+
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestDB_GetWithMeta_SecondaryIndex(t *testing.T) {
+	opts := testOptions(t)
+
+	db := openSecondaryIndexTestDB(t, opts)
+	defer db.Close()
+
+	assert.Nil(t, db.PutWithMeta([]byte("user-1"), []byte("alice@a.com|beijing"), []byte("v1")))
+	_, meta, err := db.GetWithMeta([]byte("user-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), meta.Metadata)
+	assert.Equal(t, []string{"user-1"}, scanKeys(t, db, "email", "alice"))
+}
+
+func TestDB_GetWithMeta_Blob(t *testing.T) {
+	opts := testOptions(t)
+	opts.BlobThreshold = 16
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	large := bytes.Repeat([]byte("x"), 1024)
+	assert.Nil(t, db.PutStream([]byte("key"), bytes.NewReader(large)))
+	value, meta, err := db.GetWithMeta([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, large, value)
+	assert.False(t, meta.Timestamp.IsZero())
+}
+
+// 写入时间和元数据在重启、hint文件和merge之后保持不变
+func TestDB_MetaPersistence(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 256
+	opts.MergeOperator = AppendOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i%5))
+		assert.Nil(t, db.PutWithMeta(key, []byte(fmt.Sprintf("value-%d", i)), []byte(fmt.Sprintf("meta-%d", i))))
+	}
+	assert.Nil(t, db.Put([]byte("counter"), []byte("a")))
+	assert.Nil(t, db.MergeValue([]byte("counter"), []byte("b")))
+
+	expected := make(map[string]*RecordMeta)
+	for _, key := range db.ListKeys() {
+		_, meta, err := db.GetWithMeta(key)
+		assert.Nil(t, err)
+		expected[string(key)] = meta
+	}
+	assert.Equal(t, 6, len(expected))
+	assert.Equal(t, []byte("meta-19"), expected["key-4"].Metadata)
+	assert.Nil(t, db.Close())
+
+	check := func() {
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		for key, want := range expected {
+			_, meta, err := db.GetWithMeta([]byte(key))
+			assert.Nil(t, err)
+			assert.Equal(t, want.Metadata, meta.Metadata, key)
+			assert.True(t, want.Timestamp.Equal(meta.Timestamp), key)
+		}
+		value, err := db.Get([]byte("counter"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("ab"), value)
+	}
+	// 从数据文件和hint文件加载
+	check()
+	assert.Nil(t, db.Close())
+	check()
+
+	// merge之后重启
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	check()
+	assert.Nil(t, db.Close())
+}
+
+func TestIterator_Meta(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, db.PutWithMeta([]byte(fmt.Sprintf("key-%d", i)), []byte("value"), []byte(fmt.Sprintf("meta-%d", i))))
+	}
+
+	for _, keysOnly := range []bool{false, true} {
+		iterOpts := DefaultIteratorOptions
+		iterOpts.KeysOnly = keysOnly
+		iter := db.NewIterator(iterOpts)
+		var i int
+		for iter.ReWind(); iter.Valid(); iter.Next() {
+			meta, err := iter.Meta()
+			assert.Nil(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("meta-%d", i)), meta.Metadata)
+			assert.False(t, meta.Timestamp.IsZero())
+			if !keysOnly {
+				value, err := iter.Value()
+				assert.Nil(t, err)
+				assert.Equal(t, []byte("value"), value)
+			}
+			i++
+		}
+		assert.Equal(t, 5, i)
+		iter.Close()
+	}
+}
@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 指标名称的前缀
+const namespace = "bcdb"
+
+// 延迟直方图默认的分桶上界，单位秒
+var DefaultLatencyBuckets = []float64{
+	0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5,
+}
+
+// 单调递增的计数器
+type Counter struct {
+	v atomic.Uint64
+}
+
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+// 抓取时通过回调函数计算的瞬时值
+type GaugeFunc struct {
+	fn atomic.Pointer[func() float64]
+}
+
+// 设置计算函数，为nil时值为0
+func (g *GaugeFunc) Set(fn func() float64) {
+	if fn == nil {
+		g.fn.Store(nil)
+		return
+	}
+	g.fn.Store(&fn)
+}
+
+func (g *GaugeFunc) Value() float64 {
+	if fn := g.fn.Load(); fn != nil {
+		return (*fn)()
+	}
+	return 0
+}
+
+// 直方图，记录落在每个分桶中的观测值数量
+type Histogram struct {
+	buckets []float64       // 分桶上界，升序
+	counts  []atomic.Uint64 // 每个分桶中的数量，最后一个为+Inf
+	count   atomic.Uint64
+	sumBits atomic.Uint64 // 观测值之和，float64的二进制表示
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		buckets: sorted,
+		counts:  make([]atomic.Uint64, len(sorted)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// 记录从start到现在的耗时，通常与defer一起使用
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sumBits.Load())
+}
+
+// 返回每个分桶上界对应的累计数量
+func (h *Histogram) cumulativeCounts() []uint64 {
+	counts := make([]uint64, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		total += h.counts[i].Load()
+		counts[i] = total
+	}
+	return counts
+}
+
+// 一个DB实例的全部监控指标，设置到Options.Metrics后开启，未设置时不产生任何开销
+type Metrics struct {
+	PutDuration    *Histogram
+	GetDuration    *Histogram
+	DeleteDuration *Histogram
+	CommitDuration *Histogram // WriteBatch提交的耗时
+
+	BytesWritten *Counter // 写入数据文件的字节数
+	BytesRead    *Counter // 从数据文件和blob文件读取的字节数
+
+	Fsyncs        *Counter
+	FsyncDuration *Histogram
+	FileRotations *Counter // 活跃文件写满后切换的次数
+
+	Merges              *Counter
+	MergeDuration       *Histogram
+	MergeReclaimedBytes *Counter // merge清理的数据文件大小
+
+	IndexSize *GaugeFunc // 默认列族的key数量
+
+	descs []*desc
+}
+
+// 指标的描述信息，按照注册顺序输出
+type desc struct {
+	name   string
+	help   string
+	metric any
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		PutDuration:         NewHistogram(DefaultLatencyBuckets),
+		GetDuration:         NewHistogram(DefaultLatencyBuckets),
+		DeleteDuration:      NewHistogram(DefaultLatencyBuckets),
+		CommitDuration:      NewHistogram(DefaultLatencyBuckets),
+		BytesWritten:        new(Counter),
+		BytesRead:           new(Counter),
+		Fsyncs:              new(Counter),
+		FsyncDuration:       NewHistogram(DefaultLatencyBuckets),
+		FileRotations:       new(Counter),
+		Merges:              new(Counter),
+		MergeDuration:       NewHistogram(DefaultLatencyBuckets),
+		MergeReclaimedBytes: new(Counter),
+		IndexSize:           new(GaugeFunc),
+	}
+	m.descs = []*desc{
+		{"put_duration_seconds", "Latency of Put operations.", m.PutDuration},
+		{"get_duration_seconds", "Latency of Get operations.", m.GetDuration},
+		{"delete_duration_seconds", "Latency of Delete operations.", m.DeleteDuration},
+		{"commit_duration_seconds", "Latency of WriteBatch commits.", m.CommitDuration},
+		{"written_bytes_total", "Bytes written to data files.", m.BytesWritten},
+		{"read_bytes_total", "Bytes read from data and blob files.", m.BytesRead},
+		{"fsyncs_total", "Number of fsync calls on the active file.", m.Fsyncs},
+		{"fsync_duration_seconds", "Latency of fsync calls on the active file.", m.FsyncDuration},
+		{"file_rotations_total", "Number of active file rotations.", m.FileRotations},
+		{"merges_total", "Number of completed merges.", m.Merges},
+		{"merge_duration_seconds", "Duration of completed merges.", m.MergeDuration},
+		{"merge_reclaimed_bytes_total", "Bytes of data files reclaimed by merges.", m.MergeReclaimedBytes},
+		{"index_size", "Number of keys in the default column family.", m.IndexSize},
+	}
+	return m
+}
+
+// 按照Prometheus文本格式输出全部指标
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, d := range m.descs {
+		name := namespace + "_" + d.name
+		switch metric := d.metric.(type) {
+		case *Counter:
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", name, d.help, name)
+			fmt.Fprintf(bw, "%s %d\n", name, metric.Value())
+		case *GaugeFunc:
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", name, d.help, name)
+			fmt.Fprintf(bw, "%s %s\n", name, formatFloat(metric.Value()))
+		case *Histogram:
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", name, d.help, name)
+			counts := metric.cumulativeCounts()
+			for i, bound := range metric.buckets {
+				fmt.Fprintf(bw, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n", name, counts[len(counts)-1])
+			fmt.Fprintf(bw, "%s_sum %s\n", name, formatFloat(metric.Sum()))
+			fmt.Fprintf(bw, "%s_count %d\n", name, counts[len(counts)-1])
+		}
+	}
+	return bw.Flush()
+}
+
+// 提供给Prometheus抓取的http.Handler
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.WritePrometheus(w)
+	})
+}
+
+// 以name发布到expvar，可以通过/debug/vars查看，同一个name只能发布一次
+func (m *Metrics) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return m.expvarValues()
+	}))
+}
+
+func (m *Metrics) expvarValues() map[string]any {
+	values := make(map[string]any, len(m.descs))
+	for _, d := range m.descs {
+		switch metric := d.metric.(type) {
+		case *Counter:
+			values[d.name] = metric.Value()
+		case *GaugeFunc:
+			values[d.name] = metric.Value()
+		case *Histogram:
+			counts := metric.cumulativeCounts()
+			buckets := make(map[string]uint64, len(counts))
+			for i, bound := range metric.buckets {
+				buckets[formatFloat(bound)] = counts[i]
+			}
+			buckets["+Inf"] = counts[len(counts)-1]
+			values[d.name] = map[string]any{
+				"count":   counts[len(counts)-1],
+				"sum":     metric.Sum(),
+				"buckets": buckets,
+			}
+		}
+	}
+	return values
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
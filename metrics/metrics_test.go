@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	c := new(Counter)
+	c.Inc()
+	c.Add(41)
+	assert.Equal(t, uint64(42), c.Value())
+}
+
+func TestGaugeFunc(t *testing.T) {
+	g := new(GaugeFunc)
+	assert.Equal(t, float64(0), g.Value())
+	g.Set(func() float64 { return 7 })
+	assert.Equal(t, float64(7), g.Value())
+	g.Set(nil)
+	assert.Equal(t, float64(0), g.Value())
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{1, 0.1, 10})
+	for _, v := range []float64{0.05, 0.1, 0.5, 1, 5, 100} {
+		h.Observe(v)
+	}
+	assert.Equal(t, []float64{0.1, 1, 10}, h.buckets)
+	// 上界包含等于的值
+	assert.Equal(t, []uint64{2, 4, 5, 6}, h.cumulativeCounts())
+	assert.Equal(t, uint64(6), h.Count())
+	assert.InDelta(t, 106.65, h.Sum(), 1e-9)
+
+	h.ObserveSince(time.Now().Add(-time.Second))
+	assert.Equal(t, uint64(7), h.Count())
+}
+
+func TestHistogram_Concurrent(t *testing.T) {
+	h := NewHistogram(DefaultLatencyBuckets)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.Observe(0.001)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(8000), h.Count())
+	assert.InDelta(t, 8.0, h.Sum(), 1e-6)
+}
+
+func TestMetrics_WritePrometheus(t *testing.T) {
+	m := New()
+	m.PutDuration.Observe(0.0002)
+	m.PutDuration.Observe(2)
+	m.BytesWritten.Add(1024)
+	m.IndexSize.Set(func() float64 { return 10 })
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.WritePrometheus(&buf))
+	out := buf.String()
+	for _, line := range []string{
+		"# HELP bcdb_put_duration_seconds Latency of Put operations.",
+		"# TYPE bcdb_put_duration_seconds histogram",
+		`bcdb_put_duration_seconds_bucket{le="0.0001"} 0`,
+		`bcdb_put_duration_seconds_bucket{le="0.0005"} 1`,
+		`bcdb_put_duration_seconds_bucket{le="1"} 1`,
+		`bcdb_put_duration_seconds_bucket{le="5"} 2`,
+		`bcdb_put_duration_seconds_bucket{le="+Inf"} 2`,
+		"bcdb_put_duration_seconds_sum 2.0002",
+		"bcdb_put_duration_seconds_count 2",
+		"# TYPE bcdb_written_bytes_total counter",
+		"bcdb_written_bytes_total 1024",
+		"bcdb_fsyncs_total 0",
+		"# TYPE bcdb_index_size gauge",
+		"bcdb_index_size 10",
+	} {
+		assert.Contains(t, strings.Split(out, "\n"), line)
+	}
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.Fsyncs.Inc()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "bcdb_fsyncs_total 1\n")
+}
+
+func TestMetrics_PublishExpvar(t *testing.T) {
+	m := New()
+	m.PublishExpvar("bcdb-test-metrics")
+	m.FileRotations.Add(3)
+	m.GetDuration.Observe(0.002)
+
+	var values map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get("bcdb-test-metrics").String()), &values))
+	assert.Equal(t, float64(3), values["file_rotations_total"])
+	getDuration := values["get_duration_seconds"].(map[string]any)
+	assert.Equal(t, float64(1), getDuration["count"])
+	assert.Equal(t, float64(1), getDuration["buckets"].(map[string]any)["0.005"])
+	assert.Equal(t, float64(0), getDuration["buckets"].(map[string]any)["0.001"])
+}
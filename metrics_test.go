@@ -0,0 +1,77 @@
+package bcdb
+
+import (
+	"bcdb/metrics"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 监控指标测试 ====================
+
+func TestDB_Metrics(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 1024
+	opts.Metrics = metrics.New()
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	m := opts.Metrics
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i%10)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	for i := 0; i < 5; i++ {
+		_, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Delete([]byte("key-0")))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put([]byte("batch"), []byte("value")))
+	assert.Nil(t, wb.Commit())
+
+	assert.Equal(t, uint64(100), m.PutDuration.Count())
+	assert.Equal(t, uint64(5), m.GetDuration.Count())
+	assert.Equal(t, uint64(1), m.DeleteDuration.Count())
+	assert.Equal(t, uint64(1), m.CommitDuration.Count())
+	assert.Greater(t, m.BytesWritten.Value(), uint64(100*10))
+	assert.Greater(t, m.BytesRead.Value(), uint64(5*10))
+	assert.Greater(t, m.FileRotations.Value(), uint64(0))
+	// 切换活跃文件时持久化，批量写入提交时持久化
+	assert.GreaterOrEqual(t, m.Fsyncs.Value(), m.FileRotations.Value()+1)
+	assert.Equal(t, m.Fsyncs.Value(), m.FsyncDuration.Count())
+	assert.Equal(t, float64(10), m.IndexSize.Value())
+
+	// merge清理了被覆盖的数据
+	assert.Nil(t, db.Merge())
+	assert.Equal(t, uint64(1), m.Merges.Value())
+	assert.Equal(t, uint64(1), m.MergeDuration.Count())
+	assert.Greater(t, m.MergeReclaimedBytes.Value(), uint64(0))
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.WritePrometheus(&buf))
+	assert.Contains(t, buf.String(), "bcdb_index_size 10\n")
+	assert.Contains(t, buf.String(), "bcdb_put_duration_seconds_count 100\n")
+
+	// 关闭后不再引用DB
+	assert.Nil(t, db.Close())
+	assert.Equal(t, float64(0), m.IndexSize.Value())
+}
+
+func TestDB_MetricsSyncWrite(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncWrite = true
+	opts.Metrics = metrics.New()
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")))
+	}
+	assert.Equal(t, uint64(10), opts.Metrics.Fsyncs.Value())
+	assert.Equal(t, uint64(10), opts.Metrics.PutDuration.Count())
+}
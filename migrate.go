@@ -0,0 +1,145 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bcdb/vfs"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// 迁移时写入的临时文件后缀
+const migrateTempSuffix = ".migrate"
+
+// 迁移时每次拷贝的数据大小
+const migrateChunkSize = 4 * 1024 * 1024
+
+// 将没有文件头的旧格式目录升级为当前格式，需要在数据库关闭时执行，已经升级的文件会被跳过
+// 数据文件加上文件头后记录的位置发生变化，旧的hint文件直接删除，下次启动时重新生成
+func Migrate(options Options) error {
+	if options.DirPath == "" {
+		return ErrDBDirisEmpty
+	}
+	fs := optionsFS(options)
+	if ok, err := fs.Exists(options.DirPath); err != nil {
+		return err
+	} else if !ok {
+		return ErrDBDirNotFound
+	}
+	for _, dirPath := range []string{options.DirPath, mergePath(options.DirPath)} {
+		if ok, err := fs.Exists(dirPath); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if err := migrateDir(fs, dirPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateDir(fs vfs.FS, dirPath string) error {
+	fileNames, err := fs.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		filePath := filepath.Join(dirPath, fileName)
+		switch {
+		case strings.HasSuffix(fileName, migrateTempSuffix):
+			// 上一次迁移中断时留下的临时文件
+			if err := fs.Remove(filePath); err != nil {
+				return err
+			}
+		case strings.HasSuffix(fileName, data.HintFileSuffix):
+			if err := migrateHintFile(fs, filePath); err != nil {
+				return err
+			}
+		}
+	}
+	for _, fileName := range fileNames {
+		filePath := filepath.Join(dirPath, fileName)
+		switch {
+		case strings.HasSuffix(fileName, data.DataFileSuffix):
+			if err := migrateFile(fs, filePath, data.FileFlagData); err != nil {
+				return err
+			}
+		case fileName == data.MergeFinishedFileName:
+			if err := migrateFile(fs, filePath, data.FileFlagMergeFinished); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 旧格式的hint文件中记录的位置已经失效，删除
+func migrateHintFile(fs vfs.FS, filePath string) error {
+	legacy, err := isLegacyFile(fs, filePath)
+	if err != nil || !legacy {
+		return err
+	}
+	return fs.Remove(filePath)
+}
+
+// 在文件原有内容之前加上文件头，写入临时文件后替换原文件
+func migrateFile(fs vfs.FS, filePath string, flags uint16) error {
+	legacy, err := isLegacyFile(fs, filePath)
+	if err != nil || !legacy {
+		return err
+	}
+	src, err := fs.OpenFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	size, err := src.Size()
+	if err != nil {
+		return err
+	}
+
+	tempPath := filePath + migrateTempSuffix
+	dst, err := data.OpenMigrateFile(fs, tempPath, flags)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	buf := make([]byte, migrateChunkSize)
+	for offset := int64(0); offset < size; {
+		n, err := src.Read(buf[:min(int64(len(buf)), size-offset)], offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if err := dst.Write(buf[:n]); err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	return fs.Rename(tempPath, filePath)
+}
+
+// 非空且不以magic开头的文件是旧格式的文件
+func isLegacyFile(fs vfs.FS, filePath string) (bool, error) {
+	file, err := fs.OpenFile(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	size, err := file.Size()
+	if err != nil || size == 0 {
+		return false, err
+	}
+	magic := make([]byte, min(size, int64(len(data.FileMagic))))
+	if _, err := file.Read(magic, 0); err != nil && err != io.EOF {
+		return false, err
+	}
+	return !bytes.HasPrefix([]byte(data.FileMagic), magic), nil
+}
@@ -0,0 +1,180 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bcdb/vfs"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 文件格式迁移测试 ====================
+
+// 按照没有文件头的旧格式写入日志记录
+func writeLegacyFile(t *testing.T, fs vfs.FS, fileName string, records []*data.LogRecord) {
+	file, err := fs.OpenFile(fileName)
+	assert.Nil(t, err)
+	defer file.Close()
+	for _, rec := range records {
+		encRecord, _ := data.EncodeLogRecord(rec)
+		_, err := file.Write(encRecord)
+		assert.Nil(t, err)
+	}
+}
+
+func legacyPut(key, value string) *data.LogRecord {
+	return &data.LogRecord{Key: logRecordWithSeqNo([]byte(key), NonTxnSeqNo), Value: []byte(value)}
+}
+
+// 构造旧格式的数据目录：两个数据文件、一个事务以及旧格式的hint文件
+func writeLegacyDir(t *testing.T, fs vfs.FS, dirPath string) {
+	assert.Nil(t, fs.MkdirAll(dirPath))
+	var older []*data.LogRecord
+	for i := 0; i < 10; i++ {
+		older = append(older, legacyPut(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)))
+	}
+	writeLegacyFile(t, fs, data.GetDataFileName(dirPath, 0), older)
+
+	var hints []*data.LogRecord
+	var offset int64
+	for _, rec := range older {
+		_, size := data.EncodeLogRecord(rec)
+		hints = append(hints, &data.LogRecord{Key: rec.Key, Value: data.EncodeLogRecordPos(&data.LogRecordPos{Offset: offset})})
+		offset += size
+	}
+	hints = append(hints, &data.LogRecord{Value: data.EncodeLogRecordPos(&data.LogRecordPos{Offset: offset}), Type: data.LogRecordHintFin})
+	writeLegacyFile(t, fs, data.GetHintFileName(dirPath, 0), hints)
+
+	writeLegacyFile(t, fs, data.GetDataFileName(dirPath, 1), []*data.LogRecord{
+		legacyPut("key-0", "new-value"),
+		{Key: logRecordWithSeqNo([]byte("key-1"), NonTxnSeqNo), Type: data.LogRecordDeleted},
+		{Key: logRecordWithSeqNo([]byte("key-2"), 5), Value: []byte("txn-value")},
+		{Key: logRecordWithSeqNo(TxnFinKey, 5), Type: data.LogRecordTxnFin},
+	})
+}
+
+func assertLegacyData(t *testing.T, db *DB) {
+	expected := map[string]string{"key-0": "new-value", "key-2": "txn-value"}
+	for i := 3; i < 10; i++ {
+		expected[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	for key, value := range expected {
+		actual, err := db.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(value), actual)
+	}
+	_, err := db.Get([]byte("key-1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestOpen_LegacyFormat(t *testing.T) {
+	opts := testOptions(t)
+
+	writeLegacyDir(t, vfs.Default, opts.DirPath)
+	_, err := Open(opts)
+	assert.ErrorIs(t, err, data.ErrLegacyFormat)
+}
+
+func TestOpen_UnsupportedFormatVersion(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	assert.Nil(t, db.Close())
+
+	// 将文件头中的版本改为未知的版本
+	fileName := data.GetDataFileName(opts.DirPath, 0)
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	binary.LittleEndian.PutUint16(buf[4:6], data.FormatVersion+1)
+	binary.LittleEndian.PutUint32(buf[16:20], crc32.ChecksumIEEE(buf[:16]))
+	assert.Nil(t, os.WriteFile(fileName, buf, 0644))
+
+	_, err = Open(opts)
+	assert.ErrorIs(t, err, data.ErrUnsupportedFormatVersion)
+}
+
+func TestMigrate(t *testing.T) {
+	opts := testOptions(t)
+
+	writeLegacyDir(t, vfs.Default, opts.DirPath)
+	// 上一次迁移中断留下的临时文件
+	assert.Nil(t, os.WriteFile(data.GetDataFileName(opts.DirPath, 0)+migrateTempSuffix, []byte("partial"), 0644))
+
+	assert.Nil(t, Migrate(opts))
+	fileNames, err := vfs.Default.ReadDir(opts.DirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"000000000.data", "000000001.data"}, fileNames)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assertLegacyData(t, db)
+	assert.Equal(t, 9, len(db.ListKeys()))
+	assert.Nil(t, db.Put([]byte("key-10"), []byte("value-10")))
+	assert.Nil(t, db.Close())
+
+	// 已经升级的目录再次迁移不会有变化
+	before, err := os.ReadFile(data.GetDataFileName(opts.DirPath, 1))
+	assert.Nil(t, err)
+	assert.Nil(t, Migrate(opts))
+	after, err := os.ReadFile(data.GetDataFileName(opts.DirPath, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, before, after)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assertLegacyData(t, db)
+	assert.Equal(t, 10, len(db.ListKeys()))
+	value, err := db.Get([]byte("key-10"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value-10"), value)
+}
+
+// 旧格式的merge目录一起迁移，打开时完成merge
+func TestMigrate_MergeDir(t *testing.T) {
+	fs := vfs.NewMemFS()
+	opts := DefaultOptions
+	opts.DirPath = "/bcdb-migrate-merge"
+	opts.FS = fs
+
+	writeLegacyDir(t, fs, opts.DirPath)
+	mergeDir := mergePath(opts.DirPath)
+	assert.Nil(t, fs.MkdirAll(mergeDir))
+	var merged []*data.LogRecord
+	for i := 0; i < 10; i++ {
+		merged = append(merged, legacyPut(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)))
+	}
+	writeLegacyFile(t, fs, data.GetDataFileName(mergeDir, 0), merged)
+	writeLegacyFile(t, fs, filepath.Join(mergeDir, data.MergeFinishedFileName), []*data.LogRecord{
+		{Key: []byte(MergeFinKey), Value: []byte(strconv.Itoa(1))},
+	})
+
+	_, err := Open(opts)
+	assert.ErrorIs(t, err, data.ErrLegacyFormat)
+
+	assert.Nil(t, Migrate(opts))
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assertLegacyData(t, db)
+	assert.Equal(t, 9, len(db.ListKeys()))
+	ok, err := fs.Exists(mergeDir)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestMigrate_DirNotFound(t *testing.T) {
+	opts := testOptions(t)
+	assert.Equal(t, ErrDBDirNotFound, Migrate(opts))
+
+	opts.DirPath = ""
+	assert.Equal(t, ErrDBDirisEmpty, Migrate(opts))
+}
@@ -0,0 +1,89 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// 批量读取中的一个key
+type multiGetItem struct {
+	idx int // 在keys中的下标
+	key []byte
+	pos *data.LogRecordPos
+}
+
+// 批量读取多个key，返回的values和errs与keys一一对应，key不存在时对应的错误为ErrKeyNotFound
+// 在同一把读锁内查找全部key的位置，按(fid, offset)排序后读取，尽量将随机读转换为顺序读
+func (db *DB) MultiGet(keys [][]byte) ([][]byte, []error) {
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		for i := range errs {
+			errs[i] = ErrDBClosed
+		}
+		return values, errs
+	}
+
+	items := make([]multiGetItem, 0, len(keys))
+	for i, key := range keys {
+		if len(key) == 0 {
+			errs[i] = ErrKeyisEmpty
+			continue
+		}
+		pos := db.index.Get(key)
+		if pos == nil {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		items = append(items, multiGetItem{idx: i, key: key, pos: pos})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].pos.Fid != items[j].pos.Fid {
+			return items[i].pos.Fid < items[j].pos.Fid
+		}
+		return items[i].pos.Offset < items[j].pos.Offset
+	})
+
+	read := func(items []multiGetItem) {
+		for _, item := range items {
+			values[item.idx], errs[item.idx] = db.getValue(item.key, item.pos)
+			if errs[item.idx] == nil {
+				db.touchEviction(item.key)
+			}
+		}
+	}
+
+	// 按数据文件分组，不同文件之间并发读取
+	concurrency := db.options.MultiGetConcurrency
+	if concurrency < 0 {
+		concurrency = runtime.NumCPU()
+	}
+	if concurrency <= 1 {
+		read(items)
+		return values, errs
+	}
+	sem := make(chan struct{}, concurrency)
+	wg := new(sync.WaitGroup)
+	for start := 0; start < len(items); {
+		end := start + 1
+		for end < len(items) && items[end].pos.Fid == items[start].pos.Fid {
+			end++
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(items []multiGetItem) {
+			defer wg.Done()
+			read(items)
+			<-sem
+		}(items[start:end])
+		start = end
+	}
+	wg.Wait()
+	return values, errs
+}
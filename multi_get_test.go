@@ -0,0 +1,91 @@
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 批量读取测试 ====================
+
+func TestDB_MultiGet(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = AppendOperator
+	opts.BlobThreshold = 16
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("a"), []byte("value-a")))
+	assert.Nil(t, db.Put([]byte("b"), []byte("value-b")))
+	assert.Nil(t, db.Put([]byte("deleted"), []byte("value")))
+	assert.Nil(t, db.Delete([]byte("deleted")))
+	assert.Nil(t, db.Put([]byte("merged"), []byte("x")))
+	assert.Nil(t, db.MergeValue([]byte("merged"), []byte("y")))
+	blobValue := bytes.Repeat([]byte("blob"), 16)
+	assert.Nil(t, db.PutStream([]byte("blob"), bytes.NewReader(blobValue)))
+	// 后写入的a位于文件末尾，读取顺序与keys的顺序无关
+	assert.Nil(t, db.Put([]byte("a"), []byte("value-a2")))
+
+	keys := [][]byte{[]byte("a"), []byte("missing"), nil, []byte("b"), []byte("deleted"), []byte("merged"), []byte("blob"), []byte("a")}
+	values, errs := db.MultiGet(keys)
+	assert.Equal(t, len(keys), len(values))
+	assert.Equal(t, []error{nil, ErrKeyNotFound, ErrKeyisEmpty, nil, ErrKeyNotFound, nil, nil, nil}, errs)
+	assert.Equal(t, []byte("value-a2"), values[0])
+	assert.Nil(t, values[1])
+	assert.Nil(t, values[2])
+	assert.Equal(t, []byte("value-b"), values[3])
+	assert.Equal(t, []byte("xy"), values[5])
+	assert.Equal(t, blobValue, values[6])
+	assert.Equal(t, []byte("value-a2"), values[7])
+
+	values, errs = db.MultiGet(nil)
+	assert.Empty(t, values)
+	assert.Empty(t, errs)
+}
+
+// 数据分布在多个文件中时，并发读取与顺序读取的结果相同
+func TestDB_MultiGetConcurrency(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 4, -1} {
+		opts := testOptions(t)
+		opts.MaxFileSize = 512
+		opts.MultiGetConcurrency = concurrency
+
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		for i := 0; i < 300; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%03d", i%100)), []byte(fmt.Sprintf("value-%d", i))))
+		}
+		assert.Greater(t, len(db.olderFiles), 1)
+
+		var keys [][]byte
+		for i := 99; i >= 0; i-- {
+			keys = append(keys, []byte(fmt.Sprintf("key-%03d", i)))
+		}
+		values, errs := db.MultiGet(keys)
+		for i, key := range keys {
+			assert.Nil(t, errs[i])
+			expected, err := db.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, values[i])
+			assert.Equal(t, []byte(fmt.Sprintf("value-%d", 200+99-i)), values[i])
+		}
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestDB_MultiGetClosed(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	assert.Nil(t, db.Close())
+
+	values, errs := db.MultiGet([][]byte{[]byte("key"), []byte("other")})
+	assert.Equal(t, [][]byte{nil, nil}, values)
+	assert.Equal(t, []error{ErrDBClosed, ErrDBClosed}, errs)
+}
@@ -2,14 +2,56 @@ package bcdb
 
 import (
 	"bcdb/index"
+	"bcdb/metrics"
+	"bcdb/vfs"
+	"log/slog"
 	"os"
+	"time"
 )
 
 type Options struct {
 	DirPath     string
 	MaxFileSize int64
 	SyncWrite   bool
-	IndexType   index.IndexType
+	// 活跃文件累计写入多少字节后持久化一次，0表示不开启
+	BytesPerSync uint
+	// 后台定期持久化活跃文件的时间间隔，0表示不开启
+	SyncInterval time.Duration
+	IndexType    index.IndexType
+	// PutStream写入的value超过该大小时，分离存储到单独的blob文件中，0表示使用默认的1MB
+	BlobThreshold int64
+	// 启动时并发加载数据文件的goroutine数量，小于等于0时使用CPU核数
+	LoadConcurrency int
+	// 启动加载索引的进度回调，每加载完一个数据文件调用一次
+	LoadProgress func(loaded, total int)
+	// MultiGet并发读取不同数据文件的goroutine数量，0或1表示顺序读取，小于0时使用CPU核数
+	MultiGetConcurrency int
+	// 读取value的LRU缓存大小，单位为字节，0表示不开启
+	CacheSize int64
+	// 数据文件和blob文件的磁盘预算，超出时在后台触发merge回收空间，0表示不限制
+	// 有效数据超出预算时按EvictionPolicy写入删除记录淘汰默认列族中旧的key，其他列族的数据不会被淘汰
+	// 设置之后merge完成时立即替换旧文件，之前创建的迭代器失效
+	MaxDiskBytes int64
+	// 超出MaxDiskBytes时淘汰key的策略
+	EvictionPolicy EvictionPolicy
+	// 被淘汰的key的回调，为nil时不回调
+	OnEvict func(keys [][]byte)
+	// 所有数据只保存在内存中，关闭后数据丢失，merge完成后立即替换旧文件，之前创建的迭代器失效
+	InMemory bool
+	// 数据目录所在的文件系统，为nil时使用操作系统文件系统，InMemory为true时使用内存文件系统
+	FS vfs.FS
+	// 合并操作符，使用MergeValue写入操作数时必须设置
+	MergeOperator MergeOperator
+	// 保留默认列族中key的历史版本，可以通过GetAt和History读取
+	KeepVersions bool
+	// 历史版本的保留时间，被覆盖超过该时间的版本在merge时清理，0表示全部保留
+	VersionRetention time.Duration
+	// 监控指标，为nil时不统计
+	Metrics *metrics.Metrics
+	// 运行日志，为nil时不输出
+	Logger *slog.Logger
+	// 文件切换、merge、启动恢复等事件的回调，为nil时不回调
+	EventListener EventListener
 	IteratorOptions
 }
 
@@ -17,13 +59,24 @@ var DefaultOptions = Options{
 	DirPath:         os.TempDir(),
 	MaxFileSize:     256 * 1024 * 1024, //256MB
 	SyncWrite:       false,
+	BytesPerSync:    0,
+	SyncInterval:    0,
 	IndexType:       index.BTREE,
+	BlobThreshold:   1024 * 1024, //1MB
+	LoadConcurrency: 4,
+	FS:              nil,
 	IteratorOptions: DefaultIteratorOptions,
 }
 
 type IteratorOptions struct {
 	Prefix  []byte
 	Reverse bool
+	// 只遍历大于等于LowerBound的key，为空表示不限制
+	LowerBound []byte
+	// 只遍历小于UpperBound的key，为空表示不限制
+	UpperBound []byte
+	// 只遍历key，不能读取value
+	KeysOnly bool
 }
 
 var DefaultIteratorOptions = IteratorOptions{
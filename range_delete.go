@@ -0,0 +1,65 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bytes"
+	"encoding/binary"
+)
+
+// 删除[start, end)范围内的全部数据，end为空时删除start之后的全部数据
+// 只写入一条范围删除记录，不需要逐个删除key
+func (db *DB) DeleteRange(start, end []byte) error {
+	if db.closed {
+		return ErrDBClosed
+	}
+	if len(end) > 0 && bytes.Compare(start, end) >= 0 {
+		return nil
+	}
+	logRecord := &data.LogRecord{
+		Key:  logRecordWithSeqNo(encodeRangeKey(start, end), NonTxnSeqNo),
+		Type: data.LogRecordRangeDeleted,
+	}
+	if db.options.SyncWrite {
+		return db.groupCommitRecord(encodeRangeKey(start, end), logRecord)
+	}
+	return db.appendLogRecordWithLock(encodeRangeKey(start, end), logRecord)
+}
+
+// 删除以prefix开头的全部数据
+func (db *DB) DeletePrefix(prefix []byte) error {
+	if len(prefix) == 0 {
+		return ErrKeyisEmpty
+	}
+	return db.DeleteRange(prefix, prefixEnd(prefix))
+}
+
+// 返回大于所有以prefix开头的key的最小key，不存在时返回nil
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// 范围删除记录的key：start长度|start|end
+func encodeRangeKey(start, end []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen32+len(start)+len(end))
+	n := binary.PutUvarint(buf, uint64(len(start)))
+	n += copy(buf[n:], start)
+	n += copy(buf[n:], end)
+	return buf[:n]
+}
+
+func decodeRangeKey(key []byte) ([]byte, []byte) {
+	startLen, n := binary.Uvarint(key)
+	if n <= 0 || uint64(len(key)-n) < startLen {
+		return nil, nil
+	}
+	start := key[n : n+int(startLen)]
+	return start, key[n+int(startLen):]
+}
@@ -0,0 +1,227 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 范围删除测试 ====================
+
+func putTenantData(t *testing.T, db *DB) {
+	for _, tenant := range []string{"tenant-a", "tenant-b", "tenant-c"} {
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("%s/%02d", tenant, i)
+			assert.Nil(t, db.Put([]byte(key), []byte("value-"+key)))
+		}
+	}
+}
+
+func countKeys(t *testing.T, db *DB, prefix string) int {
+	it := db.NewIterator(IteratorOptions{Prefix: []byte(prefix)})
+	defer it.Close()
+	count := 0
+	for it.ReWind(); it.Valid(); it.Next() {
+		count++
+	}
+	return count
+}
+
+func TestDeleteRange(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	putTenantData(t, db)
+
+	// 删除[tenant-a/05, tenant-b/05)
+	assert.Nil(t, db.DeleteRange([]byte("tenant-a/05"), []byte("tenant-b/05")))
+	assert.Equal(t, 5, countKeys(t, db, "tenant-a"))
+	assert.Equal(t, 5, countKeys(t, db, "tenant-b"))
+	_, err = db.Get([]byte("tenant-a/05"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get([]byte("tenant-b/05"))
+	assert.Nil(t, err)
+
+	// start大于等于end时不删除任何数据
+	assert.Nil(t, db.DeleteRange([]byte("tenant-c"), []byte("tenant-a")))
+	assert.Equal(t, 10, countKeys(t, db, "tenant-c"))
+
+	// end为空时删除start之后的全部数据
+	assert.Nil(t, db.DeleteRange([]byte("tenant-c/05"), nil))
+	assert.Equal(t, 5, countKeys(t, db, "tenant-c"))
+
+	// 删除之后可以重新写入
+	assert.Nil(t, db.Put([]byte("tenant-a/06"), []byte("new")))
+	value, err := db.Get([]byte("tenant-a/06"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), value)
+}
+
+func TestDeletePrefix(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	putTenantData(t, db)
+	assert.Nil(t, db.Put([]byte("tenant-b"), []byte("tenant-b")))
+	assert.Nil(t, db.Put([]byte("tenant-bb"), []byte("tenant-bb")))
+
+	assert.Nil(t, db.DeletePrefix([]byte("tenant-b/")))
+	assert.Equal(t, 10, countKeys(t, db, "tenant-a"))
+	assert.Equal(t, 2, countKeys(t, db, "tenant-b"))
+	assert.Equal(t, 10, countKeys(t, db, "tenant-c"))
+
+	assert.Equal(t, ErrKeyisEmpty, db.DeletePrefix(nil))
+}
+
+func TestDeletePrefix_MaxByte(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte{0xfe}, []byte("1")))
+	assert.Nil(t, db.Put([]byte{0xff}, []byte("2")))
+	assert.Nil(t, db.Put([]byte{0xff, 0xff, 0x01}, []byte("3")))
+	assert.Nil(t, db.DeletePrefix([]byte{0xff, 0xff}))
+	assert.Equal(t, 2, len(db.ListKeys()))
+	assert.Nil(t, db.DeletePrefix([]byte{0xff}))
+	assert.Equal(t, [][]byte{{0xfe}}, db.ListKeys())
+}
+
+func TestPrefixEnd(t *testing.T) {
+	assert.Equal(t, []byte("b"), prefixEnd([]byte("a")))
+	assert.Equal(t, []byte("ac"), prefixEnd([]byte("ab")))
+	assert.Equal(t, []byte{0x02}, prefixEnd([]byte{0x01, 0xff}))
+	assert.Nil(t, prefixEnd([]byte{0xff, 0xff}))
+}
+
+func TestRangeKey_EncodeDecode(t *testing.T) {
+	start, end := decodeRangeKey(encodeRangeKey([]byte("start"), []byte("end")))
+	assert.Equal(t, []byte("start"), start)
+	assert.Equal(t, []byte("end"), end)
+
+	start, end = decodeRangeKey(encodeRangeKey(nil, nil))
+	assert.Equal(t, 0, len(start))
+	assert.Equal(t, 0, len(end))
+}
+
+// 重启时按照写入顺序重放范围删除
+func TestDeleteRange_Replay(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	putTenantData(t, db)
+	assert.Nil(t, db.DeletePrefix([]byte("tenant-a/")))
+	// 范围删除之后写入的数据不受影响
+	assert.Nil(t, db.Put([]byte("tenant-a/01"), []byte("after")))
+	assert.Nil(t, db.DeleteRange([]byte("tenant-b/00"), []byte("tenant-b/05")))
+	assert.Nil(t, db.Close())
+
+	for i := 0; i < 2; i++ {
+		// 第二次打开时从hint文件加载
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, countKeys(t, db, "tenant-a"))
+		assert.Equal(t, 5, countKeys(t, db, "tenant-b"))
+		assert.Equal(t, 10, countKeys(t, db, "tenant-c"))
+		value, err := db.Get([]byte("tenant-a/01"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("after"), value)
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestDeleteRange_SyncWrite(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncWrite = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	putTenantData(t, db)
+	assert.Nil(t, db.DeletePrefix([]byte("tenant-c/")))
+	assert.Equal(t, 0, countKeys(t, db, "tenant-c"))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 0, countKeys(t, db, "tenant-c"))
+	assert.Equal(t, 20, len(db.ListKeys()))
+}
+
+func TestDeleteRange_MergeOperands(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = AppendOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.MergeValue([]byte("log/1"), []byte("a")))
+	assert.Nil(t, db.DeletePrefix([]byte("log/")))
+	assert.Nil(t, db.MergeValue([]byte("log/1"), []byte("b")))
+	value, err := db.Get([]byte("log/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), value)
+}
+
+// merge之后范围删除记录和被删除的数据都不再保留
+func TestDeleteRange_Merge(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	putTenantData(t, db)
+	assert.Nil(t, db.DeletePrefix([]byte("tenant-a/")))
+	assert.Nil(t, db.Merge())
+	// merge开始之后的范围删除仍然需要保留
+	assert.Nil(t, db.DeletePrefix([]byte("tenant-b/")))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 0, countKeys(t, db, "tenant-a"))
+	assert.Equal(t, 0, countKeys(t, db, "tenant-b"))
+	assert.Equal(t, 10, countKeys(t, db, "tenant-c"))
+
+	// 再次merge并重启之后，数据文件中只有tenant-c的数据
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	files := []*data.DataFile{db.activeFile}
+	for _, file := range db.olderFiles {
+		files = append(files, file)
+	}
+	var keys []string
+	for _, file := range files {
+		offset := data.FileHeaderSize
+		for {
+			logRecord, size, err := file.ReadLogRecord(offset)
+			if err != nil {
+				break
+			}
+			realKey, _ := parseLogRecordKey(logRecord.Key)
+			keys = append(keys, string(realKey))
+			offset += size
+		}
+	}
+	assert.Equal(t, 10, len(keys))
+	for _, key := range keys {
+		assert.True(t, strings.HasPrefix(key, "tenant-c/"), key)
+	}
+}
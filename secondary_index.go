@@ -0,0 +1,402 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// 保存二级索引数据的列族
+const secondaryIndexCFName = "__secondary_index__"
+
+// 重建索引时每次写入的记录数
+const rebuildIndexBatchSize = 4096
+
+// 从主键和value中提取二级索引的key，一条数据可以对应多个索引key
+type IndexExtractor func(key, value []byte) [][]byte
+
+// 二级索引查询结果
+type IndexEntry struct {
+	IndexKey []byte
+	Key      []byte
+	Value    []byte
+}
+
+// 注册二级索引，之后默认列族的全部写入（包括MergeValue和DeleteRange）会在同一个事务中更新索引
+// 索引数据会持久化，重启后需要重新注册提取函数，注册之前已经存在的数据需要调用RebuildIndex建立索引
+func (db *DB) RegisterIndex(name string, extractor IndexExtractor) error {
+	if len(name) == 0 {
+		return ErrKeyisEmpty
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrDBClosed
+	}
+	if _, ok := db.secondaryIndexes[name]; ok {
+		return ErrSecondaryIndexExists
+	}
+	if db.columnFamilies[secondaryIndexCFName] == nil {
+		if _, err := db.createColumnFamily(secondaryIndexCFName, DefaultColumnFamilyOptions); err != nil {
+			return err
+		}
+	}
+	db.secondaryIndexes[name] = extractor
+	return nil
+}
+
+// 查询索引key以indexKeyPrefix开头的数据，按照索引key和主键排序
+func (db *DB) IndexScan(name string, indexKeyPrefix []byte) ([]*IndexEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	extractor, ok := db.secondaryIndexes[name]
+	if !ok {
+		return nil, ErrSecondaryIndexNotFound
+	}
+
+	var entries []*IndexEntry
+	lower := indexEntryPrefix(name, indexKeyPrefix)
+	iter := db.columnFamilies[secondaryIndexCFName].index.RangeIterator(lower, prefixEnd(lower), false)
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		_, indexKey, key, ok := decodeIndexEntryKey(iter.Key())
+		if !ok {
+			continue
+		}
+		recordPos := db.index.Get(key)
+		if recordPos == nil {
+			continue
+		}
+		value, err := db.getValue(key, recordPos)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 重启后重新注册索引之前的写入没有维护索引，可能留下过期的索引数据，查询时校验，merge时清理
+		if !containsKey(extractor(key, value), indexKey) {
+			continue
+		}
+		entries = append(entries, &IndexEntry{IndexKey: indexKey, Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// 根据已有的数据重新建立二级索引，重建期间会阻塞写入
+func (db *DB) RebuildIndex(name string) error {
+	return db.writeWithLock(context.Background(), func() error {
+		return db.rebuildIndex(name)
+	})
+}
+
+// 调用方需持有db.mu
+func (db *DB) rebuildIndex(name string) error {
+	if db.closed {
+		return ErrDBClosed
+	}
+	extractor, ok := db.secondaryIndexes[name]
+	if !ok {
+		return ErrSecondaryIndexNotFound
+	}
+	indexCF := db.columnFamilies[secondaryIndexCFName]
+
+	var records []*data.LogRecord
+	var keys [][]byte
+	flush := func() error {
+		if len(records) == 0 {
+			return nil
+		}
+		positions, err := db.appendLogRecords(records)
+		if err != nil {
+			return err
+		}
+		for i, rec := range records {
+			if err := indexCF.updateIndex(keys[i], rec.Type, positions[i]); err != nil {
+				return err
+			}
+		}
+		records, keys = records[:0], keys[:0]
+		return nil
+	}
+	add := func(entryKey []byte, typ data.LogRecordType) error {
+		records = append(records, &data.LogRecord{
+			Key:  logRecordWithSeqNo(entryKey, NonTxnSeqNo),
+			Type: typ,
+			CF:   indexCF.id,
+		})
+		keys = append(keys, entryKey)
+		if len(records) >= rebuildIndexBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	// 删除已有的索引数据
+	prefix := indexEntryPrefix(name, nil)
+	iter := indexCF.index.RangeIterator(prefix, prefixEnd(prefix), false)
+	for ; iter.Valid(); iter.Next() {
+		if err := add(iter.Key(), data.LogRecordDeleted); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	iter.Close()
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// 为全部数据建立索引
+	iter = db.index.Iterator(false)
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		value, err := db.getValue(iter.Key(), iter.Value())
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, indexKey := range dedupKeys(extractor(iter.Key(), value)) {
+			if err := add(encodeIndexEntryKey(name, indexKey, iter.Key()), data.LogRecordNormal); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return db.syncActiveFile()
+}
+
+// 判断索引数据是否已经过期：主键不存在，或者当前的value不再包含该索引key
+// 索引没有注册时无法判断，视为有效
+func (db *DB) isStaleIndexEntry(cf uint32, entryKey []byte) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	indexCF := db.columnFamilies[secondaryIndexCFName]
+	if indexCF == nil || indexCF.id != cf {
+		return false
+	}
+	name, indexKey, key, ok := decodeIndexEntryKey(entryKey)
+	if !ok {
+		return false
+	}
+	extractor, ok := db.secondaryIndexes[name]
+	if !ok {
+		return false
+	}
+	recordPos := db.index.Get(key)
+	if recordPos == nil {
+		return true
+	}
+	value, err := db.getValue(key, recordPos)
+	if err != nil {
+		return err == ErrKeyNotFound
+	}
+	return !containsKey(extractor(key, value), indexKey)
+}
+
+// 调用方需持有db.mu
+func (db *DB) hasSecondaryIndexes() bool {
+	return len(db.secondaryIndexes) > 0
+}
+
+// 存在二级索引时默认列族的写入需要同时维护索引，调用方需持有db.mu
+func (db *DB) needsSecondaryIndexes(logRecord *data.LogRecord) bool {
+	return logRecord.CF == DefaultCFID && logRecord.Type != data.LogRecordTxnFin && db.hasSecondaryIndexes()
+}
+
+// 在同一个事务中写入数据以及对应的二级索引变更，调用方需持有db.mu
+// writes中的记录使用原始key，只包含默认列族的写入、blob写入、合并操作数、删除以及范围删除
+func (db *DB) appendWithSecondaryIndexes(writes []*data.LogRecord, sync bool) error {
+	indexCF := db.columnFamilies[secondaryIndexCFName]
+	seqNo := atomic.AddUint64(&db.seqNo, 1)
+
+	var records []*data.LogRecord
+	var keys [][]byte
+	add := func(cf uint32, key, value []byte, typ data.LogRecordType) {
+		records = append(records, &data.LogRecord{
+			Key:   logRecordWithSeqNo(key, seqNo),
+			Value: value,
+			Type:  typ,
+			CF:    cf,
+		})
+		keys = append(keys, key)
+	}
+	// 根据写入前后的value计算索引key的变化，deleted为true表示key被删除
+	addIndexChanges := func(key, oldValue, newValue []byte, deleted bool) {
+		for name, extractor := range db.secondaryIndexes {
+			var oldKeys, newKeys [][]byte
+			if oldValue != nil {
+				oldKeys = dedupKeys(extractor(key, oldValue))
+			}
+			if !deleted {
+				newKeys = dedupKeys(extractor(key, newValue))
+			}
+			for _, indexKey := range oldKeys {
+				if !containsKey(newKeys, indexKey) {
+					add(indexCF.id, encodeIndexEntryKey(name, indexKey, key), nil, data.LogRecordDeleted)
+				}
+			}
+			for _, indexKey := range newKeys {
+				if !containsKey(oldKeys, indexKey) {
+					add(indexCF.id, encodeIndexEntryKey(name, indexKey, key), nil, data.LogRecordNormal)
+				}
+			}
+		}
+	}
+
+	for _, write := range writes {
+		if write.Type == data.LogRecordRangeDeleted {
+			// 删除范围内每个key的全部索引数据
+			start, end := decodeRangeKey(write.Key)
+			iter := db.index.RangeIterator(start, end, false)
+			for ; iter.Valid(); iter.Next() {
+				value, err := db.getValue(iter.Key(), iter.Value())
+				if err == ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					iter.Close()
+					return err
+				}
+				addIndexChanges(iter.Key(), value, nil, true)
+			}
+			iter.Close()
+			add(DefaultCFID, write.Key, nil, write.Type)
+			continue
+		}
+		// 计算写入前后索引key的变化
+		var oldValue []byte
+		var exists bool
+		if recordPos := db.index.Get(write.Key); recordPos != nil {
+			value, err := db.getValue(write.Key, recordPos)
+			if err != nil && err != ErrKeyNotFound {
+				return err
+			}
+			oldValue, exists = value, err == nil
+		}
+		newValue := write.Value
+		switch write.Type {
+		case data.LogRecordBlob:
+			// 索引从blob文件中完整的value提取
+			value, err := db.readBlobValue(data.DecodeBlobRef(write.Value))
+			if err != nil {
+				return err
+			}
+			newValue = value
+		case data.LogRecordMergeOperand:
+			// 索引从合并之后的value提取
+			existing := oldValue
+			if exists && existing == nil {
+				existing = []byte{}
+			}
+			value, err := db.options.MergeOperator.FullMerge(write.Key, existing, [][]byte{write.Value})
+			if err != nil {
+				return err
+			}
+			newValue = value
+		}
+		addIndexChanges(write.Key, oldValue, newValue, write.Type == data.LogRecordDeleted)
+		add(DefaultCFID, write.Key, write.Value, write.Type)
+		records[len(records)-1].Meta = write.Meta
+	}
+	add(DefaultCFID, TxnFinKey, nil, data.LogRecordTxnFin)
+
+	positions, err := db.appendLogRecords(records)
+	if err != nil {
+		return err
+	}
+	if sync || db.options.SyncWrite {
+		if err := db.syncActiveFile(); err != nil {
+			return err
+		}
+	}
+
+	// 数据写入之后再更新内存索引
+	for i, rec := range records {
+		if rec.Type == data.LogRecordTxnFin {
+			continue
+		}
+		if err := db.updateIndex(rec.CF, keys[i], rec.Type, positions[i], rec.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 索引数据的key：索引名称长度|索引名称|转义后的索引key|0x00 0x01|主键
+// 索引key中的0x00转义为0x00 0xFF，结束标识小于任何后续字节，保证按照索引key和主键排序
+func encodeIndexEntryKey(name string, indexKey, key []byte) []byte {
+	buf := indexEntryPrefix(name, indexKey)
+	buf = append(buf, 0x00, 0x01)
+	return append(buf, key...)
+}
+
+// 索引key以indexKeyPrefix开头的索引数据的公共前缀
+func indexEntryPrefix(name string, indexKeyPrefix []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen32, binary.MaxVarintLen32+len(name)+len(indexKeyPrefix)+2)
+	buf = append(buf[:binary.PutUvarint(buf, uint64(len(name)))], name...)
+	for _, b := range indexKeyPrefix {
+		if b == 0x00 {
+			buf = append(buf, 0x00, 0xFF)
+		} else {
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+// 解析索引数据的key，返回索引名称、索引key和主键
+func decodeIndexEntryKey(entryKey []byte) (string, []byte, []byte, bool) {
+	nameLen, n := binary.Uvarint(entryKey)
+	if n <= 0 || uint64(len(entryKey)-n) < nameLen {
+		return "", nil, nil, false
+	}
+	name := string(entryKey[n : n+int(nameLen)])
+	var indexKey []byte
+	for i := n + int(nameLen); i+1 < len(entryKey); i++ {
+		if entryKey[i] != 0x00 {
+			indexKey = append(indexKey, entryKey[i])
+			continue
+		}
+		switch entryKey[i+1] {
+		case 0xFF:
+			indexKey = append(indexKey, 0x00)
+			i++
+		case 0x01:
+			return name, indexKey, entryKey[i+2:], true
+		default:
+			return "", nil, nil, false
+		}
+	}
+	return "", nil, nil, false
+}
+
+func dedupKeys(keys [][]byte) [][]byte {
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !containsKey(result, key) {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 二级索引测试 ====================
+
+// value格式：email|city
+func emailExtractor(key, value []byte) [][]byte {
+	parts := bytes.SplitN(value, []byte("|"), 2)
+	if len(parts[0]) == 0 {
+		return nil
+	}
+	return [][]byte{parts[0]}
+}
+
+// value中以逗号分隔的标签
+func tagsExtractor(key, value []byte) [][]byte {
+	return bytes.Split(value, []byte(","))
+}
+
+func scanKeys(t *testing.T, db *DB, name, prefix string) []string {
+	entries, err := db.IndexScan(name, []byte(prefix))
+	assert.Nil(t, err)
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, string(entry.Key))
+	}
+	return keys
+}
+
+func openSecondaryIndexTestDB(t *testing.T, opts Options) *DB {
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.RegisterIndex("email", emailExtractor))
+	return db
+}
+
+func TestRegisterIndex(t *testing.T) {
+	opts := testOptions(t)
+
+	db := openSecondaryIndexTestDB(t, opts)
+	defer db.Close()
+
+	assert.Equal(t, ErrSecondaryIndexExists, db.RegisterIndex("email", emailExtractor))
+	assert.Equal(t, ErrKeyisEmpty, db.RegisterIndex("", emailExtractor))
+	_, err := db.IndexScan("missing", nil)
+	assert.Equal(t, ErrSecondaryIndexNotFound, err)
+	assert.Equal(t, ErrSecondaryIndexNotFound, db.RebuildIndex("missing"))
+
+	// 保存索引数据的列族对外不可见
+	assert.Equal(t, []string{DefaultColumnFamily}, db.ColumnFamilies())
+	assert.Nil(t, db.CF(secondaryIndexCFName))
+	_, err = db.CreateColumnFamily(secondaryIndexCFName, DefaultColumnFamilyOptions)
+	assert.Equal(t, ErrColumnFamilyReserved, err)
+}
+
+func TestIndexScan_PutDelete(t *testing.T) {
+	opts := testOptions(t)
+
+	db := openSecondaryIndexTestDB(t, opts)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("user-1"), []byte("alice@a.com|beijing")))
+	assert.Nil(t, db.Put([]byte("user-2"), []byte("bob@b.com|shanghai")))
+	assert.Nil(t, db.Put([]byte("user-3"), []byte("alice@a.com|shenzhen")))
+
+	entries, err := db.IndexScan("email", []byte("alice@a.com"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, []byte("alice@a.com"), entries[0].IndexKey)
+	assert.Equal(t, []byte("user-1"), entries[0].Key)
+	assert.Equal(t, []byte("alice@a.com|beijing"), entries[0].Value)
+	assert.Equal(t, []byte("user-3"), entries[1].Key)
+
+	// 前缀查询
+	assert.Equal(t, []string{"user-1", "user-3", "user-2"}, scanKeys(t, db, "email", ""))
+	assert.Equal(t, []string{"user-2"}, scanKeys(t, db, "email", "bob"))
+
+	// 更新之后旧的索引被删除
+	assert.Nil(t, db.Put([]byte("user-1"), []byte("alice@new.com|beijing")))
+	assert.Equal(t, []string{"user-3"}, scanKeys(t, db, "email", "alice@a.com"))
+	assert.Equal(t, []string{"user-1"}, scanKeys(t, db, "email", "alice@new.com"))
+
+	// 删除之后索引被删除
+	assert.Nil(t, db.Delete([]byte("user-3")))
+	assert.Nil(t, scanKeys(t, db, "email", "alice@a.com"))
+
+	// 索引数据只保存在保留的列族中
+	assert.Equal(t, 2, len(db.ListKeys()))
+	assert.Equal(t, 2, db.columnFamilies[secondaryIndexCFName].index.Size())
+}
+
+func TestIndexScan_MultipleKeys(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.RegisterIndex("tags", tagsExtractor))
+
+	assert.Nil(t, db.Put([]byte("post-1"), []byte("go,db,go")))
+	assert.Nil(t, db.Put([]byte("post-2"), []byte("db")))
+	assert.Equal(t, []string{"post-1", "post-2"}, scanKeys(t, db, "tags", "db"))
+	assert.Equal(t, []string{"post-1"}, scanKeys(t, db, "tags", "go"))
+
+	assert.Nil(t, db.Put([]byte("post-1"), []byte("go")))
+	assert.Equal(t, []string{"post-2"}, scanKeys(t, db, "tags", "db"))
+	assert.Equal(t, []string{"post-1"}, scanKeys(t, db, "tags", "go"))
+}
+
+// 索引key是另一个索引key的前缀时不会返回错误的结果
+func TestIndexScan_PrefixBoundary(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.RegisterIndex("tags", tagsExtractor))
+	assert.Nil(t, db.RegisterIndex("tag", tagsExtractor))
+
+	assert.Nil(t, db.Put([]byte("bc"), []byte("a")))
+	assert.Nil(t, db.Put([]byte("x"), []byte("ab")))
+	assert.Equal(t, []string{"x"}, scanKeys(t, db, "tags", "ab"))
+	assert.Equal(t, []string{"bc", "x"}, scanKeys(t, db, "tags", "a"))
+	assert.Equal(t, []string{"bc", "x"}, scanKeys(t, db, "tag", "a"))
+
+	// 先按索引key排序，再按主键排序
+	assert.Nil(t, db.Put([]byte("z"), []byte("a")))
+	assert.Nil(t, db.Put([]byte("b"), []byte("ab")))
+	assert.Equal(t, []string{"bc", "z", "b", "x"}, scanKeys(t, db, "tags", "a"))
+	entries, err := db.IndexScan("tags", []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), entries[1].IndexKey)
+	assert.Equal(t, []byte("ab"), entries[2].IndexKey)
+
+	// 索引key中包含0x00
+	assert.Nil(t, db.Put([]byte("zero"), []byte("a\x00b")))
+	assert.Equal(t, []string{"zero"}, scanKeys(t, db, "tags", "a\x00"))
+	assert.Equal(t, []string{"bc", "z", "zero", "b", "x"}, scanKeys(t, db, "tags", "a"))
+}
+
+func TestIndexScan_WriteBatch(t *testing.T) {
+	for _, syncWrites := range []bool{false, true} {
+		opts := testOptions(t)
+
+		db := openSecondaryIndexTestDB(t, opts)
+		assert.Nil(t, db.Put([]byte("user-1"), []byte("alice@a.com|beijing")))
+
+		wbOpts := DefaultWriteBatchOptions
+		wbOpts.SyncWrites = syncWrites
+		wb := db.NewWriteBatch(wbOpts)
+		assert.Nil(t, wb.Put([]byte("user-2"), []byte("bob@b.com|shanghai")))
+		assert.Nil(t, wb.Put([]byte("user-3"), []byte("carol@c.com|shanghai")))
+		assert.Nil(t, wb.Delete([]byte("user-1")))
+		assert.Nil(t, wb.Commit())
+
+		assert.Equal(t, []string{"user-2", "user-3"}, scanKeys(t, db, "email", ""))
+
+		// 条件不满足时索引也不会更新
+		wb = db.NewWriteBatch(wbOpts)
+		assert.Nil(t, wb.PutIfAbsent([]byte("user-2"), []byte("dave@d.com|beijing")))
+		assert.Equal(t, ErrConditionFailed, wb.Commit())
+		assert.Nil(t, scanKeys(t, db, "email", "dave"))
+
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestIndexScan_Conditional(t *testing.T) {
+	opts := testOptions(t)
+
+	db := openSecondaryIndexTestDB(t, opts)
+	defer db.Close()
+
+	ok, err := db.PutIfAbsent([]byte("user-1"), []byte("alice@a.com|beijing"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.CompareAndSwap([]byte("user-1"), []byte("alice@a.com|beijing"), []byte("alice@b.com|beijing"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"user-1"}, scanKeys(t, db, "email", "alice@b.com"))
+	assert.Nil(t, scanKeys(t, db, "email", "alice@a.com"))
+
+	ok, err = db.DeleteIfEquals([]byte("user-1"), []byte("alice@b.com|beijing"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, scanKeys(t, db, "email", ""))
+}
+
+func TestIndexScan_SyncWrite(t *testing.T) {
+	opts := testOptions(t)
+	opts.SyncWrite = true
+
+	db := openSecondaryIndexTestDB(t, opts)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("user-1"), []byte("alice@a.com|beijing")))
+	assert.Nil(t, db.Put([]byte("user-1"), []byte("alice@b.com|beijing")))
+	assert.Equal(t, []string{"user-1"}, scanKeys(t, db, "email", "alice@b.com"))
+	assert.Nil(t, db.Delete([]byte("user-1")))
+	assert.Nil(t, scanKeys(t, db, "email", ""))
+}
+
+// 以流的方式写入的大value同样维护二级索引
+func TestIndexScan_PutStream(t *testing.T) {
+	for _, syncWrite := range []bool{false, true} {
+		opts := testOptions(t)
+		opts.BlobThreshold = 16
+		opts.SyncWrite = syncWrite
+
+		db := openSecondaryIndexTestDB(t, opts)
+		large := "alice@a.com|" + strings.Repeat("x", 64)
+		assert.Nil(t, db.PutStream([]byte("user-1"), strings.NewReader(large)))
+		assert.Nil(t, db.PutStream([]byte("user-2"), strings.NewReader("bob@b.com|sh")))
+		assert.Equal(t, []string{"user-1"}, scanKeys(t, db, "email", "alice@"))
+		assert.Equal(t, []string{"user-2"}, scanKeys(t, db, "email", "bob@"))
+
+		// 覆盖blob中的旧值时删除旧的索引项
+		assert.Nil(t, db.PutStream([]byte("user-1"), strings.NewReader("carol@c.com|"+strings.Repeat("y", 64))))
+		assert.Nil(t, scanKeys(t, db, "email", "alice@"))
+		assert.Equal(t, []string{"user-1"}, scanKeys(t, db, "email", "carol@"))
+		assert.Nil(t, db.Close())
+	}
+}
+
+// 重启之后重新注册索引即可查询，不需要重建
+func TestIndexScan_Persistence(t *testing.T) {
+	opts := testOptions(t)
+	opts.MaxFileSize = 512
+
+	db := openSecondaryIndexTestDB(t, opts)
+	for i := 0; i < 30; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("user-%02d", i)), []byte(fmt.Sprintf("u%d@%d.com|city", i%3, i))))
+	}
+	assert.Nil(t, db.Delete([]byte("user-00")))
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Put([]byte("user-30"), []byte("u0@30.com|city")))
+	assert.Nil(t, db.Close())
+
+	for i := 0; i < 2; i++ {
+		db = openSecondaryIndexTestDB(t, opts)
+		assert.Equal(t, 10, len(scanKeys(t, db, "email", "u0@")))
+		assert.Equal(t, 10, len(scanKeys(t, db, "email", "u1@")))
+		assert.Equal(t, 30, len(scanKeys(t, db, "email", "")))
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = AppendOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// 注册索引之前写入的数据
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("user-%d", i)), []byte(fmt.Sprintf("u%d@a.com|city", i%2))))
+	}
+	assert.Nil(t, db.RegisterIndex("email", emailExtractor))
+	assert.Nil(t, scanKeys(t, db, "email", ""))
+
+	assert.Nil(t, db.RebuildIndex("email"))
+	assert.Equal(t, 5, len(scanKeys(t, db, "email", "u0@")))
+	assert.Equal(t, 10, len(scanKeys(t, db, "email", "")))
+
+	// 合并操作数和范围删除同样维护索引
+	assert.Nil(t, db.MergeValue([]byte("user-0"), []byte("x")))
+	assert.Nil(t, db.DeletePrefix([]byte("user-1")))
+	assert.Equal(t, 9, len(scanKeys(t, db, "email", "")))
+	assert.Equal(t, 9, db.columnFamilies[secondaryIndexCFName].index.Size())
+
+	assert.Nil(t, db.RebuildIndex("email"))
+	assert.Equal(t, 9, len(scanKeys(t, db, "email", "")))
+	assert.Equal(t, 9, db.columnFamilies[secondaryIndexCFName].index.Size())
+	entries, err := db.IndexScan("email", []byte("u0@a.com"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("user-0"), entries[0].Key)
+	assert.Equal(t, []byte("u0@a.com|cityx"), entries[0].Value)
+}
+
+// merge时清理没有维护索引的写入留下的过期索引数据
+func TestIndexScan_MergeRemovesStaleEntries(t *testing.T) {
+	opts := testOptions(t)
+
+	db := openSecondaryIndexTestDB(t, opts)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("user-%d", i)), []byte(fmt.Sprintf("u%d@a.com|city", i))))
+	}
+	assert.Nil(t, db.Put([]byte("solo"), []byte("s@a.com")))
+	assert.Nil(t, db.Close())
+
+	// 重启后没有注册索引时的写入不会维护索引
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("solo"), []byte("t@a.com")))
+	assert.Nil(t, db.DeletePrefix([]byte("user-1")))
+	assert.Nil(t, db.Close())
+
+	db = openSecondaryIndexTestDB(t, opts)
+	assert.Equal(t, 9, len(scanKeys(t, db, "email", "")))
+	assert.Equal(t, 11, db.columnFamilies[secondaryIndexCFName].index.Size())
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	db = openSecondaryIndexTestDB(t, opts)
+	defer db.Close()
+	assert.Equal(t, 9, len(scanKeys(t, db, "email", "")))
+	assert.Equal(t, 9, db.columnFamilies[secondaryIndexCFName].index.Size())
+}
+
+// 合并操作数按照合并之后的value维护索引，范围删除会删除范围内的索引数据
+func TestIndexScan_MergeValueAndDeleteRange(t *testing.T) {
+	opts := testOptions(t)
+	opts.MergeOperator = AppendOperator
+	// 同步写入时组提交不维护索引，在锁内重新写入
+	opts.SyncWrite = true
+
+	db := openSecondaryIndexTestDB(t, opts)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("user-0"), []byte("u0@a.com")))
+	assert.Nil(t, db.MergeValue([]byte("user-0"), []byte("|city")))
+	assert.Nil(t, db.MergeValue([]byte("user-1"), []byte("u1@a.com")))
+	assert.Nil(t, db.MergeValue([]byte("user-2"), []byte("u2")))
+	assert.Nil(t, db.MergeValue([]byte("user-2"), []byte("@a.com")))
+
+	entries, err := db.IndexScan("email", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	for i, entry := range entries {
+		assert.Equal(t, []byte(fmt.Sprintf("u%d@a.com", i)), entry.IndexKey)
+		assert.Equal(t, []byte(fmt.Sprintf("user-%d", i)), entry.Key)
+	}
+	assert.Equal(t, 3, db.columnFamilies[secondaryIndexCFName].index.Size())
+
+	assert.Nil(t, db.DeleteRange([]byte("user-0"), []byte("user-2")))
+	assert.Equal(t, []string{"user-2"}, scanKeys(t, db, "email", ""))
+	assert.Equal(t, 1, db.columnFamilies[secondaryIndexCFName].index.Size())
+}
@@ -0,0 +1,275 @@
+package typed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidEncoding = errors.New("invalid encoding")
+
+// 类型与字节之间的编解码，作为key使用时编码结果的字节序需要与值的顺序一致
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// 使用函数实现Codec，可以接入protobuf等自定义序列化
+type CodecFunc[T any] struct {
+	EncodeFunc func(v T) ([]byte, error)
+	DecodeFunc func(data []byte) (T, error)
+}
+
+func (c CodecFunc[T]) Encode(v T) ([]byte, error) {
+	return c.EncodeFunc(v)
+}
+
+func (c CodecFunc[T]) Decode(data []byte) (T, error) {
+	return c.DecodeFunc(data)
+}
+
+// ==================== 保序的key编码 ====================
+
+type Signed interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+type Unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+type stringCodec struct{}
+
+// 字符串原样编码，字节序与字符串的比较顺序一致
+func String() Codec[string] {
+	return stringCodec{}
+}
+
+func (stringCodec) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (stringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+type bytesCodec struct{}
+
+// 字节切片原样编码
+func Bytes() Codec[[]byte] {
+	return bytesCodec{}
+}
+
+func (bytesCodec) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (bytesCodec) Decode(data []byte) ([]byte, error) {
+	return append([]byte{}, data...), nil
+}
+
+type uintCodec[T Unsigned] struct{}
+
+// 无符号整数编码为8字节大端序
+func Uint[T Unsigned]() Codec[T] {
+	return uintCodec[T]{}
+}
+
+func (uintCodec[T]) Encode(v T) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(v)), nil
+}
+
+func (uintCodec[T]) Decode(data []byte) (T, error) {
+	if len(data) != 8 {
+		return 0, ErrInvalidEncoding
+	}
+	return T(binary.BigEndian.Uint64(data)), nil
+}
+
+type intCodec[T Signed] struct{}
+
+// 有符号整数翻转符号位后编码为8字节大端序，负数排在正数之前
+func Int[T Signed]() Codec[T] {
+	return intCodec[T]{}
+}
+
+func (intCodec[T]) Encode(v T) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(int64(v))^(1<<63)), nil
+}
+
+func (intCodec[T]) Decode(data []byte) (T, error) {
+	if len(data) != 8 {
+		return 0, ErrInvalidEncoding
+	}
+	return T(int64(binary.BigEndian.Uint64(data) ^ (1 << 63))), nil
+}
+
+// 两个元素的元组，按First、Second的顺序比较
+type Tuple2[A, B any] struct {
+	First  A
+	Second B
+}
+
+// 三个元素的元组，按First、Second、Third的顺序比较
+type Tuple3[A, B, C any] struct {
+	First  A
+	Second B
+	Third  C
+}
+
+type tuple2Codec[A, B any] struct {
+	a Codec[A]
+	b Codec[B]
+}
+
+// 元组的每个元素转义后依次拼接，编码结果的字节序与按元素逐个比较的顺序一致
+func Tuple2Codec[A, B any](a Codec[A], b Codec[B]) Codec[Tuple2[A, B]] {
+	return tuple2Codec[A, B]{a: a, b: b}
+}
+
+func (c tuple2Codec[A, B]) Encode(v Tuple2[A, B]) ([]byte, error) {
+	var buf []byte
+	var err error
+	if buf, err = appendTupleElem(buf, c.a, v.First); err != nil {
+		return nil, err
+	}
+	return appendTupleElem(buf, c.b, v.Second)
+}
+
+func (c tuple2Codec[A, B]) Decode(data []byte) (Tuple2[A, B], error) {
+	var v Tuple2[A, B]
+	var err error
+	if v.First, data, err = readTupleElem(data, c.a); err != nil {
+		return v, err
+	}
+	if v.Second, data, err = readTupleElem(data, c.b); err != nil {
+		return v, err
+	}
+	if len(data) != 0 {
+		return v, ErrInvalidEncoding
+	}
+	return v, nil
+}
+
+type tuple3Codec[A, B, C any] struct {
+	a Codec[A]
+	b Codec[B]
+	c Codec[C]
+}
+
+func Tuple3Codec[A, B, C any](a Codec[A], b Codec[B], c Codec[C]) Codec[Tuple3[A, B, C]] {
+	return tuple3Codec[A, B, C]{a: a, b: b, c: c}
+}
+
+func (c tuple3Codec[A, B, C]) Encode(v Tuple3[A, B, C]) ([]byte, error) {
+	var buf []byte
+	var err error
+	if buf, err = appendTupleElem(buf, c.a, v.First); err != nil {
+		return nil, err
+	}
+	if buf, err = appendTupleElem(buf, c.b, v.Second); err != nil {
+		return nil, err
+	}
+	return appendTupleElem(buf, c.c, v.Third)
+}
+
+func (c tuple3Codec[A, B, C]) Decode(data []byte) (Tuple3[A, B, C], error) {
+	var v Tuple3[A, B, C]
+	var err error
+	if v.First, data, err = readTupleElem(data, c.a); err != nil {
+		return v, err
+	}
+	if v.Second, data, err = readTupleElem(data, c.b); err != nil {
+		return v, err
+	}
+	if v.Third, data, err = readTupleElem(data, c.c); err != nil {
+		return v, err
+	}
+	if len(data) != 0 {
+		return v, ErrInvalidEncoding
+	}
+	return v, nil
+}
+
+// 元组元素中的0x00转义为0x00 0xff，以0x00 0x01结尾，较短的元素排在以它为前缀的元素之前
+func appendTupleElem[T any](buf []byte, codec Codec[T], v T) ([]byte, error) {
+	data, err := codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range data {
+		buf = append(buf, b)
+		if b == 0x00 {
+			buf = append(buf, 0xff)
+		}
+	}
+	return append(buf, 0x00, 0x01), nil
+}
+
+func readTupleElem[T any](data []byte, codec Codec[T]) (T, []byte, error) {
+	var elem []byte
+	for i := 0; i < len(data); i++ {
+		if data[i] != 0x00 {
+			elem = append(elem, data[i])
+			continue
+		}
+		if i+1 >= len(data) {
+			break
+		}
+		switch data[i+1] {
+		case 0xff:
+			elem = append(elem, 0x00)
+			i++
+		case 0x01:
+			v, err := codec.Decode(elem)
+			return v, data[i+2:], err
+		default:
+			var zero T
+			return zero, nil, ErrInvalidEncoding
+		}
+	}
+	var zero T
+	return zero, nil, ErrInvalidEncoding
+}
+
+// ==================== value编码 ====================
+
+type jsonCodec[T any] struct{}
+
+// 使用encoding/json编码value
+func JSON[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+type gobCodec[T any] struct{}
+
+// 使用encoding/gob编码value，每个value单独编码，包含完整的类型信息
+func Gob[T any]() Codec[T] {
+	return gobCodec[T]{}
+}
+
+func (gobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
@@ -0,0 +1,112 @@
+package typed
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 编码后的字节序与values的顺序一致，并且可以正确解码
+func assertOrdered[T any](t *testing.T, codec Codec[T], values []T) {
+	var encoded [][]byte
+	for _, v := range values {
+		data, err := codec.Encode(v)
+		assert.Nil(t, err)
+		decoded, err := codec.Decode(data)
+		assert.Nil(t, err)
+		assert.Equal(t, v, decoded)
+		encoded = append(encoded, data)
+	}
+	assert.True(t, sort.SliceIsSorted(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	}))
+	for i := 1; i < len(encoded); i++ {
+		assert.Equal(t, -1, bytes.Compare(encoded[i-1], encoded[i]), "%v < %v", values[i-1], values[i])
+	}
+}
+
+func TestCodec_Int(t *testing.T) {
+	assertOrdered(t, Int[int64](), []int64{math.MinInt64, -1 << 40, -256, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt64})
+	assertOrdered(t, Int[int](), []int{-10, -2, 0, 3, 100})
+	assertOrdered(t, Int[int8](), []int8{math.MinInt8, -1, 0, 1, math.MaxInt8})
+
+	_, err := Int[int64]().Decode([]byte{1, 2, 3})
+	assert.Equal(t, ErrInvalidEncoding, err)
+}
+
+func TestCodec_Uint(t *testing.T) {
+	assertOrdered(t, Uint[uint64](), []uint64{0, 1, 255, 256, 1 << 32, math.MaxUint64})
+	assertOrdered(t, Uint[uint16](), []uint16{0, 9, 10, 100, math.MaxUint16})
+
+	_, err := Uint[uint32]().Decode(nil)
+	assert.Equal(t, ErrInvalidEncoding, err)
+}
+
+func TestCodec_String(t *testing.T) {
+	assertOrdered(t, String(), []string{"", "a", "a\x00", "ab", "b"})
+	assertOrdered(t, Bytes(), [][]byte{{0}, {0, 0}, {1}, {1, 0xff}})
+}
+
+func TestCodec_Tuple(t *testing.T) {
+	codec := Tuple2Codec(String(), Int[int64]())
+	assertOrdered(t, codec, []Tuple2[string, int64]{
+		{"", -1},
+		{"", 5},
+		{"a", math.MinInt64},
+		{"a", 0},
+		{"a", 1},
+		{"a\x00", -5},
+		{"a\x00b", 0},
+		{"ab", -100},
+		{"b", 0},
+	})
+
+	triple := Tuple3Codec(Uint[uint32](), String(), String())
+	assertOrdered(t, triple, []Tuple3[uint32, string, string]{
+		{0, "user", "a"},
+		{0, "user", "b"},
+		{0, "users", ""},
+		{1, "", ""},
+		{256, "a", "\x00"},
+	})
+
+	// 元组嵌套
+	nested := Tuple2Codec(codec, String())
+	assertOrdered(t, nested, []Tuple2[Tuple2[string, int64], string]{
+		{Tuple2[string, int64]{"a", 1}, "z"},
+		{Tuple2[string, int64]{"a", 2}, ""},
+		{Tuple2[string, int64]{"b", 0}, "a"},
+	})
+
+	for _, data := range [][]byte{nil, {'a'}, {'a', 0x00}, {'a', 0x00, 0x02}, append([]byte{'a', 0x00, 0x01}, 'x')} {
+		_, err := Tuple2Codec(String(), String()).Decode(data)
+		assert.Equal(t, ErrInvalidEncoding, err, "%v", data)
+	}
+}
+
+type testUser struct {
+	Name string
+	Age  int
+	Tags []string
+}
+
+func TestCodec_Values(t *testing.T) {
+	user := testUser{Name: "alice", Age: 30, Tags: []string{"admin"}}
+	for _, codec := range []Codec[testUser]{JSON[testUser](), Gob[testUser]()} {
+		data, err := codec.Encode(user)
+		assert.Nil(t, err)
+		decoded, err := codec.Decode(data)
+		assert.Nil(t, err)
+		assert.Equal(t, user, decoded)
+
+		_, err = codec.Decode([]byte("\xff invalid"))
+		assert.NotNil(t, err)
+	}
+
+	data, err := JSON[testUser]().Encode(user)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Name":"alice","Age":30,"Tags":["admin"]}`, string(data))
+}
@@ -0,0 +1,175 @@
+package typed
+
+import (
+	"bcdb"
+)
+
+// 在bcdb.DB之上提供带类型的读写，key和value通过Codec编解码
+type Store[K, V any] struct {
+	db     *bcdb.DB
+	keys   Codec[K]
+	values Codec[V]
+}
+
+func New[K, V any](db *bcdb.DB, keys Codec[K], values Codec[V]) *Store[K, V] {
+	return &Store[K, V]{db: db, keys: keys, values: values}
+}
+
+// 底层的数据库
+func (s *Store[K, V]) DB() *bcdb.DB {
+	return s.db
+}
+
+func (s *Store[K, V]) Put(key K, value V) error {
+	encKey, err := s.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+	encValue, err := s.values.Encode(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(encKey, encValue)
+}
+
+// key不存在时返回bcdb.ErrKeyNotFound
+func (s *Store[K, V]) Get(key K) (V, error) {
+	var zero V
+	encKey, err := s.keys.Encode(key)
+	if err != nil {
+		return zero, err
+	}
+	encValue, err := s.db.Get(encKey)
+	if err != nil {
+		return zero, err
+	}
+	return s.values.Decode(encValue)
+}
+
+func (s *Store[K, V]) Delete(key K) error {
+	encKey, err := s.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(encKey)
+}
+
+// ==================== 迭代器 ====================
+
+type IteratorOptions[K any] struct {
+	Reverse bool
+	// 只遍历大于等于LowerBound的key，为nil表示不限制
+	LowerBound *K
+	// 只遍历小于UpperBound的key，为nil表示不限制
+	UpperBound *K
+}
+
+// 带类型的迭代器，key或value解码失败时返回错误
+type Iterator[K, V any] struct {
+	it     *bcdb.Iterator
+	keys   Codec[K]
+	values Codec[V]
+	err    error // 编码key失败的错误
+}
+
+func (s *Store[K, V]) NewIterator(options IteratorOptions[K]) (*Iterator[K, V], error) {
+	iterOpts := bcdb.IteratorOptions{Reverse: options.Reverse}
+	var err error
+	if options.LowerBound != nil {
+		if iterOpts.LowerBound, err = s.keys.Encode(*options.LowerBound); err != nil {
+			return nil, err
+		}
+	}
+	if options.UpperBound != nil {
+		if iterOpts.UpperBound, err = s.keys.Encode(*options.UpperBound); err != nil {
+			return nil, err
+		}
+	}
+	return &Iterator[K, V]{it: s.db.NewIterator(iterOpts), keys: s.keys, values: s.values}, nil
+}
+
+func (it *Iterator[K, V]) ReWind() {
+	it.err = nil
+	it.it.ReWind()
+}
+
+// 定位到第一个大于等于（反向时小于等于）key的位置
+func (it *Iterator[K, V]) Seek(key K) {
+	encKey, err := it.keys.Encode(key)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.err = nil
+	it.it.Seek(encKey)
+}
+
+func (it *Iterator[K, V]) Next() {
+	it.it.Next()
+}
+
+func (it *Iterator[K, V]) Valid() bool {
+	return it.err == nil && it.it.Valid()
+}
+
+// Seek时编码key失败的错误，或者底层迭代器的错误
+func (it *Iterator[K, V]) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.it.Err()
+}
+
+func (it *Iterator[K, V]) Key() (K, error) {
+	return it.keys.Decode(it.it.Key())
+}
+
+func (it *Iterator[K, V]) Value() (V, error) {
+	encValue, err := it.it.Value()
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return it.values.Decode(encValue)
+}
+
+func (it *Iterator[K, V]) Close() {
+	it.it.Close()
+}
+
+// ==================== 批量写入 ====================
+
+// 带类型的批量写入，提交时原子生效
+type Batch[K, V any] struct {
+	wb     *bcdb.WriteBatch
+	keys   Codec[K]
+	values Codec[V]
+}
+
+func (s *Store[K, V]) NewBatch(options bcdb.WriteBatchOptions) *Batch[K, V] {
+	return &Batch[K, V]{wb: s.db.NewWriteBatch(options), keys: s.keys, values: s.values}
+}
+
+func (b *Batch[K, V]) Put(key K, value V) error {
+	encKey, err := b.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+	encValue, err := b.values.Encode(value)
+	if err != nil {
+		return err
+	}
+	return b.wb.Put(encKey, encValue)
+}
+
+func (b *Batch[K, V]) Delete(key K) error {
+	encKey, err := b.keys.Encode(key)
+	if err != nil {
+		return err
+	}
+	return b.wb.Delete(encKey)
+}
+
+func (b *Batch[K, V]) Commit() error {
+	return b.wb.Commit()
+}
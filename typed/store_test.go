@@ -0,0 +1,185 @@
+package typed
+
+import (
+	"bcdb"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTypedTestDB(t *testing.T) *bcdb.DB {
+	opts := bcdb.DefaultOptions
+	opts.DirPath = t.TempDir()
+	db, err := bcdb.Open(opts)
+	assert.Nil(t, err)
+	return db
+}
+
+func TestStore_PutGetDelete(t *testing.T) {
+	db := openTypedTestDB(t)
+	defer db.Close()
+
+	users := New(db, Uint[uint64](), JSON[testUser]())
+	assert.Equal(t, db, users.DB())
+	assert.Nil(t, users.Put(1, testUser{Name: "alice", Age: 30}))
+	assert.Nil(t, users.Put(2, testUser{Name: "bob", Age: 25}))
+
+	user, err := users.Get(1)
+	assert.Nil(t, err)
+	assert.Equal(t, testUser{Name: "alice", Age: 30}, user)
+
+	assert.Nil(t, users.Delete(1))
+	_, err = users.Get(1)
+	assert.Equal(t, bcdb.ErrKeyNotFound, err)
+
+	// 底层数据可以通过bcdb直接读取
+	value, err := db.Get(binary.BigEndian.AppendUint64(nil, 2))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Name":"bob","Age":25,"Tags":null}`, string(value))
+
+	// value无法解码
+	assert.Nil(t, db.Put(binary.BigEndian.AppendUint64(nil, 3), []byte("not json")))
+	_, err = users.Get(3)
+	assert.NotNil(t, err)
+}
+
+// 数字key按数值顺序遍历，而不是按十进制字符串的顺序
+func TestStore_Iterator(t *testing.T) {
+	db := openTypedTestDB(t)
+	defer db.Close()
+
+	scores := New(db, Int[int64](), Gob[string]())
+	for _, k := range []int64{100, -5, 9, 10, 0, -100, 2} {
+		assert.Nil(t, scores.Put(k, "v"))
+	}
+
+	collect := func(options IteratorOptions[int64]) []int64 {
+		it, err := scores.NewIterator(options)
+		assert.Nil(t, err)
+		defer it.Close()
+		var keys []int64
+		for it.ReWind(); it.Valid(); it.Next() {
+			key, err := it.Key()
+			assert.Nil(t, err)
+			value, err := it.Value()
+			assert.Nil(t, err)
+			assert.Equal(t, "v", value)
+			keys = append(keys, key)
+		}
+		assert.Nil(t, it.Err())
+		return keys
+	}
+	assert.Equal(t, []int64{-100, -5, 0, 2, 9, 10, 100}, collect(IteratorOptions[int64]{}))
+	assert.Equal(t, []int64{100, 10, 9, 2, 0, -5, -100}, collect(IteratorOptions[int64]{Reverse: true}))
+	lower, upper := int64(-5), int64(10)
+	assert.Equal(t, []int64{-5, 0, 2, 9}, collect(IteratorOptions[int64]{LowerBound: &lower, UpperBound: &upper}))
+
+	it, err := scores.NewIterator(IteratorOptions[int64]{})
+	assert.Nil(t, err)
+	defer it.Close()
+	it.Seek(3)
+	assert.True(t, it.Valid())
+	key, err := it.Key()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), key)
+}
+
+func TestStore_TupleKeys(t *testing.T) {
+	db := openTypedTestDB(t)
+	defer db.Close()
+
+	type orderKey = Tuple2[string, uint64]
+	orders := New(db, Tuple2Codec(String(), Uint[uint64]()), String())
+	assert.Nil(t, orders.Put(orderKey{"bob", 2}, "b2"))
+	assert.Nil(t, orders.Put(orderKey{"alice", 10}, "a10"))
+	assert.Nil(t, orders.Put(orderKey{"alice", 9}, "a9"))
+	assert.Nil(t, orders.Put(orderKey{"alice\x00x", 1}, "ax1"))
+
+	// 遍历alice的全部订单
+	lower, upper := orderKey{"alice", 0}, orderKey{"alice\x00", 0}
+	it, err := orders.NewIterator(IteratorOptions[orderKey]{LowerBound: &lower, UpperBound: &upper})
+	assert.Nil(t, err)
+	defer it.Close()
+	var values []string
+	for it.ReWind(); it.Valid(); it.Next() {
+		value, err := it.Value()
+		assert.Nil(t, err)
+		values = append(values, value)
+	}
+	assert.Equal(t, []string{"a9", "a10"}, values)
+}
+
+func TestStore_Batch(t *testing.T) {
+	db := openTypedTestDB(t)
+	defer db.Close()
+
+	counters := New(db, String(), Uint[uint64]())
+	assert.Nil(t, counters.Put("deleted", 1))
+
+	batch := counters.NewBatch(bcdb.DefaultWriteBatchOptions)
+	assert.Nil(t, batch.Put("a", 1))
+	assert.Nil(t, batch.Put("b", 2))
+	assert.Nil(t, batch.Delete("deleted"))
+	_, err := counters.Get("a")
+	assert.Equal(t, bcdb.ErrKeyNotFound, err)
+	assert.Nil(t, batch.Commit())
+
+	value, err := counters.Get("b")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), value)
+	_, err = counters.Get("deleted")
+	assert.Equal(t, bcdb.ErrKeyNotFound, err)
+	assert.Equal(t, bcdb.ErrKeyisEmpty, batch.Put("", 1))
+}
+
+var errEncode = errors.New("encode failed")
+
+// 使用自定义的编解码函数，编码失败时不写入数据
+func TestStore_CodecFunc(t *testing.T) {
+	db := openTypedTestDB(t)
+	defer db.Close()
+
+	codec := CodecFunc[int]{
+		EncodeFunc: func(v int) ([]byte, error) {
+			if v < 0 {
+				return nil, errEncode
+			}
+			return binary.AppendUvarint(nil, uint64(v)), nil
+		},
+		DecodeFunc: func(data []byte) (int, error) {
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return 0, ErrInvalidEncoding
+			}
+			return int(v), nil
+		},
+	}
+	store := New(db, String(), Codec[int](codec))
+	assert.Nil(t, store.Put("key", 300))
+	value, err := store.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, 300, value)
+
+	assert.Equal(t, errEncode, store.Put("key", -1))
+	value, err = store.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, 300, value)
+
+	keyed := New(db, codec, String())
+	assert.Equal(t, errEncode, keyed.Put(-1, "value"))
+	_, err = keyed.Get(-1)
+	assert.Equal(t, errEncode, err)
+	assert.Equal(t, errEncode, keyed.Delete(-1))
+	bad := -1
+	_, err = keyed.NewIterator(IteratorOptions[int]{LowerBound: &bad})
+	assert.Equal(t, errEncode, err)
+
+	it, err := keyed.NewIterator(IteratorOptions[int]{})
+	assert.Nil(t, err)
+	defer it.Close()
+	it.Seek(-1)
+	assert.False(t, it.Valid())
+	assert.Equal(t, errEncode, it.Err())
+}
@@ -0,0 +1,220 @@
+package bcdb
+
+import (
+	"bcdb/data"
+	"math"
+	"time"
+)
+
+// key的一个版本在内存中的信息
+type keyVersion struct {
+	seqNo     uint64
+	timestamp int64
+	typ       data.LogRecordType
+	pos       *data.LogRecordPos
+}
+
+// 读取历史版本的结果
+type KeyVersion struct {
+	SeqNo     uint64
+	Timestamp time.Time
+	Value     []byte
+	Deleted   bool // 该版本删除了key
+}
+
+// 返回最新写入的版本号，可以作为之后GetAt读取的时间点
+func (db *DB) LatestSeqNo() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.versionSeq
+}
+
+// 读取key在版本号seqNo时的value，超出保留时间的版本返回ErrKeyNotFound
+func (db *DB) GetAt(key []byte, seqNo uint64) ([]byte, error) {
+	return db.getVersion(key, func(v *keyVersion) bool {
+		return v.seqNo <= seqNo
+	})
+}
+
+// 读取key在t时刻的value
+func (db *DB) GetAtTime(key []byte, t time.Time) ([]byte, error) {
+	ts := t.UnixNano()
+	return db.getVersion(key, func(v *keyVersion) bool {
+		return v.timestamp <= ts
+	})
+}
+
+// 按写入顺序返回key在保留时间内的全部版本，包含删除
+func (db *DB) History(key []byte) ([]*KeyVersion, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	chain, err := db.versionChain(key)
+	if err != nil {
+		return nil, err
+	}
+	var history []*KeyVersion
+	for i := firstVisibleVersion(chain, db.versionCutoff()); i < len(chain); i++ {
+		version := &KeyVersion{
+			SeqNo:     chain[i].seqNo,
+			Timestamp: time.Unix(0, chain[i].timestamp),
+		}
+		value, err := db.versionValue(key, chain, i)
+		switch err {
+		case nil:
+			version.Value = value
+		case ErrKeyNotFound:
+			version.Deleted = true
+		default:
+			return nil, err
+		}
+		history = append(history, version)
+	}
+	return history, nil
+}
+
+// 读取满足条件的最新版本
+func (db *DB) getVersion(key []byte, match func(v *keyVersion) bool) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	chain, err := db.versionChain(key)
+	if err != nil {
+		return nil, err
+	}
+	start := firstVisibleVersion(chain, db.versionCutoff())
+	for i := len(chain) - 1; i >= start; i-- {
+		if match(chain[i]) {
+			return db.versionValue(key, chain, i)
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (db *DB) versionChain(key []byte) ([]*keyVersion, error) {
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if len(key) == 0 {
+		return nil, ErrKeyisEmpty
+	}
+	if !db.options.KeepVersions {
+		return nil, ErrVersionsNotKept
+	}
+	chain := db.versions[string(key)]
+	if len(chain) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return chain, nil
+}
+
+// 读取第i个版本的value，合并操作数需要与之前的版本一起合并
+func (db *DB) versionValue(key []byte, chain []*keyVersion, i int) ([]byte, error) {
+	switch chain[i].typ {
+	case data.LogRecordDeleted:
+		return nil, ErrKeyNotFound
+	case data.LogRecordMergeOperand:
+		j := i
+		for j >= 0 && chain[j].typ == data.LogRecordMergeOperand {
+			j--
+		}
+		operands := &operandChain{}
+		if j >= 0 && chain[j].typ != data.LogRecordDeleted {
+			operands.base = chain[j].pos
+		}
+		for _, v := range chain[j+1 : i+1] {
+			operands.operands = append(operands.operands, v.pos)
+		}
+		return db.mergeOperands(key, operands)
+	default:
+		return db.getValueByPos(chain[i].pos)
+	}
+}
+
+// 为写入的记录加上写入时间，开启多版本时为默认列族的写入分配版本号，同一个事务的记录使用相同的版本号，调用方需持有db.mu
+func (db *DB) stampVersion(logRecord *data.LogRecord) {
+	switch logRecord.Type {
+	case data.LogRecordTxnFin, data.LogRecordHintFin:
+		return
+	}
+	if !db.options.KeepVersions || logRecord.CF != DefaultCFID || logRecord.Version.Seq != 0 {
+		// merge时写入的记录保留原有的写入时间
+		if logRecord.Version.Timestamp == 0 {
+			logRecord.Version.Timestamp = time.Now().UnixNano()
+		}
+		return
+	}
+	_, txnSeqNo := parseLogRecordKey(logRecord.Key)
+	if txnSeqNo == NonTxnSeqNo || txnSeqNo != db.lastTxnSeqNo {
+		db.versionSeq++
+		db.lastVersion = data.RecordVersion{Seq: db.versionSeq, Timestamp: time.Now().UnixNano()}
+		db.lastTxnSeqNo = txnSeqNo
+	}
+	logRecord.Version = db.lastVersion
+}
+
+// 将新的版本追加到key的版本链中，调用方需持有db.mu
+func (db *DB) addVersion(key []byte, typ data.LogRecordType, pos *data.LogRecordPos, ver data.RecordVersion) {
+	if !db.options.KeepVersions || ver.Seq == 0 {
+		return
+	}
+	chain := append(db.versions[string(key)], &keyVersion{
+		seqNo:     ver.Seq,
+		timestamp: ver.Timestamp,
+		typ:       typ,
+		pos:       pos,
+	})
+	if chain = pruneVersions(chain, db.versionCutoff()); chain == nil {
+		delete(db.versions, string(key))
+		return
+	}
+	db.versions[string(key)] = chain
+}
+
+// 清理超出保留时间的版本，返回仍需保留的版本在数据文件中的位置，merge时使用，调用方需持有db.mu
+func (db *DB) retainedVersions() map[data.LogRecordPos]struct{} {
+	retained := make(map[data.LogRecordPos]struct{})
+	cutoff := db.versionCutoff()
+	for key, chain := range db.versions {
+		if chain = pruneVersions(chain, cutoff); chain == nil {
+			delete(db.versions, key)
+			continue
+		}
+		db.versions[key] = chain
+		for _, v := range chain {
+			retained[data.LogRecordPos{Fid: v.pos.Fid, Offset: v.pos.Offset}] = struct{}{}
+		}
+	}
+	return retained
+}
+
+// 被覆盖的时间早于cutoff的版本不再可见
+func (db *DB) versionCutoff() int64 {
+	if db.options.VersionRetention <= 0 {
+		return math.MinInt64
+	}
+	return time.Now().Add(-db.options.VersionRetention).UnixNano()
+}
+
+// 第一个可见的版本，最新的版本始终可见
+func firstVisibleVersion(chain []*keyVersion, cutoff int64) int {
+	for i := 0; i < len(chain)-1; i++ {
+		if chain[i+1].timestamp >= cutoff {
+			return i
+		}
+	}
+	return len(chain) - 1
+}
+
+// 删除不可见的版本，保留可见的合并操作数所依赖的版本，只剩过期的删除时返回nil
+func pruneVersions(chain []*keyVersion, cutoff int64) []*keyVersion {
+	start := firstVisibleVersion(chain, cutoff)
+	for start > 0 && chain[start].typ == data.LogRecordMergeOperand {
+		start--
+	}
+	last := chain[len(chain)-1]
+	if start == len(chain)-1 && last.typ == data.LogRecordDeleted && last.timestamp < cutoff {
+		return nil
+	}
+	return chain[start:]
+}
@@ -0,0 +1,310 @@
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ==================== 多版本测试 ====================
+
+func historyValues(t *testing.T, db *DB, key string) []string {
+	history, err := db.History([]byte(key))
+	assert.Nil(t, err)
+	var values []string
+	for _, version := range history {
+		if version.Deleted {
+			values = append(values, "<deleted>")
+		} else {
+			values = append(values, string(version.Value))
+		}
+	}
+	return values
+}
+
+func TestDB_VersionsNotKept(t *testing.T) {
+	opts := testOptions(t)
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("key"), []byte("v1")))
+	_, err = db.History([]byte("key"))
+	assert.Equal(t, ErrVersionsNotKept, err)
+	_, err = db.GetAt([]byte("key"), 1)
+	assert.Equal(t, ErrVersionsNotKept, err)
+	assert.Equal(t, uint64(0), db.LatestSeqNo())
+}
+
+func TestDB_History(t *testing.T) {
+	opts := testOptions(t)
+	opts.KeepVersions = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("key"), []byte("v1")))
+	assert.Nil(t, db.Put([]byte("key"), []byte("v2")))
+	assert.Nil(t, db.Delete([]byte("key")))
+	assert.Nil(t, db.Put([]byte("key"), []byte("v3")))
+
+	history, err := db.History([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(history))
+	for i := 1; i < len(history); i++ {
+		assert.Greater(t, history[i].SeqNo, history[i-1].SeqNo)
+		assert.False(t, history[i].Timestamp.Before(history[i-1].Timestamp))
+	}
+	assert.Equal(t, []string{"v1", "v2", "<deleted>", "v3"}, historyValues(t, db, "key"))
+	assert.Equal(t, history[3].SeqNo, db.LatestSeqNo())
+
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), value)
+
+	_, err = db.History([]byte("missing"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.History(nil)
+	assert.Equal(t, ErrKeyisEmpty, err)
+}
+
+func TestDB_GetAt(t *testing.T) {
+	opts := testOptions(t)
+	opts.KeepVersions = true
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	var seqs []uint64
+	var times []time.Time
+	for _, value := range []string{"v1", "v2", "", "v3"} {
+		time.Sleep(2 * time.Millisecond)
+		if value == "" {
+			assert.Nil(t, db.Delete([]byte("key")))
+		} else {
+			assert.Nil(t, db.Put([]byte("key"), []byte(value)))
+		}
+		// 其他key的写入也会增加版本号
+		assert.Nil(t, db.Put([]byte("other"), []byte(value)))
+		seqs = append(seqs, db.LatestSeqNo())
+		times = append(times, time.Now())
+	}
+
+	expected := []string{"v1", "v2", "", "v3"}
+	for i, want := range expected {
+		value, err := db.GetAt([]byte("key"), seqs[i])
+		valueAtTime, errAtTime := db.GetAtTime([]byte("key"), times[i])
+		if want == "" {
+			assert.Equal(t, ErrKeyNotFound, err)
+			assert.Equal(t, ErrKeyNotFound, errAtTime)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(want), value)
+		assert.Nil(t, errAtTime)
+		assert.Equal(t, []byte(want), valueAtTime)
+	}
+
+	// 第一个版本之前key不存在
+	_, err = db.GetAt([]byte("key"), seqs[0]-2)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.GetAtTime([]byte("key"), times[0].Add(-time.Hour))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.GetAt([]byte("missing"), seqs[3])
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_VersionsWriteBatch(t *testing.T) {
+	for _, syncWrites := range []bool{false, true} {
+		opts := testOptions(t)
+		opts.KeepVersions = true
+
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Nil(t, db.Put([]byte("a"), []byte("a1")))
+
+		wbOpts := DefaultWriteBatchOptions
+		wbOpts.SyncWrites = syncWrites
+		wb := db.NewWriteBatch(wbOpts)
+		assert.Nil(t, wb.Put([]byte("a"), []byte("a2")))
+		assert.Nil(t, wb.Put([]byte("b"), []byte("b1")))
+		assert.Nil(t, wb.Commit())
+
+		// 同一个事务中的写入使用相同的版本号
+		historyA, err := db.History([]byte("a"))
+		assert.Nil(t, err)
+		historyB, err := db.History([]byte("b"))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(historyA))
+		assert.Equal(t, historyA[1].SeqNo, historyB[0].SeqNo)
+		assert.Equal(t, historyA[1].SeqNo, db.LatestSeqNo())
+
+		value, err := db.GetAt([]byte("a"), historyA[0].SeqNo)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("a1"), value)
+		_, err = db.GetAt([]byte("b"), historyA[0].SeqNo)
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestDB_VersionsMergeValueAndRangeDelete(t *testing.T) {
+	opts := testOptions(t)
+	opts.KeepVersions = true
+	opts.MergeOperator = AppendOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("key-1"), []byte("a")))
+	assert.Nil(t, db.MergeValue([]byte("key-1"), []byte("b")))
+	assert.Nil(t, db.MergeValue([]byte("key-1"), []byte("c")))
+	assert.Nil(t, db.Put([]byte("key-2"), []byte("x")))
+	assert.Nil(t, db.DeletePrefix([]byte("key-")))
+	assert.Nil(t, db.MergeValue([]byte("key-1"), []byte("d")))
+
+	assert.Equal(t, []string{"a", "ab", "abc", "<deleted>", "d"}, historyValues(t, db, "key-1"))
+	assert.Equal(t, []string{"x", "<deleted>"}, historyValues(t, db, "key-2"))
+}
+
+func TestDB_VersionsPersistence(t *testing.T) {
+	opts := testOptions(t)
+	opts.KeepVersions = true
+	opts.MaxFileSize = 256
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i%4)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	assert.Nil(t, db.Delete([]byte("key-0")))
+	latest := db.LatestSeqNo()
+	assert.Nil(t, db.Close())
+
+	// 第一次从数据文件加载，第二次从hint文件加载
+	for i := 0; i < 2; i++ {
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, latest, db.LatestSeqNo())
+		assert.Equal(t, []string{"value-1", "value-5", "value-9", "value-13", "value-17"}, historyValues(t, db, "key-1"))
+		assert.Equal(t, []string{"value-0", "value-4", "value-8", "value-12", "value-16", "<deleted>"}, historyValues(t, db, "key-0"))
+		assert.Nil(t, db.Close())
+	}
+
+	// 重启之后的版本号继续递增
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.Put([]byte("key-1"), []byte("new")))
+	assert.Equal(t, latest+1, db.LatestSeqNo())
+}
+
+func TestDB_VersionsMerge(t *testing.T) {
+	opts := testOptions(t)
+	opts.KeepVersions = true
+	opts.MaxFileSize = 256
+	opts.MergeOperator = AppendOperator
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("key-%d", i%4)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	assert.Nil(t, db.Delete([]byte("key-0")))
+	assert.Nil(t, db.MergeValue([]byte("key-1"), []byte("+")))
+	assert.Nil(t, db.DeleteRange([]byte("key-3"), nil))
+	wantKey1 := []string{"value-1", "value-5", "value-9", "value-13", "value-17", "value-17+"}
+
+	// 不限制保留时间时merge保留全部版本
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Equal(t, wantKey1, historyValues(t, db, "key-1"))
+	assert.Equal(t, []string{"value-0", "value-4", "value-8", "value-12", "value-16", "<deleted>"}, historyValues(t, db, "key-0"))
+	assert.Equal(t, []string{"value-3", "value-7", "value-11", "value-15", "value-19", "<deleted>"}, historyValues(t, db, "key-3"))
+	_, err = db.Get([]byte("key-0"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get([]byte("key-3"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.Get([]byte("key-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value-17+"), value)
+	assert.Equal(t, 2, len(db.ListKeys()))
+}
+
+func TestDB_VersionRetention(t *testing.T) {
+	opts := testOptions(t)
+	opts.KeepVersions = true
+	opts.VersionRetention = 100 * time.Millisecond
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key"), []byte("v1")))
+	v1Seq := db.LatestSeqNo()
+	assert.Nil(t, db.Put([]byte("key"), []byte("v2")))
+	assert.Nil(t, db.Put([]byte("deleted"), []byte("value")))
+	assert.Nil(t, db.Delete([]byte("deleted")))
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(t, db.Put([]byte("key"), []byte("v3")))
+
+	// v2在保留时间内仍是最新版本，保留；v1被覆盖的时间超过了保留时间
+	assert.Equal(t, []string{"v2", "v3"}, historyValues(t, db, "key"))
+	_, err = db.GetAt([]byte("key"), v1Seq)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, []string{"v3"}, historyValues(t, db, "key"))
+
+	// merge清理过期的版本，删除时间超过保留时间的key不再保留任何版本
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Equal(t, []string{"v3"}, historyValues(t, db, "key"))
+	_, err = db.History([]byte("deleted"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// merge之后数据文件中只剩最新的版本
+	dataFile, err := os.ReadFile(opts.DirPath + "/000000000.data")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bytes.Count(dataFile, []byte("key")))
+}
+
+func TestDB_VersionsBlob(t *testing.T) {
+	opts := testOptions(t)
+	opts.KeepVersions = true
+	opts.BlobThreshold = 16
+
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	large := bytes.Repeat([]byte("x"), 1024)
+	assert.Nil(t, db.PutStream([]byte("key"), bytes.NewReader(large)))
+	assert.Nil(t, db.Put([]byte("key"), []byte("small")))
+
+	// merge之后旧版本引用的blob文件仍然保留
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	history, err := db.History([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, large, history[0].Value)
+	assert.Equal(t, []byte("small"), history[1].Value)
+}
@@ -0,0 +1,190 @@
+package vfs
+
+import (
+	"bcdb/fio"
+	"math/rand"
+	"path/filepath"
+	"sync"
+)
+
+// 支持故障注入和模拟崩溃的文件系统，崩溃时丢弃所有未持久化的数据
+type FaultFS struct {
+	FS
+	Injector *fio.FaultInjector
+
+	mu    *sync.Mutex
+	files map[string]*fileState
+}
+
+// 文件已经持久化的大小
+type fileState struct {
+	synced int64
+	dirty  bool
+}
+
+func NewFaultFS(inner FS, injector *fio.FaultInjector) *FaultFS {
+	return &FaultFS{
+		FS:       inner,
+		Injector: injector,
+		mu:       new(sync.Mutex),
+		files:    make(map[string]*fileState),
+	}
+}
+
+func (f *FaultFS) OpenFile(name string) (fio.IOManager, error) {
+	name = filepath.Clean(name)
+	inner, err := f.FS.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	state, ok := f.files[name]
+	if !ok {
+		// 打开时已经存在的数据视为已经持久化
+		size, err := inner.Size()
+		if err != nil {
+			f.mu.Unlock()
+			_ = inner.Close()
+			return nil, err
+		}
+		state = &fileState{synced: size}
+		f.files[name] = state
+	}
+	f.mu.Unlock()
+
+	tracked := &trackedIO{IOManager: inner, fs: f, state: state}
+	return fio.NewFaultIOManager(tracked, f.Injector), nil
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.FS.Remove(name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.files, filepath.Clean(name))
+	return nil
+}
+
+func (f *FaultFS) RemoveAll(path string) error {
+	if err := f.FS.RemoveAll(path); err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name := range f.files {
+		if name == path || isChild(name, path) {
+			delete(f.files, name)
+		}
+	}
+	return nil
+}
+
+func (f *FaultFS) Rename(oldPath, newPath string) error {
+	if err := f.Injector.Inject(fio.FaultRename); err != nil {
+		return err
+	}
+	if err := f.FS.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if state, ok := f.files[oldPath]; ok {
+		delete(f.files, oldPath)
+		f.files[newPath] = state
+	}
+	return nil
+}
+
+// 模拟崩溃，之后的写入全部失败，并丢弃所有文件中未持久化的数据
+func (f *FaultFS) Crash() error {
+	return f.crash(nil)
+}
+
+// 模拟崩溃，未持久化的数据随机保留一部分，用于模拟写了一半的记录
+func (f *FaultFS) CrashWithTornWrites(r *rand.Rand) error {
+	return f.crash(r)
+}
+
+func (f *FaultFS) crash(r *rand.Rand) error {
+	f.Injector.Crash()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, state := range f.files {
+		if !state.dirty {
+			continue
+		}
+		file, err := f.FS.OpenFile(name)
+		if err != nil {
+			return err
+		}
+		size, err := file.Size()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		keep := state.synced
+		if r != nil && size > state.synced {
+			keep += r.Int63n(size - state.synced + 1)
+		}
+		if keep < size {
+			if err := file.Truncate(keep); err != nil {
+				_ = file.Close()
+				return err
+			}
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		state.synced, state.dirty = keep, false
+	}
+	return nil
+}
+
+// 记录文件持久化状态的IOManager
+type trackedIO struct {
+	fio.IOManager
+	fs    *FaultFS
+	state *fileState
+}
+
+func (t *trackedIO) Write(b []byte) (int, error) {
+	n, err := t.IOManager.Write(b)
+	if n > 0 {
+		t.fs.mu.Lock()
+		t.state.dirty = true
+		t.fs.mu.Unlock()
+	}
+	return n, err
+}
+
+func (t *trackedIO) Sync() error {
+	if err := t.IOManager.Sync(); err != nil {
+		return err
+	}
+	size, err := t.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	t.fs.mu.Lock()
+	t.state.synced = size
+	t.fs.mu.Unlock()
+	return nil
+}
+
+func (t *trackedIO) Truncate(size int64) error {
+	if err := t.IOManager.Truncate(size); err != nil {
+		return err
+	}
+	t.fs.mu.Lock()
+	if t.state.synced > size {
+		t.state.synced = size
+	}
+	t.state.dirty = true
+	t.fs.mu.Unlock()
+	return nil
+}
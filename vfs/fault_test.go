@@ -0,0 +1,57 @@
+package vfs
+
+import (
+	"bcdb/fio"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultFS_CrashDropsUnsynced(t *testing.T) {
+	memFS := NewMemFS()
+	assert.Nil(t, memFS.MkdirAll("/data"))
+	fs := NewFaultFS(memFS, fio.NewFaultInjector())
+
+	file, err := fs.OpenFile("/data/a.data")
+	assert.Nil(t, err)
+	_, err = file.Write([]byte("synced"))
+	assert.Nil(t, err)
+	assert.Nil(t, file.Sync())
+	_, err = file.Write([]byte("unsynced"))
+	assert.Nil(t, err)
+
+	// 重命名之后仍然能够追踪持久化状态
+	assert.Nil(t, fs.Rename("/data/a.data", "/data/b.data"))
+	assert.Nil(t, fs.Crash())
+
+	_, err = file.Write([]byte("after crash"))
+	assert.Equal(t, fio.ErrInjectedFault, err)
+
+	reopened, err := memFS.OpenFile("/data/b.data")
+	assert.Nil(t, err)
+	size, err := reopened.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), size)
+}
+
+func TestFaultFS_CrashWithTornWrites(t *testing.T) {
+	memFS := NewMemFS()
+	assert.Nil(t, memFS.MkdirAll("/data"))
+	fs := NewFaultFS(memFS, fio.NewFaultInjector())
+
+	file, err := fs.OpenFile("/data/a.data")
+	assert.Nil(t, err)
+	_, err = file.Write([]byte("synced"))
+	assert.Nil(t, err)
+	assert.Nil(t, file.Sync())
+	_, err = file.Write([]byte("unsynced"))
+	assert.Nil(t, err)
+	assert.Nil(t, fs.CrashWithTornWrites(rand.New(rand.NewSource(1))))
+
+	reopened, err := memFS.OpenFile("/data/a.data")
+	assert.Nil(t, err)
+	size, err := reopened.Size()
+	assert.Nil(t, err)
+	assert.True(t, size >= 6 && size <= 14)
+}
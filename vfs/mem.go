@@ -0,0 +1,178 @@
+package vfs
+
+import (
+	"bcdb/fio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 基于内存的文件系统，所有数据在进程退出后丢失
+type MemFS struct {
+	mu    *sync.Mutex
+	files map[string]*fio.MemFile
+	dirs  map[string]struct{}
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		mu:    new(sync.Mutex),
+		files: make(map[string]*fio.MemFile),
+		dirs:  make(map[string]struct{}),
+	}
+}
+
+func (m *MemFS) OpenFile(name string) (fio.IOManager, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.dirs[name]; ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := m.files[name]
+	if !ok {
+		if !m.dirExists(filepath.Dir(name)) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		file = fio.NewMemFile()
+		m.files[name] = file
+	}
+	return fio.NewMemoryIOManager(file), nil
+}
+
+func (m *MemFS) ReadDir(dirPath string) ([]string, error) {
+	dirPath = filepath.Clean(dirPath)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dirExists(dirPath) {
+		return nil, &fs.PathError{Op: "readdir", Path: dirPath, Err: fs.ErrNotExist}
+	}
+	var names []string
+	for name := range m.files {
+		if filepath.Dir(name) == dirPath {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	for dir := range m.dirs {
+		if dir != dirPath && filepath.Dir(dir) == dirPath {
+			names = append(names, filepath.Base(dir))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemFS) Exists(name string) (bool, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; ok {
+		return true, nil
+	}
+	return m.dirExists(name), nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if _, ok := m.dirs[name]; ok {
+		if m.hasChildren(name) {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+		}
+		delete(m.dirs, name)
+		return nil
+	}
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) RemoveAll(path string) error {
+	path = filepath.Clean(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.files {
+		if name == path || isChild(name, path) {
+			delete(m.files, name)
+		}
+	}
+	for dir := range m.dirs {
+		if dir == path || isChild(dir, path) {
+			delete(m.dirs, dir)
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Rename(oldPath, newPath string) error {
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, ok := m.files[oldPath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+	if !m.dirExists(filepath.Dir(newPath)) {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldPath)
+	m.files[newPath] = file
+	return nil
+}
+
+func (m *MemFS) MkdirAll(path string) error {
+	path = filepath.Clean(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		if _, ok := m.files[path]; ok {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: fs.ErrExist}
+		}
+		m.dirs[path] = struct{}{}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil
+		}
+		path = parent
+	}
+}
+
+// 根目录以及创建过的目录都视为存在
+func (m *MemFS) dirExists(dirPath string) bool {
+	if dirPath == filepath.Dir(dirPath) {
+		return true
+	}
+	_, ok := m.dirs[dirPath]
+	return ok
+}
+
+func (m *MemFS) hasChildren(dirPath string) bool {
+	for name := range m.files {
+		if isChild(name, dirPath) {
+			return true
+		}
+	}
+	for dir := range m.dirs {
+		if isChild(dir, dirPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func isChild(name, dirPath string) bool {
+	return strings.HasPrefix(name, strings.TrimSuffix(dirPath, string(filepath.Separator))+string(filepath.Separator))
+}
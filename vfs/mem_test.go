@@ -0,0 +1,72 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemFS_OpenFile(t *testing.T) {
+	fs := NewMemFS()
+
+	// 父目录不存在
+	_, err := fs.OpenFile("/data/a.data")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, fs.MkdirAll("/data"))
+	file, err := fs.OpenFile("/data/a.data")
+	assert.Nil(t, err)
+	_, err = file.Write([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	// 重新打开后数据仍然存在
+	file, err = fs.OpenFile("/data/a.data")
+	assert.Nil(t, err)
+	size, err := file.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), size)
+}
+
+func TestMemFS_ReadDir(t *testing.T) {
+	fs := NewMemFS()
+	_, err := fs.ReadDir("/data")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, fs.MkdirAll("/data/sub"))
+	for _, name := range []string{"/data/b.data", "/data/a.data", "/data/sub/c.data"} {
+		_, err := fs.OpenFile(name)
+		assert.Nil(t, err)
+	}
+	names, err := fs.ReadDir("/data")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.data", "b.data", "sub"}, names)
+}
+
+func TestMemFS_RemoveAndRename(t *testing.T) {
+	fs := NewMemFS()
+	assert.Nil(t, fs.MkdirAll("/data"))
+	assert.Nil(t, fs.MkdirAll("/data-merge"))
+	_, err := fs.OpenFile("/data-merge/a.data")
+	assert.Nil(t, err)
+
+	assert.Nil(t, fs.Rename("/data-merge/a.data", "/data/a.data"))
+	ok, err := fs.Exists("/data/a.data")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = fs.Exists("/data-merge/a.data")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.True(t, os.IsNotExist(fs.Remove("/data-merge/a.data")))
+	assert.Nil(t, fs.Remove("/data/a.data"))
+
+	assert.Nil(t, fs.RemoveAll("/data-merge"))
+	ok, err = fs.Exists("/data-merge")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = fs.Exists("/data")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
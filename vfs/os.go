@@ -0,0 +1,56 @@
+package vfs
+
+import (
+	"bcdb/fio"
+	"os"
+)
+
+// 操作系统文件系统
+type OSFS struct{}
+
+func NewOSFS() *OSFS {
+	return &OSFS{}
+}
+
+func (OSFS) OpenFile(name string) (fio.IOManager, error) {
+	return fio.NewFileIOManager(name)
+}
+
+func (OSFS) ReadDir(dirPath string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, nil
+}
+
+func (OSFS) Exists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OSFS) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (OSFS) MkdirAll(path string) error {
+	return os.MkdirAll(path, os.ModePerm)
+}
@@ -0,0 +1,49 @@
+package vfs
+
+import (
+	"bcdb/fio"
+	"path/filepath"
+)
+
+// 将所有路径限制在root目录下的文件系统，类似chroot，路径中的..不能跳出root
+type SubFS struct {
+	fs   FS
+	root string
+}
+
+func NewSubFS(fs FS, root string) *SubFS {
+	return &SubFS{fs: fs, root: filepath.Clean(root)}
+}
+
+// 将路径视为root下的绝对路径
+func (s *SubFS) resolve(name string) string {
+	return filepath.Join(s.root, filepath.Clean(string(filepath.Separator)+name))
+}
+
+func (s *SubFS) OpenFile(name string) (fio.IOManager, error) {
+	return s.fs.OpenFile(s.resolve(name))
+}
+
+func (s *SubFS) ReadDir(dirPath string) ([]string, error) {
+	return s.fs.ReadDir(s.resolve(dirPath))
+}
+
+func (s *SubFS) Exists(name string) (bool, error) {
+	return s.fs.Exists(s.resolve(name))
+}
+
+func (s *SubFS) Remove(name string) error {
+	return s.fs.Remove(s.resolve(name))
+}
+
+func (s *SubFS) RemoveAll(path string) error {
+	return s.fs.RemoveAll(s.resolve(path))
+}
+
+func (s *SubFS) Rename(oldPath, newPath string) error {
+	return s.fs.Rename(s.resolve(oldPath), s.resolve(newPath))
+}
+
+func (s *SubFS) MkdirAll(path string) error {
+	return s.fs.MkdirAll(s.resolve(path))
+}
@@ -0,0 +1,45 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubFS_Resolve(t *testing.T) {
+	memFS := NewMemFS()
+	fs := NewSubFS(memFS, "/sandbox")
+
+	assert.Nil(t, fs.MkdirAll("/data"))
+	_, err := fs.OpenFile("/data/a.data")
+	assert.Nil(t, err)
+	// ..不能跳出root目录
+	_, err = fs.OpenFile("../../data/b.data")
+	assert.Nil(t, err)
+
+	names, err := memFS.ReadDir("/sandbox/data")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.data", "b.data"}, names)
+	ok, err := memFS.Exists("/data")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestSubFS_OS(t *testing.T) {
+	root := t.TempDir()
+
+	fs := NewSubFS(Default, root)
+	assert.Nil(t, fs.MkdirAll("/data"))
+	file, err := fs.OpenFile("/data/a.data")
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+	assert.Nil(t, fs.Rename("/data/a.data", "/data/b.data"))
+
+	_, err = os.Stat(filepath.Join(root, "data", "b.data"))
+	assert.Nil(t, err)
+	assert.Nil(t, fs.RemoveAll("/data"))
+	_, err = os.Stat(filepath.Join(root, "data"))
+	assert.True(t, os.IsNotExist(err))
+}
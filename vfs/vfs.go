@@ -0,0 +1,19 @@
+package vfs
+
+import (
+	"bcdb/fio"
+)
+
+// 数据目录使用的文件系统接口
+type FS interface {
+	OpenFile(name string) (fio.IOManager, error) // 以追加写的方式打开文件，文件不存在时创建
+	ReadDir(dirPath string) ([]string, error)    // 获取目录下所有文件和子目录的名称，按名称排序
+	Exists(name string) (bool, error)            // 判断文件或目录是否存在
+	Remove(name string) error                    // 删除文件
+	RemoveAll(path string) error                 // 删除目录及其中的所有内容
+	Rename(oldPath, newPath string) error        // 重命名文件
+	MkdirAll(path string) error                  // 创建目录
+}
+
+// 默认使用的操作系统文件系统
+var Default FS = NewOSFS()